@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/grafana/generate-policy-bot-config/internal"
+)
+
+// annotationDataEscaper escapes the message of a workflow command.
+var annotationDataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// annotationPropertyEscaper escapes the properties of a workflow command, like
+// `file`.
+var annotationPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+// annotationHandler turns warnings and errors about a location in one of the
+// repository's files into GitHub Actions annotations on that file, like
+// `::warning file=.github/workflows/ci.yml,line=3,col=5::...`, so that they
+// show up next to the problem. The location is the value of an attribute which
+// is an internal.Location. Other records go to the wrapped handler.
+type annotationHandler struct {
+	slog.Handler
+
+	output io.Writer
+	mu     *sync.Mutex
+	attrs  []slog.Attr
+}
+
+func newAnnotationHandler(handler slog.Handler, output io.Writer) annotationHandler {
+	return annotationHandler{Handler: handler, output: output, mu: &sync.Mutex{}}
+}
+
+// recordLocation finds the location a record is about, if it has one.
+func recordLocation(attrs []slog.Attr) (internal.Location, bool) {
+	for _, attr := range attrs {
+		if loc, ok := attr.Value.Any().(internal.Location); ok {
+			return loc, true
+		}
+	}
+
+	return internal.Location{}, false
+}
+
+func (h annotationHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := h.attrs
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+
+	loc, ok := recordLocation(attrs)
+	if !ok || record.Level < slog.LevelWarn {
+		return h.Handler.Handle(ctx, record)
+	}
+
+	command := "warning"
+	if record.Level >= slog.LevelError {
+		command = "error"
+	}
+
+	properties := "file=" + annotationPropertyEscaper.Replace(loc.Path)
+	if loc.Pos.IsValid() {
+		properties += fmt.Sprintf(",line=%d", loc.Pos.Line)
+		if loc.Pos.Column > 0 {
+			properties += fmt.Sprintf(",col=%d", loc.Pos.Column)
+		}
+	}
+
+	var message strings.Builder
+	message.WriteString(record.Message)
+	for _, attr := range attrs {
+		if _, ok := attr.Value.Any().(internal.Location); ok {
+			continue
+		}
+
+		fmt.Fprintf(&message, " %s=%s", attr.Key, attr.Value.Resolve())
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := fmt.Fprintf(h.output, "::%s %s::%s\n", command, properties, annotationDataEscaper.Replace(message.String()))
+	return err
+}
+
+func (h annotationHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h.Handler = h.Handler.WithAttrs(attrs)
+	h.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)
+	return h
+}
+
+// WithGroup stops annotating records, since their attributes would need to be
+// qualified by the group.
+func (h annotationHandler) WithGroup(name string) slog.Handler {
+	return h.Handler.WithGroup(name)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/grafana/generate-policy-bot-config/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationHandler(t *testing.T) {
+	var annotations, other bytes.Buffer
+	logger := slog.New(newAnnotationHandler(slog.NewTextHandler(&other, nil), &annotations))
+
+	loc := internal.Location{Path: ".github/workflows/ci.yml", Pos: internal.Position{Line: 3, Column: 5}}
+
+	logger.With("event", "pull_request").Warn("problem,\nwith the workflow", "path", loc)
+	logger.Error("broken", "path", internal.Location{Path: ".github/workflows/a,b.yml"})
+	logger.Warn("no location", "path", ".github/workflows/ci.yml")
+	logger.Info("not a warning", "path", loc)
+
+	require.Equal(t,
+		"::warning file=.github/workflows/ci.yml,line=3,col=5::problem,%0Awith the workflow event=pull_request\n"+
+			"::error file=.github/workflows/a%2Cb.yml::broken\n",
+		annotations.String(),
+	)
+	require.Contains(t, other.String(), `msg="no location"`)
+	require.Contains(t, other.String(), `msg="not a warning" path=.github/workflows/ci.yml:3:5`)
+}
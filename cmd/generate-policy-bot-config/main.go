@@ -1,12 +1,16 @@
 package main
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
+	"text/template"
 
 	"github.com/grafana/generate-policy-bot-config/internal"
 	"github.com/jessevdk/go-flags"
@@ -36,6 +40,10 @@ func header(programName string, mergeFilename string) string {
 	return sb.String()
 }
 
+// defaultOutput is where the generated config is written, relative to the
+// repository root, unless the flags or the tool's config say otherwise.
+const defaultOutput = ".policy.yml"
+
 const usage = `%s [path/to/repo_root]
 
 Discovers GitHub Actions workflows and generates a policy bot configuration file
@@ -45,16 +53,28 @@ PR.`
 
 // rootDir represents the root directory to search for workflows. It is a
 // wrapper around fs.FS which reads from a directory when unmarshaled from a
-// flag. It exists so that the filesystem can be faked in tests.
+// flag. It exists so that the filesystem can be faked in tests. The directory's
+// path is kept, so that paths in the tool's config can be resolved against it.
 type rootDir struct {
 	fs.FS
+	path string
 }
 
 func (rd *rootDir) UnmarshalFlag(value string) error {
-	*rd = rootDir{os.DirFS(value)}
+	*rd = rootDir{FS: os.DirFS(value), path: value}
 	return nil
 }
 
+// resolve returns the path of a file given relative to the root directory.
+// Absolute paths, and "-" for standard input or output, are left alone.
+func (rd rootDir) resolve(p string) string {
+	if p == "-" || filepath.IsAbs(p) {
+		return p
+	}
+
+	return filepath.Join(rd.path, p)
+}
+
 // reader represents the config to merge with the generated config. If the value
 // is "-", read from standard input. If the value is empty, no merging occurs.
 // Otherwise, read from the file at the given path. It is a wrapper around an
@@ -99,16 +119,92 @@ func (l *level) UnmarshalFlag(value string) error {
 	return nil
 }
 
+// ruleNameTemplate is a template for the names of the rules which require a
+// workflow, parsed when unmarshaled from a flag.
+type ruleNameTemplate struct {
+	*template.Template
+}
+
+func (t *ruleNameTemplate) UnmarshalFlag(value string) error {
+	tmpl, err := internal.ParseRuleNameTemplate(value)
+	if err != nil {
+		return err
+	}
+
+	t.Template = tmpl
+	return nil
+}
+
 type rootArgs struct {
 	Root rootDir
 }
 
 type appFlags struct {
-	OutputWriter *internal.RenamingWriter `long:"output" short:"o" description:"Output file. If this is \"-\", write to standard output" default:".policy.yml"`
-	LogLevel     *level                   `long:"log-level" short:"l" description:"Log level"`
-	MergeConfig  reader                   `long:"merge-with" short:"m" description:"File to merge with generated config. If this is \"-\", read from standard input. If empty, no merging occurs."`
+	OutputWriter           *internal.RenamingWriter `long:"output" short:"o" description:"Output file. If this is \"-\", write to standard output. If it isn't given, the config file's output or else .policy.yml is written, relative to the repository root"`
+	MergeQueueOutputWriter *internal.RenamingWriter `long:"merge-queue-output" description:"Output file for a separate config which requires workflows triggered by merge queues to pass. If this is \"-\", write to standard output. If empty, no merge queue config is generated."`
+	LogLevel               *level                   `long:"log-level" short:"l" description:"Log level"`
+	MergeConfig            reader                   `long:"merge-with" short:"m" description:"File to merge with generated config. If this is \"-\", read from standard input. If empty, no merging occurs."`
+	JobStatuses            string                   `long:"job-statuses" choice:"off" choice:"alongside" choice:"instead" default:"off" description:"Also require the check runs of each workflow's jobs to pass, alongside or instead of the workflow's result"`
+	Strict                 bool                     `long:"strict" description:"Fail without writing any output if any workflow can't be read or parsed, or its rules can't be built"`
+	LargeDiffs             string                   `long:"large-diffs" choice:"paths" choice:"skip" choice:"require" default:"paths" description:"How to treat workflows with path filters on large diffs, where GitHub only checks the first 300 files: check the paths anyway, don't require the workflows, or always require them"`
+	LargeDiffLines         int64                    `long:"large-diff-lines" default:"10000" description:"Number of modified lines from which a diff counts as large. Lines only approximate the files GitHub counts, so this is well above 300"`
+	Config                 string                   `long:"config" short:"c" description:"The tool's own config file, relative to the repository root. If it isn't given, .github/generate-policy-bot-config.yml is read if it exists"`
+	RuleName               ruleNameTemplate         `long:"rule-name" description:"Go template for the names of the rules which require each workflow. It can use {{.Path}}, {{.ID}}, {{.Name}} (the workflow's name) and {{.Triggers}} (its events)"`
 
 	Args rootArgs `positional-args:"yes" required:"yes"`
+
+	// toolConfig is read by loadToolConfig.
+	toolConfig internal.ToolConfig
+}
+
+// loadToolConfig reads the tool's own config from the root directory given in
+// the arguments. The output and merge files it sets are used unless their
+// flags were given, which isSet tells us. Like them, the default output is
+// relative to the repository root, where policy-bot reads it from. It is fine
+// for the default config file not to exist, but not one given by `--config`.
+func (af *appFlags) loadToolConfig(isSet func(longName string) bool) error {
+	path := af.Config
+	if path == "" {
+		path = internal.DefaultToolConfigPath
+	}
+
+	contents, err := fs.ReadFile(af.Args.Root, path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && af.Config == "":
+		slog.Debug("no config file", "path", path)
+	case err != nil:
+		return fmt.Errorf("failed to read config file: %w", err)
+	default:
+		config, err := internal.ParseToolConfig(contents)
+		if err != nil {
+			return internal.ErrInvalidToolConfig{Path: path, Err: err}
+		}
+		af.toolConfig = config
+	}
+
+	if !isSet("output") {
+		if err := af.OutputWriter.Abort(); err != nil {
+			return err
+		}
+
+		output := cmp.Or(af.toolConfig.Output, defaultOutput)
+		af.OutputWriter = &internal.RenamingWriter{}
+		if err := af.OutputWriter.UnmarshalFlag(af.Args.Root.resolve(output)); err != nil {
+			return err
+		}
+	}
+
+	if mergeWith := af.toolConfig.MergeWith; mergeWith != "" && !isSet("merge-with") {
+		if err := af.MergeConfig.UnmarshalFlag(af.Args.Root.resolve(mergeWith)); err != nil {
+			return err
+		}
+
+		// The header names the file as the config does, wherever the
+		// repository is.
+		af.MergeConfig.filename = mergeWith
+	}
+
+	return nil
 }
 
 // listWorkflows returns a list of all the workflows under the root directory
@@ -134,39 +230,84 @@ func (af *appFlags) listWorkflows() ([]string, error) {
 	return allWorkflows, nil
 }
 
-// parsePRWorkflows parses all the workflows under the root directory given in
-// the arguments and returns a map of the workflows that are `pull_request`
-// or `pull_request_target` workflows. The key is the path to the workflow file
-// and the value is the parsed workflow. Workflows that are not `pull_request`
-// or `pull_request_target`, as well as invalid workflows which cannot be
-// parsed or read, are ignored. The only way this function can fail is if it
-// encounters an error while listing the workflows.
-func (af *appFlags) parsePRWorkflows() (internal.GitHubWorkflowCollection, error) {
+// parseWorkflows parses all the workflows under the root directory given in
+// the arguments and returns a map of them. The key is the path to the workflow
+// file and the value is the parsed workflow, with the filters of any
+// paths-filter steps and the local actions it uses read in. Invalid workflows
+// which cannot be parsed or read are left out, and returned as problems. The
+// only way this function can fail is if it encounters an error while listing
+// the workflows.
+func (af *appFlags) parseWorkflows() (internal.GitHubWorkflowCollection, []error, error) {
 	paths, err := af.listWorkflows()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	workflows := make(map[string]internal.GitHubWorkflow)
+	var problems []error
 
 	for _, workflowPath := range paths {
 		contents, err := fs.ReadFile(af.Args.Root, workflowPath)
 		if err != nil {
-			slog.Warn("failed to read workflow", "path", workflowPath, "error", err)
+			slog.Warn("failed to read workflow", "path", internal.Location{Path: workflowPath}, "error", err)
+			problems = append(problems, fmt.Errorf("failed to read workflow %s: %w", workflowPath, err))
 			continue
 		}
 
 		slog.Debug("parsing workflow", "path", workflowPath)
-		var workflow internal.GitHubWorkflow
-		err = yaml.Unmarshal(contents, &workflow)
+		workflow, err := internal.ParseWorkflow(contents)
 		if err != nil {
-			err = internal.ErrInvalidWorkflow{Path: workflowPath, Err: err}
-			slog.Warn("failed to parse workflow", "path", workflowPath, "error", err)
+			err := internal.ErrInvalidWorkflow{Path: workflowPath, Err: err}
+			slog.Warn("failed to parse workflow", "path", err.Location(), "error", err.Err)
+			problems = append(problems, err)
+			continue
+		}
+
+		// Invalid directives are left out, but the workflow is still required
+		for _, directiveErr := range workflow.InvalidDirectives() {
+			err := internal.ErrInvalidWorkflow{Path: workflowPath, Err: directiveErr}
+			slog.Warn("ignoring invalid directive", "path", err.Location(), "error", err.Err)
+			problems = append(problems, err)
+		}
+
+		workflows[workflowPath] = workflow
+	}
+
+	resolved := internal.GitHubWorkflowCollection(workflows).
+		ResolvePathsFilters(af.Args.Root).
+		ResolveLocalActions(af.Args.Root)
+
+	return resolved, problems, nil
+}
+
+// prWorkflows returns the workflows that are `pull_request`,
+// `pull_request_target` or `pull_request_review` workflows which we can
+// require, along with the workflows which they trigger through `workflow_run`
+// and the `issue_comment` workflows which have opted in to being required.
+func prWorkflows(workflows internal.GitHubWorkflowCollection) internal.GitHubWorkflowCollection {
+	prWorkflows := make(map[string]internal.GitHubWorkflow)
+
+	for workflowPath, workflow := range workflows.ResolveReusableWorkflows().ResolveWorkflowRuns() {
+		if workflow.IsWorkflowRunForPullRequest() {
+			slog.Debug("including workflow triggered by a PR workflow", "path", workflowPath)
+			prWorkflows[workflowPath] = workflow
+			continue
+		}
+
+		if workflow.IsCommentWorkflow() {
+			slog.Debug("including comment-triggered workflow", "path", workflowPath)
+			prWorkflows[workflowPath] = workflow
+			continue
+		}
+
+		if workflow.IsPullRequestReviewWorkflow() {
+			slog.Debug("including workflow triggered by PR reviews", "path", workflowPath)
+			prWorkflows[workflowPath] = workflow
 			continue
 		}
 
 		if !workflow.IsPullRequestWorkflow() {
-			slog.Debug("skipping non-PR workflow", "path", workflowPath)
+			slog.Info("skipping non-PR workflow", "path", internal.Location{Path: workflowPath, Pos: workflow.TriggerPosition()})
 			continue
 		}
 
@@ -176,20 +317,42 @@ func (af *appFlags) parsePRWorkflows() (internal.GitHubWorkflowCollection, error
 		// present when the PR is first opened but if it gets another push then
 		// there won't be one.
 		if !workflow.RunsOnSynchronize() {
-			slog.Debug("skipping workflow that doesn't run on synchronize", "path", workflowPath)
+			slog.Warn(
+				"skipping workflow that doesn't run on synchronize",
+				"path", internal.Location{Path: workflowPath, Pos: workflow.TriggerPosition("pull_request", "pull_request_target")},
+			)
 			continue
 		}
 
-		workflows[workflowPath] = workflow
+		prWorkflows[workflowPath] = workflow
+	}
+
+	return prWorkflows
+}
+
+// mergeQueueWorkflows returns the workflows which run in a merge queue.
+func mergeQueueWorkflows(workflows internal.GitHubWorkflowCollection) internal.GitHubWorkflowCollection {
+	mergeQueueWorkflows := make(map[string]internal.GitHubWorkflow)
+
+	for workflowPath, workflow := range workflows {
+		if !workflow.IsMergeQueueWorkflow() {
+			continue
+		}
+
+		mergeQueueWorkflows[workflowPath] = workflow
 	}
 
-	return workflows, nil
+	return mergeQueueWorkflows
 }
 
 func (af *appFlags) abort() {
 	if err := af.OutputWriter.Abort(); err != nil {
 		slog.Warn("failed to abort", "error", err)
 	}
+
+	if err := af.MergeQueueOutputWriter.Abort(); err != nil {
+		slog.Warn("failed to abort merge queue output", "error", err)
+	}
 }
 
 // loadConfigFromReader reads a policy bot config from the given reader. This is
@@ -203,19 +366,79 @@ func loadConfigFromReader(r io.Reader) (policy.Config, error) {
 	return config, nil
 }
 
+// writeConfig writes a generated config, with its header, to the given writer.
+func writeConfig(dest io.Writer, name, mergeFilename string, config policy.Config) error {
+	if _, err := dest.Write([]byte(header(name, mergeFilename))); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	if err := internal.WriteYamlToWriter(dest, config); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
 func (af *appFlags) run(name string) error {
 	dest := af.OutputWriter
 	defer dest.Close()
 
+	if af.MergeQueueOutputWriter != nil {
+		defer af.MergeQueueOutputWriter.Close()
+	}
+
+	strategy := internal.LargeDiffStrategy(af.LargeDiffs)
+	if (strategy == internal.LargeDiffsSkip || strategy == internal.LargeDiffsRequire) && af.LargeDiffLines < 1 {
+		af.abort()
+		return fmt.Errorf("--large-diff-lines must be at least 1, got %d", af.LargeDiffLines)
+	}
+
 	// Find and parse all the workflows
-	workflows, err := af.parsePRWorkflows()
+	workflows, problems, err := af.parseWorkflows()
+	if err != nil {
+		af.abort()
+		return err
+	}
+
+	// Apply the tool's config to the workflows, and name the rules which
+	// require them. The merge queue workflows, if we were asked for their
+	// config, are named together with the PR ones, so that a workflow's rules
+	// have the same name in both configs.
+	collections := []internal.GitHubWorkflowCollection{prWorkflows(workflows).ApplyToolConfig(af.toolConfig)}
+	if af.MergeQueueOutputWriter != nil {
+		collections = append(collections, mergeQueueWorkflows(workflows).ApplyToolConfig(af.toolConfig))
+	}
+
+	named, err := internal.NameRulesTogether(af.RuleName.Template, collections...)
 	if err != nil {
 		af.abort()
 		return err
 	}
 
 	// Generate a policy bot config from them
-	config := workflows.PolicyBotConfig()
+	config, policies, err := named[0].
+		RequireJobStatuses(internal.JobStatusMode(af.JobStatuses)).
+		HandleLargeDiffs(strategy, af.LargeDiffLines).
+		PolicyBotConfig()
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	// And the merge queue config, if we were asked to
+	var mergeQueueConfig policy.Config
+	if af.MergeQueueOutputWriter != nil {
+		mergeQueueConfig, err = named[1].MergeQueuePolicyBotConfig()
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	// In strict mode, any problem means some workflows aren't required, so
+	// don't write a config at all
+	if af.Strict && len(problems) > 0 {
+		af.abort()
+		return fmt.Errorf("strict mode: found problems with the workflows:\n%w", errors.Join(problems...))
+	}
 
 	// Merge the generated config with an existing config, if one was provided
 	if af.MergeConfig.Reader != nil {
@@ -225,6 +448,13 @@ func (af *appFlags) run(name string) error {
 			return err
 		}
 
+		// Replace references to the generated workflows' rules by ID
+		mergeConfig, err = internal.ResolveWorkflowReferences(mergeConfig, policies)
+		if err != nil {
+			af.abort()
+			return fmt.Errorf("failed to resolve workflow references in the config to merge: %w", err)
+		}
+
 		config, err = internal.MergeConfigs(config, mergeConfig)
 		if err != nil {
 			af.abort()
@@ -233,14 +463,17 @@ func (af *appFlags) run(name string) error {
 	}
 
 	// Write the config to the output file
-	if _, err := dest.Write([]byte(header(name, af.MergeConfig.filename))); err != nil {
+	if err := writeConfig(dest, name, af.MergeConfig.filename, config); err != nil {
 		af.abort()
-		return fmt.Errorf("failed to write header: %w", err)
+		return err
 	}
 
-	if err := internal.WriteYamlToWriter(dest, config); err != nil {
-		af.abort()
-		return fmt.Errorf("failed to write config: %w", err)
+	// Write the merge queue config, if we were asked to
+	if af.MergeQueueOutputWriter != nil {
+		if err := writeConfig(af.MergeQueueOutputWriter, name, "", mergeQueueConfig); err != nil {
+			af.abort()
+			return fmt.Errorf("failed to write merge queue config: %w", err)
+		}
 	}
 
 	return nil
@@ -255,14 +488,15 @@ func setupLogger() *slog.LevelVar {
 	defer func() { slog.SetDefault(logger) }()
 
 	if os.Getenv("GITHUB_ACTIONS") == "true" {
-		logger = slog.New(&actionslog.Wrapper{
+		// Problems in workflow files are annotated on the files themselves.
+		logger = slog.New(newAnnotationHandler(&actionslog.Wrapper{
 			Handler: (&human.Handler{
 				AddSource:   true,
 				ExcludeTime: true,
 				Level:       &lv,
 			}).WithOutput,
 			Output: os.Stderr,
-		})
+		}, os.Stderr))
 
 		if os.Getenv("RUNNER_DEBUG") == "1" {
 			lv.Set(slog.LevelDebug)
@@ -289,11 +523,19 @@ func main() {
 		if err != nil {
 			slog.Warn("attempted to abort when exiting, but failed", "error", err)
 		}
+
+		err = conf.MergeQueueOutputWriter.Abort()
+		if err != nil {
+			slog.Warn("attempted to abort merge queue output when exiting, but failed", "error", err)
+		}
 	}()
 
 	parser := flags.NewParser(&conf, flags.Default)
 	parser.Usage = fmt.Sprintf(usage, parser.Name)
 
+	// Tags can't refer to the constant, so the default is set here.
+	parser.FindOptionByLongName("rule-name").Default = []string{internal.DefaultRuleNameTemplate}
+
 	if _, err := parser.Parse(); err != nil {
 		switch err.(type) {
 		// The flags package prints its own error messages, don't repeat them
@@ -312,6 +554,16 @@ func main() {
 	}
 	slog.Debug("debug logging enabled")
 
+	isSet := func(longName string) bool {
+		option := parser.FindOptionByLongName(longName)
+		return option.IsSet() && !option.IsSetDefault()
+	}
+
+	if err := conf.loadToolConfig(isSet); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
 	if err := conf.run(parser.Name); err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"testing/fstest"
 
@@ -53,10 +55,61 @@ func TestParseFlags(t *testing.T) {
 			args:        []string{"-o", "output.yml"},
 			expectError: true,
 		},
+		{
+			name:        "Job statuses",
+			args:        []string{"-o", "-", "--job-statuses", "alongside"},
+			expectedDir: "testdir",
+			expectedOut: "-",
+		},
+		{
+			name:        "Invalid job statuses",
+			args:        []string{"-o", "-", "--job-statuses", "sometimes"},
+			expectedDir: "testdir",
+			expectError: true,
+		},
+		{
+			name:        "Strict",
+			args:        []string{"-o", "-", "--strict"},
+			expectedDir: "testdir",
+			expectedOut: "-",
+		},
+		{
+			name:        "Large diffs",
+			args:        []string{"-o", "-", "--large-diffs", "skip", "--large-diff-lines", "1000"},
+			expectedDir: "testdir",
+			expectedOut: "-",
+		},
+		{
+			name:        "Rule name",
+			args:        []string{"-o", "-", "--rule-name", "{{.Name}} passed"},
+			expectedDir: "testdir",
+			expectedOut: "-",
+		},
+		{
+			name:        "Invalid rule name",
+			args:        []string{"-o", "-", "--rule-name", "{{.Name"},
+			expectedDir: "testdir",
+			expectError: true,
+		},
+		{
+			name:        "Config file",
+			args:        []string{"-o", "-", "--config", ".github/policy-bot-generator.yml"},
+			expectedDir: "testdir",
+			expectedOut: "-",
+		},
+		{
+			name:        "Invalid large diffs",
+			args:        []string{"-o", "-", "--large-diffs", "ignore"},
+			expectedDir: "testdir",
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			// Relative output paths are written to the working directory.
+			t.Chdir(t.TempDir())
+
 			savedStdout := os.Stdout
 			r, w, _ := os.Pipe()
 			os.Stdout = w
@@ -132,7 +185,7 @@ func TestListWorkflows(t *testing.T) {
 		".github/workflows/not-a-workflow.txt": &fstest.MapFile{Data: []byte("")},
 	}
 
-	conf := appFlags{Args: rootArgs{Root: rootDir{mapFS}}}
+	conf := appFlags{Args: rootArgs{Root: rootDir{FS: mapFS}}}
 
 	workflows, err := conf.listWorkflows()
 	require.NoError(t, err)
@@ -154,16 +207,130 @@ on:
 `)},
 	}
 
-	conf := appFlags{Args: rootArgs{Root: rootDir{mapFS}}}
+	conf := appFlags{Args: rootArgs{Root: rootDir{FS: mapFS}}}
 
-	workflows, err := conf.parsePRWorkflows()
+	parsed, _, err := conf.parseWorkflows()
 	require.NoError(t, err)
 
+	workflows := prWorkflows(parsed)
+
 	require.Len(t, workflows, 1)
 	require.Contains(t, workflows, ".github/workflows/pr_workflow.yml")
 	require.NotContains(t, workflows, ".github/workflows/non_pr_workflow.yml")
 }
 
+func TestParsePRWorkflowsOtherTriggers(t *testing.T) {
+	mapFS := fstest.MapFS{
+		".github/workflows/ci.yml": &fstest.MapFile{Data: []byte(`
+name: CI
+on:
+  pull_request:
+    paths: ["src/**"]
+`)},
+		".github/workflows/coverage.yml": &fstest.MapFile{Data: []byte(`
+on:
+  workflow_run:
+    workflows: [CI]
+    types: [completed]
+`)},
+		".github/workflows/review.yml": &fstest.MapFile{Data: []byte(`
+on:
+  pull_request_review:
+    types: [submitted]
+`)},
+		".github/workflows/integration.yml": &fstest.MapFile{Data: []byte(`
+# generate-policy-bot-config: status=integration
+on: issue_comment
+`)},
+		".github/workflows/chatops.yml": &fstest.MapFile{Data: []byte(`
+on: issue_comment
+`)},
+		".github/workflows/after_push.yml": &fstest.MapFile{Data: []byte(`
+on:
+  workflow_run:
+    workflows: [Deploy]
+`)},
+	}
+
+	conf := appFlags{Args: rootArgs{Root: rootDir{FS: mapFS}}}
+
+	parsed, _, err := conf.parseWorkflows()
+	require.NoError(t, err)
+
+	workflows := prWorkflows(parsed)
+
+	require.Len(t, workflows, 4)
+	require.Contains(t, workflows, ".github/workflows/ci.yml")
+	require.Contains(t, workflows, ".github/workflows/integration.yml")
+	require.Contains(t, workflows, ".github/workflows/review.yml")
+	require.Contains(t, workflows, ".github/workflows/coverage.yml")
+	require.True(t, workflows[".github/workflows/coverage.yml"].IsWorkflowRunForPullRequest())
+}
+
+func TestMergeQueueWorkflows(t *testing.T) {
+	mapFS := fstest.MapFS{
+		".github/workflows/pr_workflow.yml": &fstest.MapFile{Data: []byte(`
+on:
+  pull_request:
+`)},
+		".github/workflows/merge_group_workflow.yml": &fstest.MapFile{Data: []byte(`
+on:
+  merge_group:
+`)},
+		".github/workflows/push_workflow.yml": &fstest.MapFile{Data: []byte(`
+on:
+  push:
+    branches: ["gh-readonly-queue/**"]
+`)},
+	}
+
+	conf := appFlags{Args: rootArgs{Root: rootDir{FS: mapFS}}}
+
+	workflows, problems, err := conf.parseWorkflows()
+	require.NoError(t, err)
+	require.Empty(t, problems)
+	require.Len(t, workflows, 3)
+
+	queueWorkflows := mergeQueueWorkflows(workflows)
+	require.Len(t, queueWorkflows, 2)
+	require.Contains(t, queueWorkflows, ".github/workflows/merge_group_workflow.yml")
+	require.Contains(t, queueWorkflows, ".github/workflows/push_workflow.yml")
+
+	require.Len(t, prWorkflows(workflows), 1)
+}
+
+func TestRunWithMergeQueueOutput(t *testing.T) {
+	mapFS := fstest.MapFS{
+		".github/workflows/workflow.yml": &fstest.MapFile{Data: []byte(`
+on:
+  merge_group:
+`)},
+	}
+
+	outputBuffer := &bytes.Buffer{}
+	mergeQueueBuffer := &bytes.Buffer{}
+	conf := testAppFlags(mapFS, outputBuffer, reader{})
+	conf.MergeQueueOutputWriter = &internal.RenamingWriter{
+		WriteCloserRenamerRemover: internal.NopRenamerRemover{
+			WriteCloser: &bytesBufferCloser{mergeQueueBuffer},
+		},
+	}
+
+	err := conf.run("test-command")
+	require.NoError(t, err)
+
+	var prConfig policy.Config
+	require.NoError(t, yaml.Unmarshal(outputBuffer.Bytes(), &prConfig))
+	require.Empty(t, prConfig.ApprovalRules)
+
+	require.Contains(t, mergeQueueBuffer.String(), "# This file is generated by test-command.")
+
+	var mergeQueueConfig policy.Config
+	require.NoError(t, yaml.Unmarshal(mergeQueueBuffer.Bytes(), &mergeQueueConfig))
+	require.Len(t, mergeQueueConfig.ApprovalRules, 2)
+	require.Equal(t, "Workflow .github/workflows/workflow.yml succeeded or skipped (merge queue)", mergeQueueConfig.ApprovalRules[0].Name)
+}
+
 type bytesBufferCloser struct {
 	*bytes.Buffer
 }
@@ -257,7 +424,7 @@ on:
 
 			outputBuffer := &bytes.Buffer{}
 			conf := appFlags{
-				Args: rootArgs{Root: rootDir{mapFS}},
+				Args: rootArgs{Root: rootDir{FS: mapFS}},
 				OutputWriter: &internal.RenamingWriter{
 					WriteCloserRenamerRemover: internal.NopRenamerRemover{
 						WriteCloser: &bytesBufferCloser{outputBuffer},
@@ -281,6 +448,92 @@ on:
 	}
 }
 
+func TestRunStrict(t *testing.T) {
+	mapFS := fstest.MapFS{
+		".github/workflows/valid.yml": &fstest.MapFile{Data: []byte(`
+on:
+  pull_request:
+    paths: ["src/**"]
+`)},
+		".github/workflows/invalid.yml": &fstest.MapFile{Data: []byte(`
+on: 42
+`)},
+		".github/workflows/typo.yml": &fstest.MapFile{Data: []byte(`
+on:
+  pull_request:
+    branches: {main: true}
+`)},
+		".github/workflows/conflict.yml": &fstest.MapFile{Data: []byte(`
+on:
+  pull_request:
+    paths: ["src/**"]
+    paths-ignore: ["docs/**"]
+`)},
+		// A typo in a directive doesn't stop the workflow from being required.
+		".github/workflows/directive.yml": &fstest.MapFile{Data: []byte(`# generate-policy-bot-config: conclusoin=success
+on:
+  pull_request:
+`)},
+	}
+
+	t.Run("not strict", func(t *testing.T) {
+		outputBuffer := &bytes.Buffer{}
+		conf := testAppFlags(mapFS, outputBuffer, reader{})
+
+		require.NoError(t, conf.run("test-command"))
+
+		var parsedPolicy policy.Config
+		require.NoError(t, yaml.Unmarshal(outputBuffer.Bytes(), &parsedPolicy))
+		require.Len(t, parsedPolicy.ApprovalRules, 3)
+		require.Equal(t, "Workflow .github/workflows/directive.yml succeeded or skipped", parsedPolicy.ApprovalRules[0].Name)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		outputBuffer := &bytes.Buffer{}
+		conf := testAppFlags(mapFS, outputBuffer, reader{})
+		conf.Strict = true
+
+		err := conf.run("test-command")
+		require.ErrorContains(t, err, "strict mode: found problems with the workflows")
+		require.ErrorContains(t, err, "invalid workflow file .github/workflows/invalid.yml:2:5")
+		require.ErrorContains(t, err, "invalid workflow file .github/workflows/typo.yml:4")
+		require.ErrorContains(t, err, "invalid workflow file .github/workflows/directive.yml:1:1: invalid directive `conclusoin=success`")
+		require.ErrorContains(t, err, "invalid workflow file .github/workflows/conflict.yml:3:3: invalid `pull_request` trigger: `paths` and `paths-ignore` can't both be set")
+
+		var invalid internal.ErrInvalidWorkflow
+		require.ErrorAs(t, err, &invalid)
+		require.Empty(t, outputBuffer.String())
+	})
+}
+
+func TestRunLargeDiffLines(t *testing.T) {
+	mapFS := fstest.MapFS{
+		".github/workflows/workflow.yml": &fstest.MapFile{Data: []byte(`
+on:
+  pull_request:
+    paths: ["src/**"]
+`)},
+	}
+
+	outputBuffer := &bytes.Buffer{}
+	conf := testAppFlags(mapFS, outputBuffer, reader{})
+	conf.LargeDiffs = string(internal.LargeDiffsSkip)
+
+	require.ErrorContains(t, conf.run("test-command"), "--large-diff-lines must be at least 1, got 0")
+	require.Empty(t, outputBuffer.String())
+
+	conf = testAppFlags(mapFS, outputBuffer, reader{})
+	conf.LargeDiffs = string(internal.LargeDiffsSkip)
+	conf.LargeDiffLines = 300
+	require.NoError(t, conf.run("test-command"))
+
+	var parsedPolicy policy.Config
+	require.NoError(t, yaml.Unmarshal(outputBuffer.Bytes(), &parsedPolicy))
+	require.Equal(t, &predicate.ModifiedLines{
+		Total: predicate.ComparisonExpr{Op: predicate.OpLessThan, Value: 300},
+	}, parsedPolicy.ApprovalRules[0].Predicates.ModifiedLines)
+}
+
 func BenchmarkRun(b *testing.B) {
 	mapFS := fstest.MapFS{
 		".github/workflows/workflow.yml": &fstest.MapFile{Data: []byte(`
@@ -291,8 +544,7 @@ on:
 		".github/workflows/workflow2.yml": &fstest.MapFile{Data: []byte(`
 on:
   pull_request:
-    paths: ["src/**"]
-    paths-ignore: ["docs/**"]
+    paths: ["src/**", "!src/docs/**"]
 `)},
 		".github/workflows/workflow3.yml": &fstest.MapFile{Data: []byte(`
 on:
@@ -302,20 +554,17 @@ on:
 on:
   pull_request_target:
     branches: ["release/*"]
-    paths: ["config/**"]
-    paths-ignore: ["README.md"]
+    paths: ["config/**", "!config/README.md"]
 `)},
 		".github/workflows/workflow5.yml": &fstest.MapFile{Data: []byte(`
 on:
   pull_request:
     branches: ["main", "develop"]
-    paths: ["src/**"]
-    paths-ignore: ["docs/**"]
+    paths: ["src/**", "!src/docs/**"]
 
   pull_request_target:
     branches: ["release/*"]
-    paths: ["config/**"]
-    paths-ignore: ["README.md"]
+    paths: ["config/**", "!config/README.md"]
 `)},
 	}
 
@@ -324,7 +573,7 @@ on:
 		buf := &bytes.Buffer{}
 
 		conf := appFlags{
-			Args: rootArgs{Root: rootDir{mapFS}},
+			Args: rootArgs{Root: rootDir{FS: mapFS}},
 			OutputWriter: &internal.RenamingWriter{
 				WriteCloserRenamerRemover: internal.NopRenamerRemover{
 					WriteCloser: &bytesBufferCloser{buf},
@@ -353,11 +602,16 @@ on:
 	}
 
 	flags := appFlags{
-		Args: rootArgs{Root: rootDir{mapFS}},
+		Args: rootArgs{Root: rootDir{FS: mapFS}},
 	}
-	workflows, err := flags.parsePRWorkflows()
+	parsed, _, err := flags.parseWorkflows()
 	require.NoError(t, err)
-	return workflows.PolicyBotConfig()
+
+	workflows := prWorkflows(parsed)
+
+	config, _, err := workflows.PolicyBotConfig()
+	require.NoError(t, err)
+	return config
 }
 
 func expectedConfig(t *testing.T) policy.Config {
@@ -409,7 +663,7 @@ func expectedConfig(t *testing.T) policy.Config {
 
 func testAppFlags(mapFS fstest.MapFS, outputBuffer *bytes.Buffer, mergeReader reader) appFlags {
 	return appFlags{
-		Args: rootArgs{Root: rootDir{mapFS}},
+		Args: rootArgs{Root: rootDir{FS: mapFS}},
 		OutputWriter: &internal.RenamingWriter{
 			WriteCloserRenamerRemover: internal.NopRenamerRemover{
 				WriteCloser: &bytesBufferCloser{outputBuffer},
@@ -511,3 +765,215 @@ approval_rules:
 		})
 	}
 }
+
+func TestRunWithMergeWorkflowReferences(t *testing.T) {
+	mapFS := fstest.MapFS{
+		".github/workflows/workflow.yml": &fstest.MapFile{Data: []byte(`# generate-policy-bot-config: id=tests
+on:
+  pull_request:
+`)},
+	}
+
+	t.Run("Resolved", func(t *testing.T) {
+		outputBuffer := &bytes.Buffer{}
+		conf := testAppFlags(mapFS, outputBuffer, reader{Reader: bytes.NewReader([]byte(`
+policy:
+  approval:
+    - or:
+      - workflow:tests
+      - custom_rule
+
+approval_rules:
+  - name: custom_rule
+`)), filename: "merge.yml"})
+
+		require.NoError(t, conf.run("test-command"))
+
+		var resultConfig policy.Config
+		require.NoError(t, yaml.Unmarshal(outputBuffer.Bytes(), &resultConfig))
+
+		require.Contains(t, resultConfig.Policy.Approval, map[string]interface{}{"or": []interface{}{
+			"Workflow .github/workflows/workflow.yml succeeded or skipped",
+			"custom_rule",
+		}})
+	})
+
+	t.Run("Unknown ID", func(t *testing.T) {
+		outputBuffer := &bytes.Buffer{}
+		conf := testAppFlags(mapFS, outputBuffer, reader{Reader: bytes.NewReader([]byte(`
+policy:
+  approval:
+    - workflow:workflow
+`)), filename: "merge.yml"})
+
+		err := conf.run("test-command")
+		require.ErrorContains(t, err, "can't resolve `workflow:workflow`: no generated workflow has this ID")
+		require.Empty(t, outputBuffer.String())
+	})
+}
+
+func TestLoadToolConfig(t *testing.T) {
+	writeRepo := func(t *testing.T, files map[string]string) string {
+		t.Helper()
+
+		root := t.TempDir()
+		for name, contents := range files {
+			path := filepath.Join(root, name)
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+		}
+
+		return root
+	}
+
+	load := func(t *testing.T, root, config string, set ...string) (appFlags, error) {
+		t.Helper()
+
+		var conf appFlags
+		require.NoError(t, conf.Args.Root.UnmarshalFlag(root))
+		conf.Config = config
+
+		conf.OutputWriter = &internal.RenamingWriter{}
+		require.NoError(t, conf.OutputWriter.UnmarshalFlag(filepath.Join(root, "flag.yml")))
+		t.Cleanup(func() { require.NoError(t, conf.OutputWriter.Abort()) })
+
+		err := conf.loadToolConfig(func(longName string) bool { return slices.Contains(set, longName) })
+		return conf, err
+	}
+
+	const toolConfig = `output: generated.yml
+merge_with: policy.yml
+exclude: [".github/workflows/release.yml"]
+`
+
+	t.Run("Default path", func(t *testing.T) {
+		root := writeRepo(t, map[string]string{
+			internal.DefaultToolConfigPath: toolConfig,
+			"policy.yml":                   "approval_rules: []\n",
+		})
+
+		conf, err := load(t, root, "")
+		require.NoError(t, err)
+		require.Equal(t, []string{".github/workflows/release.yml"}, conf.toolConfig.Exclude)
+		require.Equal(t, "policy.yml", conf.MergeConfig.filename)
+
+		// The output goes where the config says, relative to the repository.
+		_, err = conf.OutputWriter.Write([]byte("generated"))
+		require.NoError(t, err)
+		require.NoError(t, conf.OutputWriter.Close())
+
+		contents, err := os.ReadFile(filepath.Join(root, "generated.yml"))
+		require.NoError(t, err)
+		require.Equal(t, "generated", string(contents))
+		require.NoFileExists(t, filepath.Join(root, "flag.yml"))
+	})
+
+	t.Run("Flags take precedence", func(t *testing.T) {
+		root := writeRepo(t, map[string]string{internal.DefaultToolConfigPath: toolConfig})
+
+		conf, err := load(t, root, "", "output", "merge-with")
+		require.NoError(t, err)
+		require.Nil(t, conf.MergeConfig.Reader)
+
+		require.NoError(t, conf.OutputWriter.Close())
+		require.FileExists(t, filepath.Join(root, "flag.yml"))
+		require.NoFileExists(t, filepath.Join(root, "generated.yml"))
+	})
+
+	t.Run("Given path", func(t *testing.T) {
+		root := writeRepo(t, map[string]string{"config.yml": "include: [\".github/workflows/ci.yml\"]\n"})
+
+		conf, err := load(t, root, "config.yml")
+		require.NoError(t, err)
+		require.Equal(t, []string{".github/workflows/ci.yml"}, conf.toolConfig.Include)
+	})
+
+	t.Run("No default config", func(t *testing.T) {
+		conf, err := load(t, writeRepo(t, nil), "")
+		require.NoError(t, err)
+		require.Equal(t, internal.ToolConfig{}, conf.toolConfig)
+	})
+
+	t.Run("Default output", func(t *testing.T) {
+		root := writeRepo(t, nil)
+
+		conf, err := load(t, root, "")
+		require.NoError(t, err)
+
+		// Without a config file or a flag, the output goes to .policy.yml in
+		// the repository, wherever we run.
+		require.NoError(t, conf.OutputWriter.Close())
+		require.FileExists(t, filepath.Join(root, ".policy.yml"))
+		require.NoFileExists(t, filepath.Join(root, "flag.yml"))
+	})
+
+	t.Run("Given config missing", func(t *testing.T) {
+		_, err := load(t, writeRepo(t, nil), "config.yml")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("Invalid config", func(t *testing.T) {
+		root := writeRepo(t, map[string]string{internal.DefaultToolConfigPath: "outputs: generated.yml\n"})
+
+		_, err := load(t, root, "")
+		require.ErrorAs(t, err, &internal.ErrInvalidToolConfig{})
+		require.ErrorContains(t, err, "invalid config file .github/generate-policy-bot-config.yml:1: ")
+	})
+}
+
+func TestRunWithToolConfig(t *testing.T) {
+	mapFS := fstest.MapFS{
+		".github/workflows/ci.yml": &fstest.MapFile{Data: []byte(`
+on:
+  pull_request:
+`)},
+		".github/workflows/lint.yml": &fstest.MapFile{Data: []byte(`
+on:
+  pull_request:
+`)},
+		".github/workflows/release.yml": &fstest.MapFile{Data: []byte(`
+on:
+  pull_request:
+`)},
+	}
+
+	toolConfig, err := internal.ParseToolConfig([]byte(`
+exclude: [".github/workflows/release.yml"]
+workflows:
+  - match: [".github/workflows/lint.yml"]
+    required: false
+  - match: [".github/workflows/ci.yml"]
+    name: CI must pass
+    conclusions: [success]
+`))
+	require.NoError(t, err)
+
+	outputBuffer := &bytes.Buffer{}
+	conf := testAppFlags(mapFS, outputBuffer, reader{})
+	conf.toolConfig = toolConfig
+
+	require.NoError(t, conf.run("test-command"))
+
+	var resultConfig policy.Config
+	require.NoError(t, yaml.Unmarshal(outputBuffer.Bytes(), &resultConfig))
+
+	require.Equal(t, []*approval.Rule{
+		{
+			Name: "CI must pass",
+			Predicates: predicate.Predicates{
+				FileNotDeleted: &predicate.FileNotDeleted{
+					Paths: mustRegexpsFromGlobs(t, []string{".github/workflows/ci.yml"}),
+				},
+			},
+			Requires: approval.Requires{
+				Conditions: predicate.Predicates{
+					HasWorkflowResult: &predicate.HasWorkflowResult{
+						Conclusions: predicate.AllowedConclusions{"success"},
+						Workflows:   []string{".github/workflows/ci.yml"},
+					},
+				},
+			},
+		},
+		{Name: internal.DefaultToApproval},
+	}, resultConfig.ApprovalRules)
+}
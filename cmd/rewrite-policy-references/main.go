@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/grafana/generate-policy-bot-config/internal"
+	"github.com/jessevdk/go-flags"
+)
+
+const usage = `--from OLD_PATH --to NEW_PATH [path/to/policy.yml...]
+
+Rewrites the references to a workflow's rules in hand-written policy-bot configs,
+like the one given to generate-policy-bot-config's --merge-with, after the
+workflow has been renamed or moved. The workflow's path, the default names of
+its rules, and references by ID, like "workflow:ci", are rewritten, unless the
+workflow declares its own ID. If generate-policy-bot-config is given a
+--rule-name template, give the same one here. The workflow is read from the
+repository, at its new path or else at its old one.`
+
+type rewriteArgs struct {
+	Files []string `positional-arg-name:"config" required:"yes"`
+}
+
+type appFlags struct {
+	From     string      `long:"from" required:"yes" description:"The workflow's old path, like .github/workflows/ci.yml"`
+	To       string      `long:"to" required:"yes" description:"The workflow's new path"`
+	Root     string      `long:"root" default:"." description:"The root of the repository, which the workflow's paths are relative to"`
+	RuleName string      `long:"rule-name" description:"The Go template generate-policy-bot-config names the workflow's rules with, if it isn't the default"`
+	Args     rewriteArgs `positional-args:"yes" required:"yes"`
+}
+
+// readWorkflow reads the moved workflow from the repository: at its new path,
+// or at its old one if it hasn't been moved yet.
+func readWorkflow(root, from, to string) (internal.GitHubWorkflow, error) {
+	var contents []byte
+	var err error
+	for _, p := range []string{to, from} {
+		contents, err = os.ReadFile(filepath.Join(root, p))
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return internal.GitHubWorkflow{}, fmt.Errorf("failed to read the workflow: %w", err)
+	}
+
+	return internal.ParseWorkflow(contents)
+}
+
+// rewriteFile rewrites the references in one config, in place, naming the
+// workflow's rules with tmpl. Only the strings which change are replaced, so
+// comments and formatting are kept. The file is only written if anything
+// changed. It returns the number of strings it changed.
+func rewriteFile(path, from, to string, wf internal.GitHubWorkflow, tmpl *template.Template) (int, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	rewritten, changed, err := internal.RewriteWorkflowReferences(contents, from, to, wf, tmpl)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rewrite %s: %w", path, err)
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+
+	if err := os.WriteFile(path, rewritten, info.Mode().Perm()); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return changed, nil
+}
+
+func (af *appFlags) run() error {
+	var tmpl *template.Template
+	if af.RuleName != "" {
+		var err error
+		if tmpl, err = internal.ParseRuleNameTemplate(af.RuleName); err != nil {
+			return err
+		}
+	}
+
+	wf, err := readWorkflow(af.Root, af.From, af.To)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range af.Args.Files {
+		changed, err := rewriteFile(path, af.From, af.To, wf, tmpl)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("rewrote workflow references", "path", path, "n_changed", changed)
+	}
+
+	return nil
+}
+
+func main() {
+	var conf appFlags
+
+	parser := flags.NewParser(&conf, flags.Default)
+	parser.Usage = usage
+
+	if _, err := parser.Parse(); err != nil {
+		if !flags.WroteHelp(err) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if err := conf.run(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
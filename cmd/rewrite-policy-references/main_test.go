@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/generate-policy-bot-config/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteFile(t *testing.T) {
+	const from = ".github/workflows/ci.yml"
+	const to = ".github/workflows/tests.yml"
+
+	dir := t.TempDir()
+
+	t.Run("Changed", func(t *testing.T) {
+		path := filepath.Join(dir, "policy.yml")
+		require.NoError(t, os.WriteFile(path, []byte(`policy:
+  approval:
+    # Either CI passed or someone overrode it.
+    - or:
+        - workflow:ci
+        - Workflow .github/workflows/ci.yml succeeded or skipped
+        - override
+`), 0600))
+
+		changed, err := rewriteFile(path, from, to, internal.GitHubWorkflow{}, nil)
+		require.NoError(t, err)
+		require.Equal(t, 2, changed)
+
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, `policy:
+  approval:
+    # Either CI passed or someone overrode it.
+    - or:
+        - workflow:tests
+        - Workflow .github/workflows/tests.yml succeeded or skipped
+        - override
+`, string(contents))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		path := filepath.Join(dir, "unchanged.yml")
+		original := "policy:\n  approval:\n  - override\n"
+		require.NoError(t, os.WriteFile(path, []byte(original), 0644))
+
+		changed, err := rewriteFile(path, from, to, internal.GitHubWorkflow{}, nil)
+		require.NoError(t, err)
+		require.Zero(t, changed)
+
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, original, string(contents))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.yml")
+		require.NoError(t, os.WriteFile(path, []byte("policy: ["), 0644))
+
+		_, err := rewriteFile(path, from, to, internal.GitHubWorkflow{}, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := rewriteFile(filepath.Join(dir, "missing.yml"), from, to, internal.GitHubWorkflow{}, nil)
+		require.Error(t, err)
+	})
+}
+
+func TestReadWorkflow(t *testing.T) {
+	const from = ".github/workflows/ci.yml"
+	const to = ".github/workflows/tests.yml"
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".github/workflows"), 0755))
+
+	_, err := readWorkflow(root, from, to)
+	require.ErrorContains(t, err, "failed to read the workflow")
+
+	// Before it is moved, the workflow is read from its old path.
+	require.NoError(t, os.WriteFile(filepath.Join(root, from), []byte("on: pull_request\n"), 0644))
+	wf, err := readWorkflow(root, from, to)
+	require.NoError(t, err)
+	require.NotNil(t, wf.On.PullRequest)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, to), []byte("on: push\n"), 0644))
+	wf, err = readWorkflow(root, from, to)
+	require.NoError(t, err)
+	require.Nil(t, wf.On.PullRequest)
+}
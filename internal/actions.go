@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// actionMetadataFiles are the names GitHub looks for in an action's directory,
+// in order.
+var actionMetadataFiles = []string{"action.yml", "action.yaml"}
+
+// localActionMetadata represents the parts of an action's metadata file we
+// need: composite actions run steps, which can use other local actions.
+type localActionMetadata struct {
+	Runs struct {
+		Using string
+		Steps []gitHubWorkflowStep
+	}
+}
+
+// localActionPath returns the directory of the action a step uses, if it is in
+// the same repository, like `./.github/actions/setup-go`. These paths are
+// relative to the root of the repository, even in composite actions.
+func (step gitHubWorkflowStep) localActionPath() (string, bool) {
+	dir, ok := strings.CutPrefix(step.Uses, "./")
+	if !ok {
+		return "", false
+	}
+
+	return path.Clean(dir), true
+}
+
+// readLocalAction reads the metadata of a local action and returns the local
+// actions its steps use, if it is a composite action. Actions which can't be
+// read or parsed are reported, and don't use any others.
+func readLocalAction(root fs.FS, dir string) []string {
+	var contents []byte
+	for _, name := range actionMetadataFiles {
+		var err error
+		contents, err = fs.ReadFile(root, path.Join(dir, name))
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("failed to read local action", "action", dir, "error", err)
+			return nil
+		}
+	}
+
+	if contents == nil {
+		slog.Warn("local action has no action.yml or action.yaml", "action", dir)
+		return nil
+	}
+
+	var metadata localActionMetadata
+	if err := yaml.Unmarshal(contents, &metadata); err != nil {
+		slog.Warn("failed to parse local action", "action", dir, "error", err)
+		return nil
+	}
+
+	if metadata.Runs.Using != "composite" {
+		return nil
+	}
+
+	var uses []string
+	for _, step := range metadata.Runs.Steps {
+		if nested, ok := step.localActionPath(); ok {
+			uses = append(uses, nested)
+		}
+	}
+
+	return uses
+}
+
+// ResolveLocalActions finds the local actions which the steps of each
+// workflow use, including those used by the steps of local composite actions,
+// reading them from the repository. It returns a copy of the collection with
+// the actions' directories recorded on the workflows. Each action is only read
+// once, and actions which use each other in a cycle are only followed once.
+func (workflows GitHubWorkflowCollection) ResolveLocalActions(root fs.FS) GitHubWorkflowCollection {
+	nested := make(map[string][]string)
+
+	var find func(dir string, found map[string]bool)
+	find = func(dir string, found map[string]bool) {
+		if found[dir] {
+			return
+		}
+		found[dir] = true
+
+		uses, ok := nested[dir]
+		if !ok {
+			uses = readLocalAction(root, dir)
+			nested[dir] = uses
+		}
+
+		for _, dir := range uses {
+			find(dir, found)
+		}
+	}
+
+	resolved := make(GitHubWorkflowCollection, len(workflows))
+	for _, p := range slices.Sorted(maps.Keys(workflows)) {
+		wf := workflows[p]
+
+		found := make(map[string]bool)
+		for _, id := range sortedJobIDs(wf) {
+			for _, step := range wf.Jobs[id].Steps {
+				if dir, ok := step.localActionPath(); ok {
+					find(dir, found)
+				}
+			}
+		}
+
+		wf.localActions = slices.Sorted(maps.Keys(found))
+		resolved[p] = wf
+	}
+
+	return resolved
+}
+
+// localActionPaths returns the directories of the local actions which the
+// workflow uses, including those used by the reusable workflows it calls, in
+// order. It is only set on workflows returned from ResolveLocalActions.
+func (wf GitHubWorkflow) localActionPaths() []string {
+	dirs := slices.Clone(wf.localActions)
+	for _, job := range wf.Jobs {
+		if job.callee != nil {
+			dirs = append(dirs, job.callee.Workflow.localActionPaths()...)
+		}
+	}
+
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// unwatchedLocalActions returns the directories of the local actions whose
+// changes none of the segments of a path filter match.
+func unwatchedLocalActions(segments []filterSegment, dirs []string) []string {
+	var unwatched []string
+	for _, dir := range dirs {
+		file := path.Join(dir, actionMetadataFiles[0])
+		if !slices.ContainsFunc(segments, func(s filterSegment) bool { return s.matches(file) }) {
+			unwatched = append(unwatched, dir)
+		}
+	}
+
+	return unwatched
+}
+
+// warnUnwatchedLocalActions reports the local actions which a workflow uses,
+// but whose changes don't trigger it because of its path filters. Like a
+// reusable workflow, changing one of them alone changes what the workflow does
+// without running it. We can't require the workflow when only the action
+// changes, since GitHub wouldn't run it: the action's directory has to be
+// added to the workflow's path filters.
+func warnUnwatchedLocalActions(p string, wf GitHubWorkflow) {
+	dirs := wf.localActionPaths()
+
+	for _, trigger := range wf.pullRequestTriggers() {
+		segments := filterSegments(trigger.Paths, trigger.PathsIgnore)
+
+		for _, dir := range unwatchedLocalActions(segments, dirs) {
+			slog.Warn(
+				"workflow's path filters don't match a local action it uses, changes to it alone won't run the workflow",
+				"path", Location{Path: p, Pos: trigger.Pos},
+				"event", trigger.Event,
+				"action", dir,
+			)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// localActionsRoot is a repository with composite actions which use each
+// other.
+var localActionsRoot = fstest.MapFS{
+	".github/actions/setup-go/action.yml": &fstest.MapFile{Data: []byte(`
+runs:
+  using: composite
+  steps:
+    - uses: ./.github/actions/cache
+    - uses: actions/setup-go@v5
+`)},
+	".github/actions/cache/action.yaml": &fstest.MapFile{Data: []byte(`
+runs:
+  using: composite
+  steps:
+    - uses: ./.github/actions/setup-go
+`)},
+	".github/actions/lint/action.yml": &fstest.MapFile{Data: []byte(`
+runs:
+  using: node20
+  main: index.js
+`)},
+}
+
+func TestResolveLocalActions(t *testing.T) {
+	var wf GitHubWorkflow
+	require.NoError(t, yaml.Unmarshal([]byte(`
+on: pull_request
+jobs:
+  build:
+    steps:
+      - uses: actions/checkout@v4
+      - uses: ./.github/actions/setup-go
+  lint:
+    steps:
+      - uses: ./.github/actions/lint/
+      - uses: ./.github/actions/missing
+`), &wf))
+
+	workflows := GitHubWorkflowCollection{".github/workflows/ci.yml": wf}.ResolveLocalActions(localActionsRoot)
+
+	require.Equal(t, []string{
+		".github/actions/cache",
+		".github/actions/lint",
+		".github/actions/missing",
+		".github/actions/setup-go",
+	}, workflows[".github/workflows/ci.yml"].localActionPaths())
+}
+
+func TestMakeApprovalRulesLocalActions(t *testing.T) {
+	const path = ".github/workflows/ci.yml"
+
+	var wf GitHubWorkflow
+	require.NoError(t, yaml.Unmarshal([]byte(`
+on:
+  pull_request:
+    paths:
+      - 'src/**'
+      - '.github/actions/lint/**'
+jobs:
+  build:
+    steps:
+      - uses: ./.github/actions/setup-go
+      - uses: ./.github/actions/lint
+`), &wf))
+
+	workflows := GitHubWorkflowCollection{path: wf}.ResolveLocalActions(localActionsRoot)
+
+	// Only the workflow's own path filters decide when it's required, since
+	// changing an action they don't match doesn't run it.
+	result, err := makeApprovalRules(path, workflows[path])
+	require.NoError(t, err)
+
+	require.Len(t, result.Rules, 1)
+	require.Equal(t, &predicate.ChangedFiles{
+		Paths: mustRegexpsFromGlobs(t, []string{"src/**", ".github/actions/lint/**"}),
+	}, result.Rules[0].Predicates.ChangedFiles)
+}
@@ -0,0 +1,357 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// JobStatusMode says whether the rules for a workflow require the check runs
+// of its jobs to pass, rather than just the workflow. A workflow can succeed
+// even though some of its jobs failed, for example if they have
+// `continue-on-error` set, or if a summary job with `if: always()` hides the
+// failure.
+type JobStatusMode string
+
+const (
+	// JobStatusesOff only requires the workflow's result.
+	JobStatusesOff JobStatusMode = "off"
+	// JobStatusesAlongside requires the workflow's result and the statuses of
+	// its jobs.
+	JobStatusesAlongside JobStatusMode = "alongside"
+	// JobStatusesInstead only requires the statuses of the workflow's jobs.
+	JobStatusesInstead JobStatusMode = "instead"
+)
+
+// enabled checks if the job statuses are required at all.
+func (m JobStatusMode) enabled() bool {
+	return m == JobStatusesAlongside || m == JobStatusesInstead
+}
+
+// matrixValue converts a value decoded from YAML into the types expressions
+// use: numbers are always float64.
+func matrixValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = matrixValue(item)
+		}
+		return values
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			values[key] = matrixValue(item)
+		}
+		return values
+	}
+
+	return value
+}
+
+// get returns the value of a key in the combination.
+func (mc matrixCombination) get(key string) (interface{}, bool) {
+	for _, entry := range mc {
+		if entry.Key == key {
+			return entry.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// matches checks if the combination has all the values of another, partial,
+// one, like an entry of the `exclude` list.
+func (mc matrixCombination) matches(other matrixCombination) bool {
+	for _, entry := range other {
+		value, ok := mc.get(entry.Key)
+		if !ok || !reflect.DeepEqual(value, matrixValue(entry.Value)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// extend returns the combination with the values of another one added, or
+// replacing the values it already has.
+func (mc matrixCombination) extend(other matrixCombination) matrixCombination {
+	extended := slices.Clone(mc)
+	for _, entry := range other {
+		entry.Value = matrixValue(entry.Value)
+
+		i := slices.IndexFunc(extended, func(e matrixEntry) bool { return e.Key == entry.Key })
+		if i < 0 {
+			extended = append(extended, entry)
+			continue
+		}
+		extended[i] = entry
+	}
+
+	return extended
+}
+
+// combinations expands the matrix into the combinations of values GitHub runs
+// the job with, in the order it runs them. Like GitHub, it takes every
+// combination of the dimensions' values, leaves out those which match an
+// entry of `exclude`, and then adds the entries of `include`: each one is
+// added to every combination whose original values it doesn't change, or
+// becomes a combination of its own if there aren't any. It fails if the matrix
+// is only known when the workflow runs.
+func (m *jobMatrix) combinations() ([]matrixCombination, error) {
+	if m.Expression != "" {
+		return nil, fmt.Errorf("the matrix is only known when the workflow runs: %s", m.Expression)
+	}
+
+	var combinations []matrixCombination
+	if len(m.Dimensions) > 0 {
+		combinations = []matrixCombination{nil}
+	}
+
+	for _, dimension := range m.Dimensions {
+		if dimension.Expression != "" {
+			return nil, fmt.Errorf("the values of `%s` are only known when the workflow runs: %s", dimension.Key, dimension.Expression)
+		}
+
+		var next []matrixCombination
+		for _, combination := range combinations {
+			for _, value := range dimension.Values {
+				next = append(next, append(slices.Clip(combination), matrixEntry{Key: dimension.Key, Value: matrixValue(value)}))
+			}
+		}
+		combinations = next
+	}
+
+	combinations = slices.DeleteFunc(combinations, func(combination matrixCombination) bool {
+		return slices.ContainsFunc(m.Exclude, combination.matches)
+	})
+
+	original := len(combinations)
+	for _, include := range m.Include {
+		added := false
+		for i, combination := range combinations[:original] {
+			if !m.keepsOriginalValues(combination, include) {
+				continue
+			}
+
+			combinations[i] = combination.extend(include)
+			added = true
+		}
+
+		if !added {
+			combinations = append(combinations, matrixCombination(nil).extend(include))
+		}
+	}
+
+	return combinations, nil
+}
+
+// keepsOriginalValues checks if an entry of `include` can be added to a
+// combination without changing any of the values it got from the matrix's
+// dimensions. Values added by earlier entries of `include` can change.
+func (m *jobMatrix) keepsOriginalValues(combination, include matrixCombination) bool {
+	for _, entry := range include {
+		if !slices.ContainsFunc(m.Dimensions, func(d matrixDimension) bool { return d.Key == entry.Key }) {
+			continue
+		}
+
+		if value, _ := combination.get(entry.Key); !reflect.DeepEqual(value, matrixValue(entry.Value)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// suffix returns what GitHub adds to the name of a matrix job, like
+// ` (ubuntu-latest, 22)`.
+func (mc matrixCombination) suffix() (string, error) {
+	values := make([]string, len(mc))
+	for i, entry := range mc {
+		if !isExprPrimitive(entry.Value) {
+			return "", fmt.Errorf("the value of `%s` isn't a string, number or boolean", entry.Key)
+		}
+		values[i] = exprToString(entry.Value)
+	}
+
+	return " (" + strings.Join(values, ", ") + ")", nil
+}
+
+// values returns the combination as the `matrix` context.
+func (mc matrixCombination) values() map[string]interface{} {
+	values := make(map[string]interface{}, len(mc))
+	for _, entry := range mc {
+		values[entry.Key] = entry.Value
+	}
+
+	return values
+}
+
+// referencesContext checks if an expression refers to a context, like
+// `matrix`.
+func referencesContext(node exprNode, name string) bool {
+	switch n := node.(type) {
+	case exprContextRef:
+		return strings.EqualFold(n.Name, name)
+	case exprProperty:
+		return referencesContext(n.Target, name)
+	case exprIndex:
+		return referencesContext(n.Target, name) || referencesContext(n.Index, name)
+	case exprFilter:
+		return referencesContext(n.Target, name)
+	case exprNot:
+		return referencesContext(n.Operand, name)
+	case exprBinary:
+		return referencesContext(n.Left, name) || referencesContext(n.Right, name)
+	case exprCall:
+		return slices.ContainsFunc(n.Args, func(arg exprNode) bool { return referencesContext(arg, name) })
+	}
+
+	return false
+}
+
+// renderTemplate replaces the `${{ }}` expressions in a string, like a job's
+// name, with their values. It also returns whether any of them refer to the
+// `matrix` context. It fails if any of the values aren't known.
+func (ctx exprContext) renderTemplate(template string) (string, bool, error) {
+	var sb strings.Builder
+	usesMatrix := false
+
+	rest := template
+	for {
+		start := strings.Index(rest, "${{")
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			break
+		}
+		end += start
+
+		node, err := parseExpression(strings.TrimSpace(rest[start+3 : end]))
+		if err != nil {
+			return "", false, err
+		}
+
+		value, err := ctx.evaluate(node)
+		if err != nil {
+			return "", false, err
+		}
+
+		if !value.Known {
+			return "", false, fmt.Errorf("`%s` %s", template, value.describe())
+		}
+
+		usesMatrix = usesMatrix || referencesContext(node, "matrix")
+		sb.WriteString(rest[:start])
+		sb.WriteString(exprToString(value.Value))
+		rest = rest[end+2:]
+	}
+
+	sb.WriteString(rest)
+	return sb.String(), usesMatrix, nil
+}
+
+// checkRunNames works out the names of the check runs GitHub creates for a job:
+// one for each combination of its matrix, named after the job's `name` (or
+// its ID), with the combination's values added unless the name uses them
+// already. A job which calls a reusable workflow gets the check runs of the
+// called workflow's jobs instead, named like `caller / callee`. inputs are the
+// inputs of the workflow the job is in, if it was called by another one. It
+// fails if any of the names are only known when the workflow runs.
+func (job gitHubWorkflowJob) checkRunNames(id string, inputs map[string]interface{}) ([]string, error) {
+	combinations := []matrixCombination{nil}
+	if job.Strategy != nil && job.Strategy.Matrix != nil {
+		var err error
+		if combinations, err = job.Strategy.Matrix.combinations(); err != nil {
+			return nil, err
+		}
+	}
+
+	if job.Uses != "" && job.callee == nil {
+		return nil, fmt.Errorf("it calls `%s`, which isn't a reusable workflow in this repository", job.Uses)
+	}
+
+	template := job.Name
+	if template == "" {
+		template = id
+	}
+
+	var names []string
+	for _, combination := range combinations {
+		values := map[string]interface{}{"matrix": combination.values()}
+		if inputs != nil {
+			values["inputs"] = inputs
+		}
+		ctx := exprContext{Values: values}
+
+		name, usesMatrix, err := ctx.renderTemplate(template)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(combination) > 0 && !usesMatrix {
+			suffix, err := combination.suffix()
+			if err != nil {
+				return nil, err
+			}
+			name += suffix
+		}
+
+		if job.callee == nil {
+			names = append(names, name)
+			continue
+		}
+
+		calleeInputs := make(map[string]interface{}, len(job.With))
+		for key, value := range job.With {
+			if calleeInputs[key], _, err = ctx.renderTemplate(value); err != nil {
+				return nil, err
+			}
+		}
+
+		calleeNames, err := job.callee.Workflow.checkRunNames(calleeInputs)
+		if err != nil {
+			return nil, fmt.Errorf("in %s: %w", job.callee.Path, err)
+		}
+
+		for _, calleeID := range sortedJobIDs(job.callee.Workflow) {
+			for _, calleeName := range calleeNames[calleeID] {
+				names = append(names, name+" / "+calleeName)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// sortedJobIDs returns the IDs of a workflow's jobs in order.
+func sortedJobIDs(wf GitHubWorkflow) []string {
+	ids := make([]string, 0, len(wf.Jobs))
+	for id := range wf.Jobs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids
+}
+
+// checkRunNames works out the names of the check runs each of the workflow's
+// jobs creates, keyed by job ID.
+func (wf GitHubWorkflow) checkRunNames(inputs map[string]interface{}) (map[string][]string, error) {
+	names := make(map[string][]string, len(wf.Jobs))
+	for _, id := range sortedJobIDs(wf) {
+		jobNames, err := wf.Jobs[id].checkRunNames(id, inputs)
+		if err != nil {
+			return nil, errCheckRunNames{Job: id, Err: err}
+		}
+		names[id] = jobNames
+	}
+
+	return names, nil
+}
@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yamlContent string
+		expected    []matrixCombination
+		expectedErr string
+	}{
+		{
+			name: "dimensions",
+			yamlContent: `
+os: [ubuntu, windows]
+node: [20, 22]
+`,
+			expected: []matrixCombination{
+				{{Key: "os", Value: "ubuntu"}, {Key: "node", Value: 20.0}},
+				{{Key: "os", Value: "ubuntu"}, {Key: "node", Value: 22.0}},
+				{{Key: "os", Value: "windows"}, {Key: "node", Value: 20.0}},
+				{{Key: "os", Value: "windows"}, {Key: "node", Value: 22.0}},
+			},
+		},
+		{
+			name: "exclude",
+			yamlContent: `
+os: [ubuntu, windows]
+node: [20, 22]
+exclude:
+  - os: windows
+    node: 20
+`,
+			expected: []matrixCombination{
+				{{Key: "os", Value: "ubuntu"}, {Key: "node", Value: 20.0}},
+				{{Key: "os", Value: "ubuntu"}, {Key: "node", Value: 22.0}},
+				{{Key: "os", Value: "windows"}, {Key: "node", Value: 22.0}},
+			},
+		},
+		{
+			name: "include",
+			yamlContent: `
+fruit: [apple, pear]
+animal: [cat, dog]
+include:
+  - color: green
+  - color: pink
+    animal: cat
+  - fruit: apple
+    shape: circle
+  - fruit: banana
+  - fruit: banana
+    animal: cat
+`,
+			expected: []matrixCombination{
+				{{Key: "fruit", Value: "apple"}, {Key: "animal", Value: "cat"}, {Key: "color", Value: "pink"}, {Key: "shape", Value: "circle"}},
+				{{Key: "fruit", Value: "apple"}, {Key: "animal", Value: "dog"}, {Key: "color", Value: "green"}, {Key: "shape", Value: "circle"}},
+				{{Key: "fruit", Value: "pear"}, {Key: "animal", Value: "cat"}, {Key: "color", Value: "pink"}},
+				{{Key: "fruit", Value: "pear"}, {Key: "animal", Value: "dog"}, {Key: "color", Value: "green"}},
+				{{Key: "fruit", Value: "banana"}},
+				{{Key: "fruit", Value: "banana"}, {Key: "animal", Value: "cat"}},
+			},
+		},
+		{
+			name: "only include",
+			yamlContent: `
+include:
+  - site: production
+  - site: staging
+`,
+			expected: []matrixCombination{
+				{{Key: "site", Value: "production"}},
+				{{Key: "site", Value: "staging"}},
+			},
+		},
+		{
+			name:        "expression",
+			yamlContent: `${{ fromJSON(needs.setup.outputs.matrix) }}`,
+			expectedErr: "the matrix is only known when the workflow runs: ${{ fromJSON(needs.setup.outputs.matrix) }}",
+		},
+		{
+			name: "dimension expression",
+			yamlContent: `
+os: ${{ fromJSON(needs.setup.outputs.os) }}
+`,
+			expectedErr: "the values of `os` are only known when the workflow runs: ${{ fromJSON(needs.setup.outputs.os) }}",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var matrix jobMatrix
+			require.NoError(t, yaml.Unmarshal([]byte(tc.yamlContent), &matrix))
+
+			combinations, err := matrix.combinations()
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, combinations)
+		})
+	}
+}
+
+func TestCheckRunNames(t *testing.T) {
+	const callee = `
+on: workflow_call
+jobs:
+  build:
+    name: Build ${{ inputs.target }}
+  test:
+    strategy:
+      matrix:
+        shard: [1, 2]
+`
+
+	testCases := []struct {
+		name        string
+		yamlContent string
+		expected    map[string][]string
+		expectedErr string
+	}{
+		{
+			name: "job IDs and names",
+			yamlContent: `
+on: pull_request
+jobs:
+  lint: {}
+  test:
+    name: Unit tests
+`,
+			expected: map[string][]string{
+				"lint": {"lint"},
+				"test": {"Unit tests"},
+			},
+		},
+		{
+			name: "matrix",
+			yamlContent: `
+on: pull_request
+jobs:
+  test:
+    strategy:
+      matrix:
+        os: [ubuntu, windows]
+        node: [20]
+        include:
+          - os: ubuntu
+            experimental: true
+`,
+			expected: map[string][]string{
+				"test": {"test (ubuntu, 20, true)", "test (windows, 20)"},
+			},
+		},
+		{
+			name: "matrix in the name",
+			yamlContent: `
+on: pull_request
+jobs:
+  test:
+    name: Test on ${{ matrix.os }}
+    strategy:
+      matrix:
+        os: [ubuntu, windows]
+        node: [20]
+`,
+			expected: map[string][]string{
+				"test": {"Test on ubuntu", "Test on windows"},
+			},
+		},
+		{
+			name: "excluded entirely",
+			yamlContent: `
+on: pull_request
+jobs:
+  test:
+    strategy:
+      matrix:
+        os: [ubuntu]
+        exclude:
+          - os: ubuntu
+`,
+			expected: map[string][]string{
+				"test": nil,
+			},
+		},
+		{
+			name: "reusable workflow",
+			yamlContent: `
+on: pull_request
+jobs:
+  ci:
+    uses: ./.github/workflows/callee.yml
+    strategy:
+      matrix:
+        target: [linux, darwin]
+    with:
+      target: ${{ matrix.target }}
+`,
+			expected: map[string][]string{
+				"ci": {
+					"ci (linux) / Build linux",
+					"ci (linux) / test (1)",
+					"ci (linux) / test (2)",
+					"ci (darwin) / Build darwin",
+					"ci (darwin) / test (1)",
+					"ci (darwin) / test (2)",
+				},
+			},
+		},
+		{
+			name: "input which isn't given",
+			yamlContent: `
+on: pull_request
+jobs:
+  ci:
+    name: CI
+    uses: ./.github/workflows/callee.yml
+`,
+			expectedErr: "can't work out the check runs of job `ci`: in .github/workflows/callee.yml: can't work out the check runs of job `build`: `Build ${{ inputs.target }}` depends on inputs.target",
+		},
+		{
+			name: "remote reusable workflow",
+			yamlContent: `
+on: pull_request
+jobs:
+  ci:
+    uses: grafana/shared-workflows/.github/workflows/ci.yml@main
+`,
+			expectedErr: "can't work out the check runs of job `ci`: it calls `grafana/shared-workflows/.github/workflows/ci.yml@main`, which isn't a reusable workflow in this repository",
+		},
+		{
+			name: "name from the event",
+			yamlContent: `
+on: pull_request
+jobs:
+  test:
+    name: Test ${{ github.head_ref }}
+`,
+			expectedErr: "can't work out the check runs of job `test`: `Test ${{ github.head_ref }}` depends on github.head_ref",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var wf, calleeWf GitHubWorkflow
+			require.NoError(t, yaml.Unmarshal([]byte(tc.yamlContent), &wf))
+			require.NoError(t, yaml.Unmarshal([]byte(callee), &calleeWf))
+
+			workflows := GitHubWorkflowCollection{
+				".github/workflows/caller.yml": wf,
+				".github/workflows/callee.yml": calleeWf,
+			}.ResolveReusableWorkflows()
+
+			names, err := workflows[".github/workflows/caller.yml"].checkRunNames(nil)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, names)
+		})
+	}
+}
@@ -0,0 +1,531 @@
+package internal
+
+import (
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The properties of the event context which job conditions check, and which
+// policy-bot has predicates for. We compare them case-insensitively, like
+// GitHub does.
+var (
+	baseRefPaths = []string{"github.base_ref", "github.event.pull_request.base.ref"}
+	headRefPaths = []string{"github.head_ref", "github.event.pull_request.head.ref"}
+	// authorPaths are the properties which hold the pull request's author.
+	// `github.actor` isn't one of them: it is whoever triggered the run, who
+	// is whoever pushed for `synchronize` events. Treating it as the author
+	// would exempt pull requests from a job which did run.
+	authorPaths = []string{"github.event.pull_request.user.login"}
+	labelsPath  = "github.event.pull_request.labels.*.name"
+	draftPath   = "github.event.pull_request.draft"
+)
+
+// conditionPredicates are the facts about a pull request which a condition
+// checks, in terms policy-bot can check too. Branches are lists of regular
+// expressions, any of which can match. Labels must all be present, and the
+// author must be one of the authors. Paths are globs, one of which a changed
+// file must match.
+type conditionPredicates struct {
+	BaseBranches []string
+	HeadBranches []string
+	Authors      []string
+	Labels       []string
+	Paths        []string
+	// Draft is set if the condition checks that the pull request is a draft.
+	// It can't be combined with anything else.
+	Draft bool
+}
+
+// isEmpty checks if the predicates don't check anything.
+func (p conditionPredicates) isEmpty() bool {
+	return len(p.BaseBranches) == 0 && len(p.HeadBranches) == 0 &&
+		len(p.Authors) == 0 && len(p.Labels) == 0 && len(p.Paths) == 0 && !p.Draft
+}
+
+// gateExclusion is a negated term of a job's condition: if the pull request
+// matches the predicates, the job doesn't run. Condition describes when that
+// is, like `github.event.pull_request.user.login == 'renovate[bot]'`.
+type gateExclusion struct {
+	Condition  string
+	Predicates conditionPredicates
+}
+
+// jobGate describes the pull requests a job runs for: those which match all of
+// the predicates, and none of the exclusions.
+type jobGate struct {
+	conditionPredicates
+	Exclusions  []gateExclusion
+	SkipsDrafts bool
+}
+
+// isEmpty checks if the gate lets every pull request through.
+func (g jobGate) isEmpty() bool {
+	return g.conditionPredicates.isEmpty() && len(g.Exclusions) == 0 && !g.SkipsDrafts
+}
+
+// and narrows the gate to the pull requests which also pass another one. It
+// returns false if no pull request can pass both. If both gates check the same
+// branch, or the changed files, we can't express both checks in a single
+// predicate, so the gate keeps its own: it lets through more pull requests than the job
+// runs for, which is safe, since skipped runs are accepted.
+func (g jobGate) and(other jobGate) (jobGate, bool) {
+	g.Labels = sortedUnion(g.Labels, other.Labels)
+	g.Exclusions = append(slices.Clip(g.Exclusions), other.Exclusions...)
+	g.SkipsDrafts = g.SkipsDrafts || other.SkipsDrafts
+
+	if len(g.BaseBranches) == 0 {
+		g.BaseBranches = other.BaseBranches
+	}
+	if len(g.HeadBranches) == 0 {
+		g.HeadBranches = other.HeadBranches
+	}
+	if len(g.Paths) == 0 {
+		g.Paths = other.Paths
+	}
+
+	switch {
+	case len(g.Authors) == 0:
+		g.Authors = other.Authors
+	case len(other.Authors) > 0:
+		g.Authors = slices.DeleteFunc(slices.Clone(g.Authors), func(author string) bool {
+			return !slices.ContainsFunc(other.Authors, func(a string) bool { return strings.EqualFold(a, author) })
+		})
+		if len(g.Authors) == 0 {
+			return jobGate{}, false
+		}
+	}
+
+	return g, true
+}
+
+// sortedUnion returns the sorted, deduplicated union of two lists.
+func sortedUnion(a, b []string) []string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	union := append(slices.Clone(a), b...)
+	slices.Sort(union)
+	return slices.Compact(union)
+}
+
+// unmappedTerm is a term of a job's condition which we couldn't turn into a
+// policy-bot predicate, and why. Pos is the position of the job.
+type unmappedTerm struct {
+	Job    string
+	Term   string
+	Reason string
+	Pos    Position
+}
+
+// conditionContext is what we know about a pull request run when working out
+// which jobs run: which event triggered it, and that earlier jobs succeeded.
+func conditionContext(event string) exprContext {
+	return exprContext{
+		Values: map[string]interface{}{
+			"github": map[string]interface{}{"event_name": event},
+		},
+		Status: map[string]bool{"success": true, "failure": false, "cancelled": false},
+	}
+}
+
+// conjunctionTerms splits an expression into its `&&`-separated terms, all of
+// which must be true for it to be true.
+func conjunctionTerms(node exprNode) []exprNode {
+	if n, ok := node.(exprBinary); ok && n.Op == "&&" {
+		return append(conjunctionTerms(n.Left), conjunctionTerms(n.Right)...)
+	}
+
+	return []exprNode{node}
+}
+
+// simplify drops the parts of `&&` and `||` operators which don't affect the
+// result, because the other side is known to be true or false respectively.
+// For example, `github.event_name == 'push' || github.base_ref == 'main'` is
+// just `github.base_ref == 'main'` on a pull request.
+func (ctx exprContext) simplify(node exprNode) exprNode {
+	switch n := node.(type) {
+	case exprNot:
+		return exprNot{Operand: ctx.simplify(n.Operand)}
+	case exprBinary:
+		if n.Op != "&&" && n.Op != "||" {
+			return n
+		}
+
+		left, right := ctx.simplify(n.Left), ctx.simplify(n.Right)
+
+		// The side which doesn't decide the result on its own: false for
+		// `||`, true for `&&`.
+		neutral := n.Op == "&&"
+		if value, err := ctx.evaluate(left); err == nil && value.Known && exprTruthy(value.Value) == neutral {
+			return right
+		}
+		if value, err := ctx.evaluate(right); err == nil && value.Known && exprTruthy(value.Value) == neutral {
+			return left
+		}
+
+		return exprBinary{Op: n.Op, Left: left, Right: right}
+	}
+
+	return node
+}
+
+// ownGate works out the gate of a job's own condition, when the workflow is
+// triggered by the event. It returns false if the job never runs for the
+// event, and the terms of the condition which we couldn't map onto predicates.
+// Those are left out of the gate, so it lets through more pull requests than
+// the job runs for.
+func (wf GitHubWorkflow) ownGate(id, event string) (jobGate, bool, []unmappedTerm) {
+	var gate jobGate
+	var unmapped []unmappedTerm
+
+	node, err := parseCondition(wf.Jobs[id].If)
+	if err != nil {
+		return gate, true, []unmappedTerm{{Job: id, Term: wf.Jobs[id].If, Reason: err.Error(), Pos: wf.Jobs[id].Pos}}
+	}
+
+	ctx := conditionContext(event)
+	outputs := wf.pathsFilterOutputs()
+	for _, term := range conjunctionTerms(ctx.simplify(node)) {
+		value, err := ctx.evaluate(term)
+		if err != nil {
+			unmapped = append(unmapped, unmappedTerm{Job: id, Term: term.String(), Reason: err.Error(), Pos: wf.Jobs[id].Pos})
+			continue
+		}
+
+		if value.Known {
+			if !exprTruthy(value.Value) {
+				return jobGate{}, false, nil
+			}
+			continue
+		}
+
+		predicates, condition, negated, ok := mapConditionTerm(term, outputs)
+		switch {
+		case !ok:
+			unmapped = append(unmapped, unmappedTerm{Job: id, Term: term.String(), Reason: value.describe(), Pos: wf.Jobs[id].Pos})
+		case predicates.Draft && negated:
+			gate.SkipsDrafts = true
+		case predicates.Draft:
+			unmapped = append(unmapped, unmappedTerm{Job: id, Term: term.String(), Reason: "only runs on drafts", Pos: wf.Jobs[id].Pos})
+		case negated:
+			gate.Exclusions = append(gate.Exclusions, gateExclusion{Condition: condition.String(), Predicates: predicates})
+		default:
+			if gate, ok = gate.and(jobGate{conditionPredicates: predicates}); !ok {
+				return jobGate{}, false, nil
+			}
+		}
+	}
+
+	return gate, true, unmapped
+}
+
+// jobGate works out which pull requests a job runs for, when the workflow is
+// triggered by the event. A job is also gated by the jobs it `needs`, since by
+// default it is skipped if they are. It returns false if the job never runs.
+func (wf GitHubWorkflow) jobGate(id, event string, visited map[string]bool) (jobGate, bool) {
+	job, ok := wf.Jobs[id]
+	if !ok || visited[id] {
+		return jobGate{}, true
+	}
+	visited[id] = true
+
+	gate, runs, _ := wf.ownGate(id, event)
+	if !runs {
+		return jobGate{}, false
+	}
+
+	if job.dependsOnNeeds() {
+		for _, need := range job.Needs {
+			needGate, runs := wf.jobGate(need, event, visited)
+			if !runs {
+				return jobGate{}, false
+			}
+
+			if gate, runs = gate.and(needGate); !runs {
+				return jobGate{}, false
+			}
+		}
+	}
+
+	return gate, true
+}
+
+// jobGates returns the gates of the workflow's jobs when it is triggered by the
+// event: if the pull request passes one of them, at least one of the jobs
+// runs. It returns nil if any job runs for every pull request, in which case
+// the workflow isn't gated at all. It also returns the terms of the jobs'
+// conditions which we couldn't map onto predicates.
+func (wf GitHubWorkflow) jobGates(event string) ([]jobGate, []unmappedTerm) {
+	ids := sortedJobIDs(wf)
+
+	var unmapped []unmappedTerm
+	for _, id := range ids {
+		_, _, terms := wf.ownGate(id, event)
+		unmapped = append(unmapped, terms...)
+	}
+
+	var gates []jobGate
+	for _, id := range ids {
+		// The paths-filter job always runs, but it's only there to decide
+		// which of the other jobs do.
+		if wf.Jobs[id].onlyFiltersPaths() {
+			continue
+		}
+
+		gate, runs := wf.jobGate(id, event, map[string]bool{})
+		if !runs {
+			continue
+		}
+
+		if gate.isEmpty() {
+			return nil, unmapped
+		}
+
+		if !slices.ContainsFunc(gates, func(g jobGate) bool { return equalGates(g, gate) }) {
+			gates = append(gates, gate)
+		}
+	}
+
+	return gates, unmapped
+}
+
+// equalGates checks if two gates let through the same pull requests.
+func equalGates(a, b jobGate) bool {
+	return slices.Equal(a.BaseBranches, b.BaseBranches) &&
+		slices.Equal(a.HeadBranches, b.HeadBranches) &&
+		slices.Equal(a.Authors, b.Authors) &&
+		slices.Equal(a.Labels, b.Labels) &&
+		slices.Equal(a.Paths, b.Paths) &&
+		a.Draft == b.Draft &&
+		a.SkipsDrafts == b.SkipsDrafts &&
+		slices.EqualFunc(a.Exclusions, b.Exclusions, func(x, y gateExclusion) bool {
+			return x.Condition == y.Condition
+		})
+}
+
+// contextPath returns the context property an expression refers to, like
+// `github.base_ref`, in lower case. It returns false if the expression isn't a
+// plain property reference.
+func contextPath(node exprNode) (string, bool) {
+	switch n := node.(type) {
+	case exprContextRef:
+		return strings.ToLower(n.Name), true
+	case exprProperty:
+		target, ok := contextPath(n.Target)
+		return target + "." + strings.ToLower(n.Name), ok
+	case exprFilter:
+		target, ok := contextPath(n.Target)
+		return target + ".*", ok
+	}
+
+	return "", false
+}
+
+// stringLiteral returns the value of a string literal.
+func stringLiteral(node exprNode) (string, bool) {
+	if n, ok := node.(exprLiteral); ok {
+		s, ok := n.Value.(string)
+		return s, ok
+	}
+
+	return "", false
+}
+
+// pathAndString returns the context property and string literal which are
+// compared by a binary operator or passed to a function, in either order.
+func pathAndString(a, b exprNode) (string, string, bool) {
+	if path, ok := contextPath(a); ok {
+		s, ok := stringLiteral(b)
+		return path, s, ok
+	}
+
+	if path, ok := contextPath(b); ok {
+		s, ok := stringLiteral(a)
+		return path, s, ok
+	}
+
+	return "", "", false
+}
+
+// pathsFilterCondition returns the form of a comparison of a paths-filter
+// output with `false` which checks that the filter matched, like
+// `needs.changes.outputs.backend == 'true'`.
+func pathsFilterCondition(n exprBinary) exprNode {
+	output := n.Left
+	if _, ok := contextPath(output); !ok {
+		output = n.Right
+	}
+
+	return exprBinary{Op: "==", Left: output, Right: exprLiteral{Value: "true"}}
+}
+
+// draftComparison checks if a binary operator compares whether the pull
+// request is a draft with a boolean literal, in either order, and returns the
+// literal.
+func draftComparison(a, b exprNode) (bool, bool) {
+	if path, _ := contextPath(b); path == draftPath {
+		a, b = b, a
+	}
+
+	if path, _ := contextPath(a); path != draftPath {
+		return false, false
+	}
+
+	literal, ok := b.(exprLiteral)
+	if !ok {
+		return false, false
+	}
+
+	value, ok := literal.Value.(bool)
+	return value, ok
+}
+
+// branchPredicates maps a check on a branch property onto predicates. pattern
+// is a regular expression matching the branches which pass the check.
+func branchPredicates(path, pattern string) (conditionPredicates, bool) {
+	switch {
+	case slices.Contains(baseRefPaths, path):
+		return conditionPredicates{BaseBranches: []string{pattern}}, true
+	case slices.Contains(headRefPaths, path):
+		return conditionPredicates{HeadBranches: []string{pattern}}, true
+	}
+
+	return conditionPredicates{}, false
+}
+
+// mapConditionTerm maps a term of a job's condition onto predicates about the
+// pull request. If the term is negated, like
+// `github.event.pull_request.user.login != 'renovate[bot]'`, the predicates
+// describe the pull requests which fail it, and condition is the un-negated
+// form, like `github.event.pull_request.user.login == 'renovate[bot]'`. outputs are the
+// job outputs which come from paths-filter steps (see pathsFilterOutputs). It
+// returns false if the term can't be mapped.
+func mapConditionTerm(term exprNode, outputs map[string]pathsFilterOutput) (predicates conditionPredicates, condition exprNode, negated bool, ok bool) {
+	switch n := term.(type) {
+	case exprNot:
+		predicates, condition, negated, ok = mapConditionTerm(n.Operand, outputs)
+		return predicates, condition, !negated, ok
+
+	case exprProperty:
+		if path, _ := contextPath(n); path == draftPath {
+			return conditionPredicates{Draft: true}, n, false, true
+		}
+
+	case exprBinary:
+		switch n.Op {
+		case "==", "!=":
+			negated = n.Op == "!="
+			condition = exprBinary{Op: "==", Left: n.Left, Right: n.Right}
+
+			if draft, ok := draftComparison(n.Left, n.Right); ok {
+				// The term holds for drafts if it compares with `true` using
+				// `==`, or with `false` using `!=`.
+				return conditionPredicates{Draft: true}, n, draft == negated, true
+			}
+
+			path, value, ok := pathAndString(n.Left, n.Right)
+			if !ok {
+				break
+			}
+
+			if output, ok := outputs[path]; ok && output.Globs != nil {
+				// paths-filter outputs are the strings `true` or `false`.
+				switch strings.ToLower(value) {
+				case "true":
+					return conditionPredicates{Paths: output.Globs}, condition, negated, true
+				case "false":
+					return conditionPredicates{Paths: output.Globs}, pathsFilterCondition(n), !negated, true
+				}
+				break
+			}
+
+			if slices.Contains(authorPaths, path) {
+				return conditionPredicates{Authors: []string{value}}, condition, negated, true
+			}
+
+			predicates, ok = branchPredicates(path, "^"+regexp.QuoteMeta(value)+"$")
+			return predicates, condition, negated, ok
+
+		case "||":
+			// Only alternatives for the same branch can be combined into one
+			// predicate.
+			left, _, leftNegated, leftOK := mapConditionTerm(n.Left, outputs)
+			right, _, rightNegated, rightOK := mapConditionTerm(n.Right, outputs)
+			if !leftOK || !rightOK || leftNegated || rightNegated {
+				break
+			}
+
+			switch {
+			case len(left.BaseBranches) > 0 && len(right.BaseBranches) > 0:
+				return conditionPredicates{BaseBranches: append(slices.Clip(left.BaseBranches), right.BaseBranches...)}, n, false, true
+			case len(left.HeadBranches) > 0 && len(right.HeadBranches) > 0:
+				return conditionPredicates{HeadBranches: append(slices.Clip(left.HeadBranches), right.HeadBranches...)}, n, false, true
+			case len(left.Paths) > 0 && len(right.Paths) > 0:
+				return conditionPredicates{Paths: append(slices.Clip(left.Paths), right.Paths...)}, n, false, true
+			}
+		}
+
+	case exprCall:
+		if len(n.Args) != 2 {
+			break
+		}
+
+		// `contains(fromJSON(needs.changes.outputs.changes), 'backend')`
+		// checks paths-filter's list of the filters which matched.
+		if from, ok := n.Args[0].(exprCall); ok && n.Name == "contains" && from.Name == "fromjson" && len(from.Args) == 1 {
+			path, _ := contextPath(from.Args[0])
+			value, _ := stringLiteral(n.Args[1])
+			if globs, ok := outputs[path].Changes.get(value); ok && globs != nil {
+				return conditionPredicates{Paths: globs}, n, false, true
+			}
+			break
+		}
+
+		path, ok := contextPath(n.Args[0])
+		if !ok {
+			break
+		}
+
+		value, ok := stringLiteral(n.Args[1])
+		if !ok {
+			break
+		}
+
+		quoted := regexp.QuoteMeta(value)
+
+		switch n.Name {
+		case "contains":
+			if path == labelsPath {
+				return conditionPredicates{Labels: []string{value}}, n, false, true
+			}
+			predicates, ok = branchPredicates(path, quoted)
+			return predicates, n, false, ok
+		case "startswith":
+			predicates, ok = branchPredicates(path, "^"+quoted)
+			return predicates, n, false, ok
+		case "endswith":
+			predicates, ok = branchPredicates(path, quoted+"$")
+			return predicates, n, false, ok
+		}
+	}
+
+	return conditionPredicates{}, nil, false, false
+}
+
+// warnUnmappedTerms reports the terms of a workflow's job conditions which we
+// couldn't turn into predicates. The workflow is required whether or not they
+// hold, and a skipped run is accepted if they don't.
+func warnUnmappedTerms(path string, terms []unmappedTerm) {
+	for _, term := range terms {
+		slog.Warn(
+			"can't express job condition as a policy-bot predicate, requiring the workflow whether or not it holds",
+			"path", Location{Path: path, Pos: term.Pos},
+			"job", term.Job,
+			"condition", term.Term,
+			"reason", term.Reason,
+		)
+	}
+}
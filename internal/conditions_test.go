@@ -0,0 +1,408 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMapConditionTerm(t *testing.T) {
+	testCases := []struct {
+		name       string
+		term       string
+		predicates conditionPredicates
+		condition  string
+		negated    bool
+		ok         bool
+	}{
+		{
+			name:       "label",
+			term:       "contains(github.event.pull_request.labels.*.name, 'run-e2e')",
+			predicates: conditionPredicates{Labels: []string{"run-e2e"}},
+			condition:  "contains(github.event.pull_request.labels.*.name, 'run-e2e')",
+			ok:         true,
+		},
+		{
+			name:       "negated label",
+			term:       "!contains(github.event.pull_request.labels.*.name, 'skip-e2e')",
+			predicates: conditionPredicates{Labels: []string{"skip-e2e"}},
+			condition:  "contains(github.event.pull_request.labels.*.name, 'skip-e2e')",
+			negated:    true,
+			ok:         true,
+		},
+		{
+			name:       "base branch",
+			term:       "github.base_ref == 'main'",
+			predicates: conditionPredicates{BaseBranches: []string{"^main$"}},
+			condition:  "github.base_ref == 'main'",
+			ok:         true,
+		},
+		{
+			name:       "base branch on the right",
+			term:       "'release/1.0' == github.event.pull_request.base.ref",
+			predicates: conditionPredicates{BaseBranches: []string{`^release/1\.0$`}},
+			condition:  "'release/1.0' == github.event.pull_request.base.ref",
+			ok:         true,
+		},
+		{
+			name:       "base branch prefix",
+			term:       "startsWith(github.base_ref, 'release/')",
+			predicates: conditionPredicates{BaseBranches: []string{"^release/"}},
+			condition:  "startswith(github.base_ref, 'release/')",
+			ok:         true,
+		},
+		{
+			name:       "either base branch",
+			term:       "github.base_ref == 'main' || startsWith(github.base_ref, 'release/')",
+			predicates: conditionPredicates{BaseBranches: []string{"^main$", "^release/"}},
+			condition:  "github.base_ref == 'main' || startswith(github.base_ref, 'release/')",
+			ok:         true,
+		},
+		{
+			name:       "head branch suffix",
+			term:       "endsWith(github.head_ref, '-e2e')",
+			predicates: conditionPredicates{HeadBranches: []string{"-e2e$"}},
+			condition:  "endswith(github.head_ref, '-e2e')",
+			ok:         true,
+		},
+		{
+			name:       "not from a head branch",
+			term:       "!contains(github.head_ref, 'dependabot/')",
+			predicates: conditionPredicates{HeadBranches: []string{"dependabot/"}},
+			condition:  "contains(github.head_ref, 'dependabot/')",
+			negated:    true,
+			ok:         true,
+		},
+		{
+			name:       "author",
+			term:       "github.event.pull_request.user.login == 'octocat'",
+			predicates: conditionPredicates{Authors: []string{"octocat"}},
+			condition:  "github.event.pull_request.user.login == 'octocat'",
+			ok:         true,
+		},
+		{
+			name:       "not an author",
+			term:       "github.event.pull_request.user.login != 'renovate[bot]'",
+			predicates: conditionPredicates{Authors: []string{"renovate[bot]"}},
+			condition:  "github.event.pull_request.user.login == 'renovate[bot]'",
+			negated:    true,
+			ok:         true,
+		},
+		{
+			name:       "not a draft",
+			term:       "github.event.pull_request.draft == false",
+			predicates: conditionPredicates{Draft: true},
+			condition:  "github.event.pull_request.draft == false",
+			negated:    true,
+			ok:         true,
+		},
+		{
+			name:       "not a draft with true on the left",
+			term:       "true != github.event.pull_request.draft",
+			predicates: conditionPredicates{Draft: true},
+			condition:  "true != github.event.pull_request.draft",
+			negated:    true,
+			ok:         true,
+		},
+		{
+			name:       "negated draft",
+			term:       "!github.event.pull_request.draft",
+			predicates: conditionPredicates{Draft: true},
+			condition:  "github.event.pull_request.draft",
+			negated:    true,
+			ok:         true,
+		},
+		{
+			name:       "draft",
+			term:       "github.event.pull_request.draft",
+			predicates: conditionPredicates{Draft: true},
+			condition:  "github.event.pull_request.draft",
+			ok:         true,
+		},
+		{
+			name: "different properties",
+			term: "github.base_ref == 'main' || github.head_ref == 'main'",
+		},
+		{
+			// Whoever triggered the run isn't necessarily the author.
+			name: "actor",
+			term: "github.actor != 'renovate[bot]'",
+		},
+		{
+			name: "repository",
+			term: "github.repository == 'grafana/grafana'",
+		},
+		{
+			name: "compared with a property",
+			term: "github.base_ref == github.event.repository.default_branch",
+		},
+		{
+			name: "label or another condition",
+			term: "contains(github.event.pull_request.labels.*.name, 'run-e2e') || github.event_name == 'push'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := parseExpression(tc.term)
+			require.NoError(t, err)
+
+			predicates, condition, negated, ok := mapConditionTerm(node, nil)
+			require.Equal(t, tc.ok, ok)
+			if !ok {
+				return
+			}
+
+			require.Equal(t, tc.predicates, predicates)
+			require.Equal(t, tc.condition, condition.String())
+			require.Equal(t, tc.negated, negated)
+		})
+	}
+}
+
+func TestJobGates(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yamlContent string
+		expected    []jobGate
+	}{
+		{
+			name: "no jobs",
+			yamlContent: `
+on: pull_request
+`,
+			expected: nil,
+		},
+		{
+			name: "all jobs gated",
+			yamlContent: `
+on: pull_request
+jobs:
+  e2e:
+    if: contains(github.event.pull_request.labels.*.name, 'run-e2e')
+  other:
+    if: ${{ contains(github.event.pull_request.labels.*.name, 'run-e2e') }}
+`,
+			expected: []jobGate{
+				{conditionPredicates: conditionPredicates{Labels: []string{"run-e2e"}}},
+			},
+		},
+		{
+			name: "one job not gated",
+			yamlContent: `
+on: pull_request
+jobs:
+  e2e:
+    if: contains(github.event.pull_request.labels.*.name, 'run-e2e')
+  lint: {}
+`,
+			expected: nil,
+		},
+		{
+			name: "different labels",
+			yamlContent: `
+on: pull_request
+jobs:
+  e2e:
+    if: contains(github.event.pull_request.labels.*.name, 'run-e2e')
+  perf:
+    if: contains(github.event.pull_request.labels.*.name, 'run-perf')
+`,
+			expected: []jobGate{
+				{conditionPredicates: conditionPredicates{Labels: []string{"run-e2e"}}},
+				{conditionPredicates: conditionPredicates{Labels: []string{"run-perf"}}},
+			},
+		},
+		{
+			name: "several labels and another condition",
+			yamlContent: `
+on: pull_request
+jobs:
+  e2e:
+    if: contains(github.event.pull_request.labels.*.name, 'b') && github.repository == 'grafana/grafana' && contains(github.event.pull_request.labels.*.name, 'a')
+`,
+			expected: []jobGate{
+				{conditionPredicates: conditionPredicates{Labels: []string{"a", "b"}}},
+			},
+		},
+		{
+			name: "needs a gated job",
+			yamlContent: `
+on: pull_request
+jobs:
+  setup:
+    if: contains(github.event.pull_request.labels.*.name, 'run-e2e')
+  e2e:
+    needs: setup
+  report:
+    needs: [e2e]
+`,
+			expected: []jobGate{
+				{conditionPredicates: conditionPredicates{Labels: []string{"run-e2e"}}},
+			},
+		},
+		{
+			name: "needs a gated job but always runs",
+			yamlContent: `
+on: pull_request
+jobs:
+  setup:
+    if: contains(github.event.pull_request.labels.*.name, 'run-e2e')
+  report:
+    needs: setup
+    if: always()
+`,
+			expected: nil,
+		},
+		{
+			name: "all jobs skip drafts",
+			yamlContent: `
+on: pull_request
+jobs:
+  build:
+    if: github.event.pull_request.draft == false
+  test:
+    if: ${{ !github.event.pull_request.draft && github.repository == 'grafana/grafana' }}
+`,
+			expected: []jobGate{{SkipsDrafts: true}},
+		},
+		{
+			name: "needs a job which skips drafts",
+			yamlContent: `
+on: pull_request
+jobs:
+  build:
+    if: github.event.pull_request.draft != true
+  test:
+    needs: build
+`,
+			expected: []jobGate{{SkipsDrafts: true}},
+		},
+		{
+			name: "one job runs on drafts",
+			yamlContent: `
+on: pull_request
+jobs:
+  build:
+    if: github.event.pull_request.draft == false
+  lint: {}
+`,
+			expected: nil,
+		},
+		{
+			name: "draft or a push",
+			yamlContent: `
+on: pull_request
+jobs:
+  build:
+    if: github.event.pull_request.draft == false || github.event_name == 'push'
+`,
+			expected: []jobGate{{SkipsDrafts: true}},
+		},
+		{
+			name: "only runs on push",
+			yamlContent: `
+on: [pull_request, push]
+jobs:
+  deploy:
+    if: github.event_name == 'push'
+  test:
+    if: github.base_ref == 'main'
+`,
+			expected: []jobGate{
+				{conditionPredicates: conditionPredicates{BaseBranches: []string{"^main$"}}},
+			},
+		},
+		{
+			name: "branches and authors",
+			yamlContent: `
+on: pull_request
+jobs:
+  backport:
+    if: startsWith(github.base_ref, 'release-') && github.event.pull_request.user.login == 'grafana-bot'
+  release:
+    needs: backport
+    if: startsWith(github.head_ref, 'release-please--')
+`,
+			expected: []jobGate{
+				{conditionPredicates: conditionPredicates{
+					BaseBranches: []string{"^release-"},
+					Authors:      []string{"grafana-bot"},
+				}},
+				{conditionPredicates: conditionPredicates{
+					BaseBranches: []string{"^release-"},
+					HeadBranches: []string{"^release-please--"},
+					Authors:      []string{"grafana-bot"},
+				}},
+			},
+		},
+		{
+			name: "different authors",
+			yamlContent: `
+on: pull_request
+jobs:
+  a:
+    if: github.event.pull_request.user.login == 'a'
+  b:
+    needs: a
+    if: github.event.pull_request.user.login == 'b'
+`,
+			expected: []jobGate{
+				{conditionPredicates: conditionPredicates{Authors: []string{"a"}}},
+			},
+		},
+		{
+			name: "exclusions",
+			yamlContent: `
+on: pull_request
+jobs:
+  test:
+    if: github.event.pull_request.user.login != 'renovate[bot]' && !contains(github.event.pull_request.labels.*.name, 'no-ci')
+`,
+			expected: []jobGate{
+				{Exclusions: []gateExclusion{
+					{
+						Condition:  "github.event.pull_request.user.login == 'renovate[bot]'",
+						Predicates: conditionPredicates{Authors: []string{"renovate[bot]"}},
+					},
+					{
+						Condition:  "contains(github.event.pull_request.labels.*.name, 'no-ci')",
+						Predicates: conditionPredicates{Labels: []string{"no-ci"}},
+					},
+				}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var wf GitHubWorkflow
+			require.NoError(t, yaml.Unmarshal([]byte(tc.yamlContent), &wf))
+
+			gates, _ := wf.jobGates("pull_request")
+			require.Equal(t, tc.expected, gates)
+		})
+	}
+}
+
+func TestJobGatesUnmappedTerms(t *testing.T) {
+	var wf GitHubWorkflow
+	require.NoError(t, yaml.Unmarshal([]byte(`
+on: pull_request
+jobs:
+  test:
+    if: github.repository == 'grafana/grafana' && github.base_ref == 'main'
+  draft:
+    if: github.event.pull_request.draft
+  broken:
+    if: github.base_ref ==
+`), &wf))
+
+	_, unmapped := wf.jobGates("pull_request")
+	require.Equal(t, []unmappedTerm{
+		{Job: "broken", Term: "github.base_ref ==", Reason: "failed to parse expression `github.base_ref ==` at offset 18: unexpected end of expression", Pos: Position{Line: 8, Column: 3}},
+		{Job: "draft", Term: "github.event.pull_request.draft", Reason: "only runs on drafts", Pos: Position{Line: 6, Column: 3}},
+		{Job: "test", Term: "github.repository == 'grafana/grafana'", Reason: "depends on github.repository", Pos: Position{Line: 4, Column: 3}},
+	}, unmapped)
+}
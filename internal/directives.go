@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/palantir/policy-bot/policy/predicate"
+	"gopkg.in/yaml.v3"
+)
+
+// directivePattern matches a comment in a workflow file which tells us
+// something about the workflow that we can't work out from the workflow
+// itself, like `# generate-policy-bot-config: status=integration-tests`.
+var directivePattern = regexp.MustCompile(`^#\s*(?:generate-)?policy-bot-config:\s*(.*?)\s*$`)
+
+// workflowDirectives are the settings given in a workflow's directive
+// comments.
+type workflowDirectives struct {
+	// Statuses are the commit statuses or check runs which the workflow reports
+	// on the pull request's head commit.
+	Statuses []string
+	// Labels are the labels which make the workflow required. The pull request
+	// must have all of them.
+	Labels []string
+	// Ignore leaves the workflow out of the config entirely.
+	Ignore bool
+	// Always requires the workflow on every pull request, whatever its
+	// filters and its jobs' conditions say.
+	Always bool
+	// Conclusions replace the conclusions the workflow's run, or its jobs'
+	// check runs, may have. By default, they are SkippedOrSuccess, or
+	// SkippedSuccessOrCancelled if the workflow cancels superseded runs.
+	Conclusions []string
+	// Name replaces the name of the rules which require the workflow.
+	Name string
+	// ID replaces the workflow's ID, which other configs use to refer to the
+	// rules which require it (see WorkflowID).
+	ID string
+	// Predicates are added to the rules which require the workflow,
+	// replacing any generated predicate of the same kind.
+	Predicates predicate.Predicates
+}
+
+// workflowConclusions are the conclusions which a workflow run or a check run
+// can have.
+var workflowConclusions = []string{
+	"action_required", "cancelled", "failure", "neutral", "skipped", "stale", "success", "timed_out",
+}
+
+// mergePredicates sets the predicates which are set in extra on predicates,
+// replacing any which are already set.
+func mergePredicates(predicates *predicate.Predicates, extra predicate.Predicates) {
+	dst := reflect.ValueOf(predicates).Elem()
+	src := reflect.ValueOf(extra)
+
+	for i := range src.NumField() {
+		if !src.Field(i).IsZero() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// directiveComment is a directive comment in a workflow file: the text after
+// its prefix, and where it is.
+type directiveComment struct {
+	Text string
+	Pos  Position
+}
+
+// findDirectives finds the directive comments in a workflow file, in order.
+// Only the comments of the YAML document count, so a line which looks like a
+// directive inside a block scalar, like a shell comment in a `run` script,
+// isn't one. yaml.v3 doesn't record where comments are, so each one is
+// matched with the nearest line of the file which contains it.
+func findDirectives(node *yaml.Node, contents []byte) []directiveComment {
+	lines := strings.Split(string(contents), "\n")
+	used := make(map[int]bool)
+
+	// position finds the line which contains a comment attached to a node
+	// on the given line.
+	position := func(comment string, near int) Position {
+		best := -1
+		for i, line := range lines {
+			if used[i] || !strings.Contains(line, comment) {
+				continue
+			}
+			if best < 0 || abs(i+1-near) < abs(best+1-near) {
+				best = i
+			}
+		}
+
+		if best < 0 {
+			return Position{}
+		}
+
+		used[best] = true
+		return Position{Line: best + 1, Column: strings.Index(lines[best], comment) + 1}
+	}
+
+	var directives []directiveComment
+	collect := func(comments string, near int) {
+		for _, comment := range strings.Split(comments, "\n") {
+			comment = strings.TrimSpace(comment)
+			if m := directivePattern.FindStringSubmatch(comment); m != nil {
+				directives = append(directives, directiveComment{Text: m[1], Pos: position(comment, near)})
+			}
+		}
+	}
+
+	var visit func(n *yaml.Node)
+	visit = func(n *yaml.Node) {
+		collect(n.HeadComment, n.Line)
+		collect(n.LineComment, n.Line)
+		for _, child := range n.Content {
+			visit(child)
+		}
+		collect(n.FootComment, n.Line)
+	}
+	visit(node)
+
+	slices.SortStableFunc(directives, func(a, b directiveComment) int { return a.Pos.Line - b.Pos.Line })
+	return directives
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+// parseDirectives parses a workflow's directive comments. Each one sets a
+// single `key=value` pair, or a flag like `ignore`. Keys which take a list can
+// be repeated. For the others, the last one wins. A directive which isn't
+// valid is left out and returned as a problem, so that a typo in a comment
+// doesn't stop the workflow from being required.
+func parseDirectives(comments []directiveComment) (workflowDirectives, []error) {
+	var directives workflowDirectives
+	var problems []error
+
+	for _, comment := range comments {
+		invalid := errInvalidDirective{Directive: comment.Text, Pos: comment.Pos}
+
+		key, value, ok := strings.Cut(comment.Text, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch {
+		case key == "ignore" && !ok:
+			directives.Ignore = true
+			continue
+		case key == "always" && !ok:
+			directives.Always = true
+			continue
+		case !ok || value == "":
+			problems = append(problems, invalid)
+			continue
+		}
+
+		switch key {
+		case "status":
+			directives.Statuses = append(directives.Statuses, value)
+		case "label":
+			directives.Labels = append(directives.Labels, value)
+		case "conclusion":
+			if !slices.Contains(workflowConclusions, value) {
+				problems = append(problems, invalid)
+				continue
+			}
+			directives.Conclusions = append(directives.Conclusions, value)
+		case "name":
+			directives.Name = value
+		case "id":
+			if !workflowIDPattern.MatchString(value) {
+				invalid.Err = fmt.Errorf("IDs can only have letters, digits, `.`, `-` and `_`")
+				problems = append(problems, invalid)
+				continue
+			}
+			directives.ID = value
+		case "predicates":
+			var predicates predicate.Predicates
+			if err := yaml.Unmarshal([]byte(value), &predicates); err != nil {
+				invalid.Err = err
+				problems = append(problems, invalid)
+				continue
+			}
+			mergePredicates(&directives.Predicates, predicates)
+		default:
+			problems = append(problems, invalid)
+		}
+	}
+
+	return directives, problems
+}
+
+// ParseWorkflow parses the contents of a workflow file, including any directive
+// comments. It fails if GitHub would reject the workflow's triggers. Invalid
+// directives don't make it fail: they are ignored, and returned by
+// InvalidDirectives.
+func ParseWorkflow(contents []byte) (GitHubWorkflow, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(contents, &node); err != nil {
+		return GitHubWorkflow{}, err
+	}
+
+	var workflow GitHubWorkflow
+	if err := node.Decode(&workflow); err != nil {
+		return GitHubWorkflow{}, err
+	}
+
+	if err := workflow.validateTriggers(); err != nil {
+		return GitHubWorkflow{}, err
+	}
+
+	workflow.directives, workflow.invalidDirectives = parseDirectives(findDirectives(&node, contents))
+
+	return workflow, nil
+}
+
+// InvalidDirectives returns the problems with the workflow's directive
+// comments which ParseWorkflow left out.
+func (wf GitHubWorkflow) InvalidDirectives() []error {
+	return wf.invalidDirectives
+}
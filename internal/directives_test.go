@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/palantir/policy-bot/policy/common"
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseDirectives(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contents    string
+		expected    workflowDirectives
+		expectError bool
+	}{
+		{
+			name:     "no directives",
+			contents: "on: issue_comment\n# just a comment\n",
+			expected: workflowDirectives{},
+		},
+		{
+			name: "directives",
+			contents: `# generate-policy-bot-config: status=Integration tests
+# generate-policy-bot-config: label=run-integration
+
+on: issue_comment
+jobs:
+  test:
+    #   generate-policy-bot-config:   label = integration
+    runs-on: ubuntu-latest
+`,
+			expected: workflowDirectives{
+				Statuses: []string{"Integration tests"},
+				Labels:   []string{"run-integration", "integration"},
+			},
+		},
+		{
+			name: "generation",
+			contents: `# generate-policy-bot-config: always
+# generate-policy-bot-config: conclusion=success
+# generate-policy-bot-config: conclusion=neutral
+# generate-policy-bot-config: name=CI must pass
+# generate-policy-bot-config: predicates={has_labels: [ready]}
+# generate-policy-bot-config: predicates={has_author_in: {users: [octocat]}}
+on: pull_request
+`,
+			expected: workflowDirectives{
+				Always:      true,
+				Conclusions: []string{"success", "neutral"},
+				Name:        "CI must pass",
+				Predicates: predicate.Predicates{
+					HasLabels: &predicate.HasLabels{"ready"},
+					HasAuthorIn: &predicate.HasAuthorIn{
+						Actors: common.Actors{Users: []string{"octocat"}},
+					},
+				},
+			},
+		},
+		{
+			name:     "ignore",
+			contents: "# generate-policy-bot-config: ignore\non: pull_request\n",
+			expected: workflowDirectives{Ignore: true},
+		},
+		{
+			name:        "ignore with a value",
+			contents:    "# generate-policy-bot-config: ignore=true\non: pull_request\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown conclusion",
+			contents:    "# generate-policy-bot-config: conclusion=passed\non: pull_request\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid predicates",
+			contents:    "# generate-policy-bot-config: predicates=[has_labels]\non: pull_request\n",
+			expectError: true,
+		},
+		{
+			name: "comments only",
+			contents: `on: pull_request # generate-policy-bot-config: name=CI
+jobs:
+  test:
+    # policy-bot-config: label=ci
+    steps:
+      - run: |
+          # generate-policy-bot-config: ignore
+          make test
+`,
+			expected: workflowDirectives{Name: "CI", Labels: []string{"ci"}},
+		},
+		{
+			name:     "id",
+			contents: "# generate-policy-bot-config: id=build-and-test\non: pull_request\n",
+			expected: workflowDirectives{ID: "build-and-test"},
+		},
+		{
+			name:        "invalid id",
+			contents:    "# generate-policy-bot-config: id=build and test\non: pull_request\n",
+			expectError: true,
+		},
+		{
+			name:        "unknown key",
+			contents:    "# generate-policy-bot-config: colour=blue\non: pull_request\n",
+			expectError: true,
+		},
+		{
+			name:        "no value",
+			contents:    "# generate-policy-bot-config: status\non: pull_request\n",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var node yaml.Node
+			require.NoError(t, yaml.Unmarshal([]byte(tc.contents), &node))
+
+			directives, problems := parseDirectives(findDirectives(&node, []byte(tc.contents)))
+			if tc.expectError {
+				require.Len(t, problems, 1)
+				require.ErrorAs(t, problems[0], &errInvalidDirective{})
+				require.Equal(t, Position{Line: 1, Column: 1}, ErrorPosition(problems[0]))
+				return
+			}
+
+			require.Empty(t, problems)
+			require.Equal(t, tc.expected, directives)
+		})
+	}
+}
+
+func TestParseWorkflow(t *testing.T) {
+	workflow, err := ParseWorkflow([]byte(`# generate-policy-bot-config: status=integration
+on:
+  issue_comment:
+    types: [created]
+`))
+	require.NoError(t, err)
+
+	require.Equal(t, GitHubWorkflow{
+		On: githubWorkflowHeader{
+			IssueComment: &gitHubWorkflowOnIssueComment{
+				Types: []string{"created"},
+			},
+		},
+		directives: workflowDirectives{
+			Statuses: []string{"integration"},
+		},
+	}, clearPositions(workflow))
+	require.True(t, workflow.IsCommentWorkflow())
+
+	_, err = ParseWorkflow([]byte("on: [issue_comment"))
+	require.Error(t, err)
+
+	_, err = ParseWorkflow([]byte(`
+on:
+  pull_request:
+    types: [synchronise]
+`))
+	require.ErrorContains(t, err, "unknown activity types: synchronise")
+}
+
+func TestParseWorkflowInvalidDirective(t *testing.T) {
+	workflow, err := ParseWorkflow([]byte(`on: pull_request
+# generate-policy-bot-config: conclusoin=success
+# generate-policy-bot-config: name=CI
+`))
+	require.NoError(t, err)
+
+	// Only the invalid directive is left out: the workflow is still required.
+	require.Equal(t, workflowDirectives{Name: "CI"}, workflow.directives)
+	require.Len(t, workflow.InvalidDirectives(), 1)
+	require.EqualError(t, workflow.InvalidDirectives()[0], "invalid directive `conclusoin=success`. expected `ignore`, `always`, `status=<name>`, "+
+		"`label=<name>`, `conclusion=<conclusion>`, `name=<rule name>`, `id=<ID>` or `predicates=<YAML>`")
+	require.Equal(t, Position{Line: 2, Column: 1}, ErrorPosition(workflow.InvalidDirectives()[0]))
+
+	config, _, err := GitHubWorkflowCollection{".github/workflows/ci.yml": workflow}.PolicyBotConfig()
+	require.NoError(t, err)
+	require.Equal(t, "CI", config.ApprovalRules[0].Name)
+}
@@ -1,10 +1,46 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+// positioned is implemented by errors which know where in a workflow file the
+// problem is.
+type positioned interface {
+	position() Position
+}
+
+// yamlLinePattern matches the line number in the errors from the YAML
+// package, like `yaml: line 3: did not find expected key`. They don't have
+// columns.
+var yamlLinePattern = regexp.MustCompile(`\bline (\d+):`)
+
+// ErrorPosition returns the position in the workflow file of the problem an
+// error describes, if the error or any error it wraps knows it. Otherwise, the
+// position isn't valid.
+func ErrorPosition(err error) Position {
+	var p positioned
+	if errors.As(err, &p) {
+		return p.position()
+	}
+
+	if err == nil {
+		return Position{}
+	}
+
+	m := yamlLinePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return Position{}
+	}
+
+	line, _ := strconv.Atoi(m[1])
+	return Position{Line: line}
+}
+
 // ErrNoWorkflows is returned when no workflows are found in the specified directory.
 type ErrNoWorkflows struct {
 }
@@ -13,15 +49,30 @@ func (e ErrNoWorkflows) Error() string {
 	return "no workflows found in directory"
 }
 
-// errWorkflowParse is returned when a workflow file cannot be parsed.
+// errWorkflowParse is returned when a workflow file cannot be parsed. Pos is
+// the position of the part of the workflow which couldn't be parsed, if the
+// wrapped error doesn't say more precisely.
 type errWorkflowParse struct {
 	Err error
+	Pos Position
 }
 
 func (e errWorkflowParse) Error() string {
 	return fmt.Sprintf("failed to parse workflow: %v", e.Err)
 }
 
+func (e errWorkflowParse) Unwrap() error {
+	return e.Err
+}
+
+func (e errWorkflowParse) position() Position {
+	if pos := ErrorPosition(e.Err); pos.IsValid() {
+		return pos
+	}
+
+	return e.Pos
+}
+
 // ErrInvalidWorkflow is returned when a workflow file cannot be parsed or is invalid.
 // It will usually wrap an ErrWorkflowParse or ErrUnexpectedType.
 type ErrInvalidWorkflow struct {
@@ -30,7 +81,13 @@ type ErrInvalidWorkflow struct {
 }
 
 func (e ErrInvalidWorkflow) Error() string {
-	return fmt.Sprintf("invalid workflow file %s: %s", e.Path, e.Err)
+	return fmt.Sprintf("invalid workflow file %s: %s", e.Location(), e.Err)
+}
+
+// Location returns where in the workflow file the problem is, as far as we
+// know.
+func (e ErrInvalidWorkflow) Location() Location {
+	return Location{Path: e.Path, Pos: ErrorPosition(e.Err)}
 }
 
 func (e ErrInvalidWorkflow) Unwrap() error {
@@ -40,12 +97,47 @@ func (e ErrInvalidWorkflow) Unwrap() error {
 // errUnexpectedType is returned when an unexpected type is encountered during YAML unmarshaling.
 type errUnexpectedType struct {
 	Type string
+	Pos  Position
 }
 
 func (e errUnexpectedType) Error() string {
 	return fmt.Sprintf("unexpected type for workflow `on`. got: %s. expected: string, list or map", e.Type)
 }
 
+func (e errUnexpectedType) position() Position {
+	return e.Pos
+}
+
+// errUnexpectedMatrixType is returned when part of a job's `strategy.matrix`
+// isn't the type GitHub expects.
+type errUnexpectedMatrixType struct {
+	Pos Position
+}
+
+func (e errUnexpectedMatrixType) Error() string {
+	return "unexpected type in `strategy.matrix`. expected: expression, list or map"
+}
+
+func (e errUnexpectedMatrixType) position() Position {
+	return e.Pos
+}
+
+// errInvalidTrigger is returned when one of a workflow's triggers breaks
+// GitHub's rules, so GitHub won't run the workflow.
+type errInvalidTrigger struct {
+	Event string
+	Msg   string
+	Pos   Position
+}
+
+func (e errInvalidTrigger) Error() string {
+	return fmt.Sprintf("invalid `%s` trigger: %s", e.Event, e.Msg)
+}
+
+func (e errInvalidTrigger) position() Position {
+	return e.Pos
+}
+
 // errInvalidGlobs is returned when an invalid glob pattern is encountered in a workflow file.
 type errInvalidGlobs struct {
 	Globs []string
@@ -55,6 +147,169 @@ func (e errInvalidGlobs) Error() string {
 	return fmt.Sprintf("invalid globs: %v", strings.Join(e.Globs, ", "))
 }
 
+// errInvalidDirective is returned when a directive comment in a workflow file
+// isn't a `key=value` pair or a flag we know about, or its value is invalid.
+// Err is the problem with the value, if there is one.
+type errInvalidDirective struct {
+	Directive string
+	Pos       Position
+	Err       error
+}
+
+func (e errInvalidDirective) position() Position {
+	return e.Pos
+}
+
+func (e errInvalidDirective) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid directive `%s`: %v", e.Directive, e.Err)
+	}
+
+	return fmt.Sprintf(
+		"invalid directive `%s`. expected `ignore`, `always`, `status=<name>`, `label=<name>`, "+
+			"`conclusion=<conclusion>`, `name=<rule name>`, `id=<ID>` or `predicates=<YAML>`",
+		e.Directive,
+	)
+}
+
+func (e errInvalidDirective) Unwrap() error {
+	return e.Err
+}
+
+// errExpressionParse is returned when a GitHub Actions expression can't be
+// parsed. Offset is the byte offset in the expression where the problem is.
+type errExpressionParse struct {
+	Expression string
+	Offset     int
+	Msg        string
+}
+
+func (e errExpressionParse) Error() string {
+	return fmt.Sprintf("failed to parse expression `%s` at offset %d: %s", e.Expression, e.Offset, e.Msg)
+}
+
+// errExpressionEval is returned when a GitHub Actions expression fails when it
+// is evaluated, for example because `fromJSON` is given invalid JSON.
+type errExpressionEval struct {
+	Expression string
+	Msg        string
+}
+
+func (e errExpressionEval) Error() string {
+	return fmt.Sprintf("failed to evaluate expression `%s`: %s", e.Expression, e.Msg)
+}
+
+// errCheckRunNames is returned when we can't work out the names of the check
+// runs a job creates, for example because its matrix is only known when the
+// workflow runs.
+type errCheckRunNames struct {
+	Job string
+	Err error
+}
+
+func (e errCheckRunNames) Error() string {
+	return fmt.Sprintf("can't work out the check runs of job `%s`: %v", e.Job, e.Err)
+}
+
+func (e errCheckRunNames) Unwrap() error {
+	return e.Err
+}
+
+// errBuildRules is returned when the approval rules for a workflow can't be
+// built, for example because its filters have invalid globs.
+type errBuildRules struct {
+	Path string
+	Err  error
+}
+
+func (e errBuildRules) Error() string {
+	return fmt.Sprintf("failed to build approval rules for %s: %v", e.Path, e.Err)
+}
+
+// Location returns where in the workflow file the problem is, as far as we
+// know.
+func (e errBuildRules) Location() Location {
+	return Location{Path: e.Path, Pos: ErrorPosition(e.Err)}
+}
+
+func (e errBuildRules) Unwrap() error {
+	return e.Err
+}
+
+// errInvalidRuleNameTemplate is returned when a template for rule names can't
+// be parsed, or can't be rendered.
+type errInvalidRuleNameTemplate struct {
+	Template string
+	Err      error
+}
+
+func (e errInvalidRuleNameTemplate) Error() string {
+	return fmt.Sprintf("invalid rule name template `%s`: %v", e.Template, e.Err)
+}
+
+func (e errInvalidRuleNameTemplate) Unwrap() error {
+	return e.Err
+}
+
+// errDuplicateRuleName is returned when a workflow's rules would have the same
+// name as one of an earlier workflow's rules. policy-bot refers to rules by
+// name, so one of them would be lost.
+type errDuplicateRuleName struct {
+	Name string
+}
+
+func (e errDuplicateRuleName) Error() string {
+	return fmt.Sprintf("another workflow already has a rule named `%s`", e.Name)
+}
+
+// errWorkflowReference is returned when a config merged with the generated one
+// refers to a workflow's rules by an ID which doesn't identify a single
+// workflow.
+type errWorkflowReference struct {
+	Reference string
+	Reason    string
+}
+
+func (e errWorkflowReference) Error() string {
+	return fmt.Sprintf("can't resolve `%s`: %s", e.Reference, e.Reason)
+}
+
+// ErrInvalidToolConfig is returned when the tool's own config file can't be
+// parsed or is invalid.
+type ErrInvalidToolConfig struct {
+	Path string
+	Err  error
+}
+
+func (e ErrInvalidToolConfig) Error() string {
+	return fmt.Sprintf("invalid config file %s: %v", e.Location(), e.Err)
+}
+
+// Location returns where in the config file the problem is, as far as we know.
+func (e ErrInvalidToolConfig) Location() Location {
+	return Location{Path: e.Path, Pos: ErrorPosition(e.Err)}
+}
+
+func (e ErrInvalidToolConfig) Unwrap() error {
+	return e.Err
+}
+
+// errInvalidToolConfigField is returned when a setting in the tool's config
+// file has an invalid value. Field is the setting's path in the file, like
+// `workflows[0].conclusions`.
+type errInvalidToolConfigField struct {
+	Field string
+	Err   error
+}
+
+func (e errInvalidToolConfigField) Error() string {
+	return fmt.Sprintf("invalid `%s`: %v", e.Field, e.Err)
+}
+
+func (e errInvalidToolConfigField) Unwrap() error {
+	return e.Err
+}
+
 // errMergeDisapproval is returned when we try to merge configs which both
 // contain disapproval rules. We don't know how to sensibly merge disapprovals,
 // so we error.
@@ -78,6 +333,21 @@ func (e errMergeDuplicateApprovalRules) Error() string {
 	return fmt.Sprintf("tried to merge two rules with the same name `%s` - this is not allowed", duplicateRules)
 }
 
+// errRewriteScalar is returned when a string in a config can't be rewritten in
+// place, like one which spans several lines.
+type errRewriteScalar struct {
+	Value string
+	Pos   Position
+}
+
+func (e errRewriteScalar) Error() string {
+	return fmt.Sprintf("can't rewrite `%s` at %s in place", e.Value, e.Pos)
+}
+
+func (e errRewriteScalar) position() Position {
+	return e.Pos
+}
+
 // ErrInvalidPolicyBotConfig is returned when a policy bot config cannot be
 // unmarshaled.
 type ErrInvalidPolicyBotConfig struct {
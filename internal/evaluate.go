@@ -0,0 +1,651 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// exprValue is the result of partially evaluating an expression. If the
+// expression uses something we don't know, like the pull request's head
+// branch, the value isn't known, and Depends lists what it depends on.
+type exprValue struct {
+	Known   bool
+	Value   interface{}
+	Depends []string
+
+	// lookup is set on unknown values which come from looking up a context,
+	// so that looking up a property of them describes the whole path, like
+	// `github.event.pull_request.user.login`.
+	lookup bool
+	// filtered is set on arrays which are the result of an object filter.
+	// Looking up a property of them looks it up on each element.
+	filtered bool
+}
+
+// knownValue returns a value which is known.
+func knownValue(value interface{}) exprValue {
+	return exprValue{Known: true, Value: value}
+}
+
+// unknownValue returns a value which isn't known, and depends on everything
+// that the given values depend on.
+func unknownValue(values ...exprValue) exprValue {
+	var depends []string
+	for _, v := range values {
+		depends = append(depends, v.Depends...)
+	}
+
+	slices.Sort(depends)
+	return exprValue{Depends: slices.Compact(depends)}
+}
+
+// unknownLookup returns the value of a context lookup we can't resolve.
+func unknownLookup(node exprNode) exprValue {
+	return exprValue{Depends: []string{node.String()}, lookup: true}
+}
+
+// describe describes the value for humans: either the value itself, or what
+// it depends on.
+func (v exprValue) describe() string {
+	if !v.Known {
+		return "depends on " + strings.Join(v.Depends, ", ")
+	}
+
+	if s, ok := v.Value.(string); ok {
+		return exprLiteral{Value: s}.String()
+	}
+
+	return exprToString(v.Value)
+}
+
+// exprContext is what we know when evaluating an expression.
+type exprContext struct {
+	// Values are the known parts of the contexts, like `github`, keyed by
+	// context name. Anything which isn't in here isn't known. To say that a
+	// property is known to be `null`, set it to nil.
+	Values map[string]interface{}
+	// Status holds the results of the status check functions, like
+	// `success`, if they are known. `always` is always true.
+	Status map[string]bool
+}
+
+// statusFunctionNames are the functions which check the status of earlier
+// jobs or steps.
+var statusFunctionNames = []string{"success", "always", "cancelled", "failure"}
+
+// evaluateCondition evaluates a job or step `if` condition, with or without
+// `${{ }}` around it. Like GitHub, it adds an implicit `success() &&` if the
+// condition doesn't use any of the status check functions, and treats an empty
+// condition as `success()`. The result is a boolean if it is known.
+func (ctx exprContext) evaluateCondition(condition string) (exprValue, error) {
+	node, err := parseCondition(condition)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	value, err := ctx.evaluate(node)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	if !value.Known {
+		return unknownValue(value), nil
+	}
+
+	return knownValue(exprTruthy(value.Value)), nil
+}
+
+// parseCondition parses a job or step `if` condition, adding the implicit
+// `success()` check if it's needed.
+func parseCondition(condition string) (exprNode, error) {
+	condition = strings.TrimSpace(condition)
+	if expr, ok := strings.CutPrefix(condition, "${{"); ok {
+		if expr, ok = strings.CutSuffix(expr, "}}"); ok {
+			condition = strings.TrimSpace(expr)
+		}
+	}
+
+	success := exprCall{Name: "success"}
+	if condition == "" {
+		return success, nil
+	}
+
+	node, err := parseExpression(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	if usesStatusFunction(node) {
+		return node, nil
+	}
+
+	return exprBinary{Op: "&&", Left: success, Right: node}, nil
+}
+
+// usesStatusFunction checks if an expression calls one of the status check
+// functions.
+func usesStatusFunction(node exprNode) bool {
+	switch n := node.(type) {
+	case exprCall:
+		if slices.Contains(statusFunctionNames, n.Name) {
+			return true
+		}
+		return slices.ContainsFunc(n.Args, usesStatusFunction)
+	case exprProperty:
+		return usesStatusFunction(n.Target)
+	case exprIndex:
+		return usesStatusFunction(n.Target) || usesStatusFunction(n.Index)
+	case exprFilter:
+		return usesStatusFunction(n.Target)
+	case exprNot:
+		return usesStatusFunction(n.Operand)
+	case exprBinary:
+		return usesStatusFunction(n.Left) || usesStatusFunction(n.Right)
+	}
+
+	return false
+}
+
+// evaluate partially evaluates an expression.
+func (ctx exprContext) evaluate(node exprNode) (exprValue, error) {
+	switch n := node.(type) {
+	case exprLiteral:
+		return knownValue(n.Value), nil
+
+	case exprContextRef:
+		if value, ok := exprLookupKey(ctx.Values, n.Name); ok {
+			return knownValue(value), nil
+		}
+		return unknownLookup(n), nil
+
+	case exprProperty:
+		target, err := ctx.evaluate(n.Target)
+		if err != nil {
+			return exprValue{}, err
+		}
+		return exprDeref(n, target, knownValue(n.Name)), nil
+
+	case exprIndex:
+		target, err := ctx.evaluate(n.Target)
+		if err != nil {
+			return exprValue{}, err
+		}
+		index, err := ctx.evaluate(n.Index)
+		if err != nil {
+			return exprValue{}, err
+		}
+		return exprDeref(n, target, index), nil
+
+	case exprFilter:
+		target, err := ctx.evaluate(n.Target)
+		if err != nil {
+			return exprValue{}, err
+		}
+		if !target.Known {
+			if target.lookup {
+				return unknownLookup(n), nil
+			}
+			return target, nil
+		}
+		return exprValue{Known: true, Value: exprFilterValue(target), filtered: true}, nil
+
+	case exprNot:
+		operand, err := ctx.evaluate(n.Operand)
+		if err != nil {
+			return exprValue{}, err
+		}
+		if !operand.Known {
+			return unknownValue(operand), nil
+		}
+		return knownValue(!exprTruthy(operand.Value)), nil
+
+	case exprBinary:
+		return ctx.evaluateBinary(n)
+
+	case exprCall:
+		return ctx.evaluateCall(n)
+	}
+
+	return exprValue{}, errExpressionEval{Expression: node.String(), Msg: fmt.Sprintf("unexpected node %T", node)}
+}
+
+// evaluateBinary evaluates a binary operator. `&&` and `||` short-circuit like
+// they do in GitHub: if the left side decides the result, the right side
+// doesn't matter. If only the right side is known, it can still decide
+// whether the result is truthy, in which case the result is a boolean rather
+// than the exact value GitHub would return.
+func (ctx exprContext) evaluateBinary(n exprBinary) (exprValue, error) {
+	left, err := ctx.evaluate(n.Left)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	switch n.Op {
+	case "&&", "||":
+		// `&&` returns the left side if it's falsy, `||` if it's truthy.
+		decides := n.Op == "||"
+
+		if left.Known {
+			if exprTruthy(left.Value) == decides {
+				return left, nil
+			}
+			return ctx.evaluate(n.Right)
+		}
+
+		right, err := ctx.evaluate(n.Right)
+		if err != nil {
+			return exprValue{}, err
+		}
+
+		if right.Known {
+			if exprTruthy(right.Value) == decides {
+				return knownValue(decides), nil
+			}
+			return unknownValue(left), nil
+		}
+
+		return unknownValue(left, right), nil
+	}
+
+	right, err := ctx.evaluate(n.Right)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	if !left.Known || !right.Known {
+		return unknownValue(left, right), nil
+	}
+
+	switch n.Op {
+	case "==":
+		return knownValue(exprEqual(left.Value, right.Value)), nil
+	case "!=":
+		return knownValue(!exprEqual(left.Value, right.Value)), nil
+	}
+
+	cmp, ok := exprCompare(left.Value, right.Value)
+	if !ok {
+		return knownValue(false), nil
+	}
+
+	switch n.Op {
+	case "<":
+		return knownValue(cmp < 0), nil
+	case "<=":
+		return knownValue(cmp <= 0), nil
+	case ">":
+		return knownValue(cmp > 0), nil
+	default:
+		return knownValue(cmp >= 0), nil
+	}
+}
+
+// evaluateCall evaluates a function call.
+func (ctx exprContext) evaluateCall(n exprCall) (exprValue, error) {
+	switch n.Name {
+	case "success", "cancelled", "failure", "always":
+		if status, ok := ctx.Status[n.Name]; ok {
+			return knownValue(status), nil
+		}
+		if n.Name == "always" {
+			return knownValue(true), nil
+		}
+		return exprValue{Depends: []string{n.String()}}, nil
+
+	case "hashfiles":
+		// We don't look at the repository's files.
+		return exprValue{Depends: []string{n.String()}}, nil
+	}
+
+	args := make([]exprValue, len(n.Args))
+	for i, arg := range n.Args {
+		value, err := ctx.evaluate(arg)
+		if err != nil {
+			return exprValue{}, err
+		}
+		args[i] = value
+	}
+
+	// We need all of the arguments before we can call the function.
+	if slices.ContainsFunc(args, func(v exprValue) bool { return !v.Known }) {
+		return unknownValue(args...), nil
+	}
+
+	switch n.Name {
+	case "contains":
+		return knownValue(exprContains(args[0].Value, args[1].Value)), nil
+
+	case "startswith":
+		return knownValue(strings.HasPrefix(
+			strings.ToLower(exprToString(args[0].Value)),
+			strings.ToLower(exprToString(args[1].Value)),
+		)), nil
+
+	case "endswith":
+		return knownValue(strings.HasSuffix(
+			strings.ToLower(exprToString(args[0].Value)),
+			strings.ToLower(exprToString(args[1].Value)),
+		)), nil
+
+	case "format":
+		formatted, err := exprFormat(exprToString(args[0].Value), args[1:])
+		if err != nil {
+			return exprValue{}, errExpressionEval{Expression: n.String(), Msg: err.Error()}
+		}
+		return knownValue(formatted), nil
+
+	case "join":
+		separator := ","
+		if len(args) > 1 {
+			separator = exprToString(args[1].Value)
+		}
+
+		array, ok := args[0].Value.([]interface{})
+		if !ok {
+			return knownValue(exprToString(args[0].Value)), nil
+		}
+
+		parts := make([]string, len(array))
+		for i, item := range array {
+			parts[i] = exprToString(item)
+		}
+		return knownValue(strings.Join(parts, separator)), nil
+
+	case "tojson":
+		out, err := json.MarshalIndent(args[0].Value, "", "  ")
+		if err != nil {
+			return exprValue{}, errExpressionEval{Expression: n.String(), Msg: err.Error()}
+		}
+		return knownValue(string(out)), nil
+
+	case "fromjson":
+		var value interface{}
+		if err := json.Unmarshal([]byte(exprToString(args[0].Value)), &value); err != nil {
+			return exprValue{}, errExpressionEval{Expression: n.String(), Msg: err.Error()}
+		}
+		return knownValue(value), nil
+	}
+
+	return exprValue{}, errExpressionEval{Expression: n.String(), Msg: "unknown function"}
+}
+
+// exprDeref looks up a property or index of a value.
+func exprDeref(node exprNode, target, index exprValue) exprValue {
+	if !index.Known {
+		return unknownValue(target, index)
+	}
+
+	if !target.Known {
+		if target.lookup {
+			return unknownLookup(node)
+		}
+		return target
+	}
+
+	if target.filtered {
+		// Look the property up on each element, and keep the ones which
+		// have it.
+		var results []interface{}
+		for _, item := range target.Value.([]interface{}) {
+			if value, ok := exprDerefValue(item, index.Value); ok {
+				results = append(results, value)
+			}
+		}
+		return exprValue{Known: true, Value: results, filtered: true}
+	}
+
+	value, ok := exprDerefValue(target.Value, index.Value)
+	if !ok {
+		if _, isMap := target.Value.(map[string]interface{}); isMap {
+			// We only know some of the contexts' properties, so a missing
+			// one isn't known to be `null`.
+			return unknownLookup(node)
+		}
+		return knownValue(nil)
+	}
+
+	return knownValue(value)
+}
+
+// exprDerefValue looks up a property or index of a known value. It returns
+// false if the value doesn't have it.
+func exprDerefValue(target, index interface{}) (interface{}, bool) {
+	switch t := target.(type) {
+	case map[string]interface{}:
+		return exprLookupKey(t, exprToString(index))
+	case []interface{}:
+		f, ok := index.(float64)
+		if !ok || f != math.Trunc(f) || f < 0 || int(f) >= len(t) {
+			return nil, false
+		}
+		return t[int(f)], true
+	}
+
+	return nil, false
+}
+
+// exprLookupKey looks up a key in a map. Like in GitHub, keys are
+// case-insensitive.
+func exprLookupKey(m map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := m[key]; ok {
+		return value, true
+	}
+
+	for k, value := range m {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+// exprFilterValue applies an object filter to a known value: arrays give their
+// elements, objects their values, and anything else gives nothing. Filtering
+// an already filtered array flattens it.
+func exprFilterValue(target exprValue) []interface{} {
+	items := []interface{}{target.Value}
+	if target.filtered {
+		items = target.Value.([]interface{})
+	}
+
+	results := []interface{}{}
+	for _, item := range items {
+		switch v := item.(type) {
+		case []interface{}:
+			results = append(results, v...)
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+			for _, k := range keys {
+				results = append(results, v[k])
+			}
+		}
+	}
+
+	return results
+}
+
+// exprTruthy converts a value to a boolean, the way GitHub does.
+func exprTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	default:
+		return true
+	}
+}
+
+// exprToNumber converts a value to a number, the way GitHub does.
+func exprToNumber(value interface{}) float64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return 0
+		}
+		if f, err := parseExprNumber(v); err == nil {
+			return f
+		}
+		return math.NaN()
+	default:
+		return math.NaN()
+	}
+}
+
+// exprToString converts a value to a string, the way GitHub does.
+func exprToString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case []interface{}:
+		return "Array"
+	default:
+		return "Object"
+	}
+}
+
+// isExprPrimitive checks if a value is null, a boolean, a number or a string.
+func isExprPrimitive(value interface{}) bool {
+	switch value.(type) {
+	case nil, bool, float64, string:
+		return true
+	}
+	return false
+}
+
+// exprEqual compares two values with `==`. Values of different types are
+// compared as numbers, and strings are compared ignoring case. Arrays and
+// objects are only equal to themselves, which we can't tell, so they are
+// never equal.
+func exprEqual(a, b interface{}) bool {
+	if !isExprPrimitive(a) || !isExprPrimitive(b) {
+		return false
+	}
+
+	switch av := a.(type) {
+	case nil:
+		if b == nil {
+			return true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			return av == bv
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.EqualFold(av, bv)
+		}
+	}
+
+	return exprToNumber(a) == exprToNumber(b)
+}
+
+// exprCompare compares two values for `<`, `<=`, `>` and `>=`. It returns
+// false if they can't be compared, in which case all of those are false.
+func exprCompare(a, b interface{}) (int, bool) {
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return strings.Compare(strings.ToLower(as), strings.ToLower(bs)), true
+		}
+	}
+
+	an, bn := exprToNumber(a), exprToNumber(b)
+	if math.IsNaN(an) || math.IsNaN(bn) {
+		return 0, false
+	}
+
+	switch {
+	case an < bn:
+		return -1, true
+	case an > bn:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+// exprContains implements `contains`: for an array, whether it has an equal
+// element, and otherwise whether the string contains the other, ignoring
+// case.
+func exprContains(search, item interface{}) bool {
+	if array, ok := search.([]interface{}); ok {
+		return slices.ContainsFunc(array, func(element interface{}) bool {
+			return exprEqual(element, item)
+		})
+	}
+
+	return strings.Contains(strings.ToLower(exprToString(search)), strings.ToLower(exprToString(item)))
+}
+
+// exprFormat implements `format`, which replaces `{0}`, `{1}` and so on with
+// its arguments. `{{` and `}}` are literal braces.
+func exprFormat(format string, args []exprValue) (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		switch c := format[i]; {
+		case c == '{' && i+1 < len(format) && format[i+1] == '{':
+			sb.WriteByte('{')
+			i++
+		case c == '}' && i+1 < len(format) && format[i+1] == '}':
+			sb.WriteByte('}')
+			i++
+		case c == '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed `{` in format string")
+			}
+
+			n, err := strconv.Atoi(format[i+1 : i+end])
+			if err != nil || n < 0 || n >= len(args) {
+				return "", fmt.Errorf("invalid argument `%s` in format string", format[i:i+end+1])
+			}
+
+			sb.WriteString(exprToString(args[n].Value))
+			i += end
+		case c == '}':
+			return "", fmt.Errorf("unmatched `}` in format string")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	ctx := exprContext{
+		Values: map[string]interface{}{
+			"github": map[string]interface{}{
+				"event_name": "pull_request",
+				"base_ref":   "main",
+				"event": map[string]interface{}{
+					"pull_request": map[string]interface{}{
+						"draft": false,
+						"labels": []interface{}{
+							map[string]interface{}{"name": "run-e2e"},
+							map[string]interface{}{"name": "bug"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{name: "known context", expr: "github.base_ref == 'main'", expected: "true"},
+		{name: "strings compare ignoring case", expr: "github.base_ref == 'MAIN'", expected: "true"},
+		{name: "case-insensitive property", expr: "github.BASE_REF", expected: "'main'"},
+		{name: "index", expr: "github['event_name']", expected: "'pull_request'"},
+		{name: "unknown context", expr: "github.head_ref", expected: "depends on github.head_ref"},
+		{name: "unknown nested context", expr: "github.event.pull_request.user.login != 'renovate[bot]'", expected: "depends on github.event.pull_request.user.login"},
+		{name: "unknown root context", expr: "inputs.deploy", expected: "depends on inputs.deploy"},
+		{name: "startsWith unknown", expr: "startsWith(github.head_ref, 'release-')", expected: "depends on github.head_ref"},
+		{name: "startsWith", expr: "startsWith(github.event_name, 'PULL_')", expected: "true"},
+		{name: "endsWith", expr: "endsWith(github.base_ref, 'ain')", expected: "true"},
+		{name: "contains array", expr: "contains(github.event.pull_request.labels.*.name, 'run-e2e')", expected: "true"},
+		{name: "contains array missing", expr: "contains(github.event.pull_request.labels.*.name, 'nope')", expected: "false"},
+		{name: "contains string", expr: "contains('Hello world', 'WORLD')", expected: "true"},
+		{name: "filter", expr: "join(github.event.pull_request.labels.*.name, ', ')", expected: "'run-e2e, bug'"},
+		{name: "format", expr: "format('{0}-{{x}}-{1}', github.base_ref, 2)", expected: "'main-{x}-2'"},
+		{name: "format unknown", expr: "format('{0}', github.head_ref)", expected: "depends on github.head_ref"},
+		{name: "fromJSON", expr: "fromJSON('{\"a\": [1, 2]}').a[1]", expected: "2"},
+		{name: "toJSON", expr: "toJSON(fromJSON('[1]'))", expected: "'[\n  1\n]'"},
+		{name: "and short circuits", expr: "github.base_ref == 'dev' && github.head_ref == 'x'", expected: "false"},
+		{name: "and decided by right side", expr: "github.head_ref == 'x' && github.base_ref == 'dev'", expected: "false"},
+		{name: "and with unknown", expr: "github.head_ref == 'x' && github.base_ref == 'main'", expected: "depends on github.head_ref"},
+		{name: "and returns right side", expr: "github.base_ref && github.event_name", expected: "'pull_request'"},
+		{name: "or short circuits", expr: "github.base_ref == 'main' || github.head_ref == 'x'", expected: "true"},
+		{name: "or decided by right side", expr: "github.head_ref == 'x' || !github.event.pull_request.draft", expected: "true"},
+		{name: "or with two unknowns", expr: "github.head_ref == 'x' || inputs.force", expected: "depends on github.head_ref, inputs.force"},
+		{name: "not unknown", expr: "!github.event.pull_request.merged", expected: "depends on github.event.pull_request.merged"},
+		{name: "number coercion", expr: "'1' == 1 && true == 1 && null == 0 && '' == 0", expected: "true"},
+		{name: "NaN", expr: "'abc' == 0 || 'abc' < 1 || 'abc' >= 1", expected: "false"},
+		{name: "comparison", expr: "2 > 1 && 'b' > 'A' && !(1 > 'a')", expected: "true"},
+		{name: "status functions", expr: "success()", expected: "depends on success()"},
+		{name: "always", expr: "always()", expected: "true"},
+		{name: "hashFiles", expr: "hashFiles('**/go.sum') != ''", expected: "depends on hashfiles('**/go.sum')"},
+		{name: "object filter on unknown", expr: "needs.*.result", expected: "depends on needs.*.result"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := parseExpression(tc.expr)
+			require.NoError(t, err)
+
+			value, err := ctx.evaluate(node)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, value.describe())
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	for _, expr := range []string{
+		"fromJSON('{')",
+		"format('{1}', 'a')",
+		"format('{0', 'a')",
+		"format('}', 'a')",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			node, err := parseExpression(expr)
+			require.NoError(t, err)
+
+			_, err = exprContext{}.evaluate(node)
+			require.ErrorAs(t, err, &errExpressionEval{})
+		})
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	ctx := exprContext{
+		Values: map[string]interface{}{
+			"github": map[string]interface{}{"base_ref": "main"},
+		},
+		Status: map[string]bool{"success": true, "failure": false, "cancelled": false},
+	}
+
+	testCases := []struct {
+		name      string
+		condition string
+		status    map[string]bool
+		expected  string
+	}{
+		{name: "empty", condition: "", expected: "true"},
+		{name: "expression syntax", condition: "${{ github.base_ref == 'main' }}", expected: "true"},
+		{name: "false", condition: "github.base_ref != 'main'", expected: "false"},
+		{name: "truthy value", condition: "github.base_ref", expected: "true"},
+		{name: "unknown", condition: "github.head_ref == 'main'", expected: "depends on github.head_ref"},
+		{name: "status function", condition: "failure()", expected: "false"},
+		{name: "unknown status", condition: "github.base_ref == 'main'", status: map[string]bool{}, expected: "depends on success()"},
+		{name: "always", condition: "always() && github.base_ref == 'main'", status: map[string]bool{}, expected: "true"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := ctx
+			if tc.status != nil {
+				ctx.Status = tc.status
+			}
+
+			value, err := ctx.evaluateCondition(tc.condition)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, value.describe())
+		})
+	}
+
+	_, err := ctx.evaluateCondition("github.base_ref ==")
+	require.ErrorAs(t, err, &errExpressionParse{})
+}
@@ -0,0 +1,520 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file parses the GitHub Actions expression language, which is used in
+// `${{ }}` blocks and job and step `if` conditions. See
+// https://docs.github.com/en/actions/learn-github-actions/expressions.
+
+// exprNode is a node of a parsed expression. String returns the expression in
+// a canonical form, which is also how we describe what an expression depends
+// on.
+type exprNode interface {
+	String() string
+}
+
+// exprLiteral is a `null`, boolean, number or string literal. Numbers are
+// always float64, like in JavaScript.
+type exprLiteral struct {
+	Value interface{}
+}
+
+// exprContextRef is a reference to one of the contexts, like `github`.
+type exprContextRef struct {
+	Name string
+}
+
+// exprProperty is a property dereference, like `github.event`.
+type exprProperty struct {
+	Target exprNode
+	Name   string
+}
+
+// exprIndex is an index, like `github['event']` or `needs.*.result[0]`.
+type exprIndex struct {
+	Target exprNode
+	Index  exprNode
+}
+
+// exprFilter is an object filter, like the `*` in
+// `github.event.pull_request.labels.*.name`.
+type exprFilter struct {
+	Target exprNode
+}
+
+// exprNot is a logical not, like `!cancelled()`.
+type exprNot struct {
+	Operand exprNode
+}
+
+// exprBinary is a binary operator, like `==` or `&&`.
+type exprBinary struct {
+	Op    string
+	Left  exprNode
+	Right exprNode
+}
+
+// exprCall is a function call, like `contains(github.head_ref, 'release')`.
+// The name is lower case, since function names are case-insensitive.
+type exprCall struct {
+	Name string
+	Args []exprNode
+}
+
+// exprFunctions are the functions we know about, with the minimum and maximum
+// number of arguments they take. -1 means there is no maximum.
+var exprFunctions = map[string][2]int{
+	"contains":   {2, 2},
+	"startswith": {2, 2},
+	"endswith":   {2, 2},
+	"format":     {1, -1},
+	"join":       {1, 2},
+	"tojson":     {1, 1},
+	"fromjson":   {1, 1},
+	"hashfiles":  {1, -1},
+	"success":    {0, 0},
+	"always":     {0, 0},
+	"cancelled":  {0, 0},
+	"failure":    {0, 0},
+}
+
+// exprPrecedence is the precedence of each binary operator. Higher binds
+// tighter.
+var exprPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3,
+	"!=": 3,
+	"<":  4,
+	"<=": 4,
+	">":  4,
+	">=": 4,
+}
+
+func (n exprLiteral) String() string {
+	switch v := n.Value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return exprToString(v)
+	}
+}
+
+func (n exprContextRef) String() string {
+	return n.Name
+}
+
+func (n exprProperty) String() string {
+	return n.Target.String() + "." + n.Name
+}
+
+func (n exprIndex) String() string {
+	return n.Target.String() + "[" + n.Index.String() + "]"
+}
+
+func (n exprFilter) String() string {
+	return n.Target.String() + ".*"
+}
+
+func (n exprNot) String() string {
+	if _, ok := n.Operand.(exprBinary); ok {
+		return "!(" + n.Operand.String() + ")"
+	}
+	return "!" + n.Operand.String()
+}
+
+func (n exprBinary) String() string {
+	operand := func(child exprNode) string {
+		if b, ok := child.(exprBinary); ok && exprPrecedence[b.Op] < exprPrecedence[n.Op] {
+			return "(" + b.String() + ")"
+		}
+		return child.String()
+	}
+
+	return operand(n.Left) + " " + n.Op + " " + operand(n.Right)
+}
+
+func (n exprCall) String() string {
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.String()
+	}
+
+	return n.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// exprTokenKind is the kind of a token in an expression.
+type exprTokenKind int
+
+const (
+	exprTokenEOF exprTokenKind = iota
+	exprTokenNumber
+	exprTokenString
+	exprTokenIdent
+	exprTokenPunct
+)
+
+// exprToken is a token in an expression. Offset is its byte offset in the
+// expression.
+type exprToken struct {
+	Kind   exprTokenKind
+	Text   string
+	Value  interface{}
+	Offset int
+}
+
+// exprPuncts are the punctuation tokens, longest first so that `<=` isn't
+// read as `<`.
+var exprPuncts = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"<", ">", "!", "(", ")", "[", "]", ".", ",", "*",
+}
+
+// lexExpression splits an expression into tokens.
+func lexExpression(expr string) ([]exprToken, error) {
+	var tokens []exprToken
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for {
+				if j >= len(expr) {
+					return nil, errExpressionParse{Expression: expr, Offset: i, Msg: "unterminated string"}
+				}
+				if expr[j] == '\'' {
+					// Quotes are escaped by doubling them.
+					if j+1 < len(expr) && expr[j+1] == '\'' {
+						sb.WriteByte('\'')
+						j += 2
+						continue
+					}
+					break
+				}
+				sb.WriteByte(expr[j])
+				j++
+			}
+			tokens = append(tokens, exprToken{Kind: exprTokenString, Text: expr[i : j+1], Value: sb.String(), Offset: i})
+			i = j + 1
+
+		case isIdentChar(c) && afterDot(tokens):
+			// Property names can start with a digit or a dash, like
+			// `steps.1st-step`, so they aren't numbers.
+			j := i + 1
+			for j < len(expr) && isIdentChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, exprToken{Kind: exprTokenIdent, Text: expr[i:j], Offset: i})
+			i = j
+
+		case isDigit(c) || (c == '-' && i+1 < len(expr) && (isDigit(expr[i+1]) || expr[i+1] == '.')) ||
+			(c == '.' && i+1 < len(expr) && isDigit(expr[i+1]) && !followsValue(tokens)):
+			j := i + 1
+			for j < len(expr) && (isIdentChar(expr[j]) || expr[j] == '.' ||
+				((expr[j] == '+' || expr[j] == '-') && (expr[j-1] == 'e' || expr[j-1] == 'E'))) {
+				j++
+			}
+			value, err := parseExprNumber(expr[i:j])
+			if err != nil {
+				return nil, errExpressionParse{Expression: expr, Offset: i, Msg: fmt.Sprintf("invalid number `%s`", expr[i:j])}
+			}
+			tokens = append(tokens, exprToken{Kind: exprTokenNumber, Text: expr[i:j], Value: value, Offset: i})
+			i = j
+
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(expr) && isIdentChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, exprToken{Kind: exprTokenIdent, Text: expr[i:j], Offset: i})
+			i = j
+
+		default:
+			found := false
+			for _, punct := range exprPuncts {
+				if strings.HasPrefix(expr[i:], punct) {
+					tokens = append(tokens, exprToken{Kind: exprTokenPunct, Text: punct, Offset: i})
+					i += len(punct)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, errExpressionParse{Expression: expr, Offset: i, Msg: fmt.Sprintf("unexpected character `%c`", c)}
+			}
+		}
+	}
+
+	return append(tokens, exprToken{Kind: exprTokenEOF, Offset: len(expr)}), nil
+}
+
+// followsValue checks if the last token ends a value, in which case a `.` is a
+// property dereference rather than the start of a number.
+func followsValue(tokens []exprToken) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+
+	last := tokens[len(tokens)-1]
+	return last.Kind != exprTokenPunct || last.Text == ")" || last.Text == "]" || last.Text == "*"
+}
+
+// afterDot checks if the last token is a `.`, so the next one is a property
+// name.
+func afterDot(tokens []exprToken) bool {
+	return len(tokens) > 0 && tokens[len(tokens)-1].Kind == exprTokenPunct && tokens[len(tokens)-1].Text == "."
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '-'
+}
+
+// parseExprNumber parses a number literal. Hexadecimal and exponent notation
+// are allowed.
+func parseExprNumber(s string) (float64, error) {
+	unsigned := strings.TrimPrefix(s, "-")
+	if strings.HasPrefix(unsigned, "0x") || strings.HasPrefix(unsigned, "0X") {
+		n, err := strconv.ParseInt(unsigned[2:], 16, 64)
+		if err != nil {
+			return 0, err
+		}
+		if unsigned != s {
+			n = -n
+		}
+		return float64(n), nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// exprParser is a recursive descent parser for expressions.
+type exprParser struct {
+	expr   string
+	tokens []exprToken
+	pos    int
+}
+
+// parseExpression parses an expression, without the `${{ }}` around it.
+func parseExpression(expr string) (exprNode, error) {
+	tokens, err := lexExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{expr: expr, tokens: tokens}
+	node, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.Kind != exprTokenEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+
+	return node, nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.Kind != exprTokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) isPunct(text string) bool {
+	tok := p.peek()
+	return tok.Kind == exprTokenPunct && tok.Text == text
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.isPunct(text) {
+		return p.errorf(p.peek(), "expected `%s`, got %s", text, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) errorf(tok exprToken, format string, args ...interface{}) error {
+	return errExpressionParse{Expression: p.expr, Offset: tok.Offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+// String describes the token for error messages.
+func (tok exprToken) String() string {
+	if tok.Kind == exprTokenEOF {
+		return "end of expression"
+	}
+	return "`" + tok.Text + "`"
+}
+
+// parseBinary parses binary operators with at least the given precedence.
+func (p *exprParser) parseBinary(minPrecedence int) (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		precedence, ok := exprPrecedence[tok.Text]
+		if tok.Kind != exprTokenPunct || !ok || precedence < minPrecedence {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseBinary(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left = exprBinary{Op: tok.Text, Left: left, Right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isPunct("!") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{Operand: operand}, nil
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.isPunct("."):
+			p.next()
+			tok := p.next()
+			switch {
+			case tok.Kind == exprTokenPunct && tok.Text == "*":
+				node = exprFilter{Target: node}
+			case tok.Kind == exprTokenIdent:
+				node = exprProperty{Target: node, Name: tok.Text}
+			default:
+				return nil, p.errorf(tok, "expected property name, got %s", tok)
+			}
+
+		case p.isPunct("["):
+			p.next()
+			if p.isPunct("*") {
+				p.next()
+				node = exprFilter{Target: node}
+			} else {
+				index, err := p.parseBinary(1)
+				if err != nil {
+					return nil, err
+				}
+				node = exprIndex{Target: node, Index: index}
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+
+		default:
+			return node, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+
+	switch tok.Kind {
+	case exprTokenNumber, exprTokenString:
+		return exprLiteral{Value: tok.Value}, nil
+
+	case exprTokenIdent:
+		switch tok.Text {
+		case "null":
+			return exprLiteral{Value: nil}, nil
+		case "true":
+			return exprLiteral{Value: true}, nil
+		case "false":
+			return exprLiteral{Value: false}, nil
+		}
+
+		if !p.isPunct("(") {
+			return exprContextRef{Name: tok.Text}, nil
+		}
+		return p.parseCall(tok)
+
+	case exprTokenPunct:
+		if tok.Text == "(" {
+			node, err := p.parseBinary(1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+		}
+	}
+
+	return nil, p.errorf(tok, "unexpected %s", tok)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	call := exprCall{Name: strings.ToLower(name.Text)}
+
+	arity, ok := exprFunctions[call.Name]
+	if !ok {
+		return nil, p.errorf(name, "unknown function `%s`", name.Text)
+	}
+
+	p.next() // (
+	for !p.isPunct(")") {
+		if len(call.Args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		arg, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+	}
+	p.next() // )
+
+	if len(call.Args) < arity[0] || (arity[1] >= 0 && len(call.Args) > arity[1]) {
+		return nil, p.errorf(name, "wrong number of arguments to `%s`", name.Text)
+	}
+
+	return call, nil
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpression(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{name: "context", expr: "github", expected: "github"},
+		{name: "property", expr: "github.event.pull_request.draft", expected: "github.event.pull_request.draft"},
+		{name: "property with dash and digit", expr: "steps.1st-step.outputs.x", expected: "steps.1st-step.outputs.x"},
+		{name: "index", expr: "github['base_ref']", expected: "github['base_ref']"},
+		{name: "filter", expr: "github.event.pull_request.labels.*.name", expected: "github.event.pull_request.labels.*.name"},
+		{name: "bracket filter", expr: "needs[*].result", expected: "needs.*.result"},
+		{name: "string with quote", expr: "'it''s'", expected: "'it''s'"},
+		{name: "numbers", expr: "1 < 2.5 && -3 >= 0xff && 1e3 == .5", expected: "1 < 2.5 && -3 >= 255 && 1000 == 0.5"},
+		{name: "literals", expr: "null == false || true", expected: "null == false || true"},
+		{name: "not", expr: "!cancelled()", expected: "!cancelled()"},
+		{name: "not a binary", expr: "!(a == b)", expected: "!(a == b)"},
+		{name: "precedence", expr: "a || b && c == d", expected: "a || b && c == d"},
+		{name: "parentheses", expr: "(a || b) && c", expected: "(a || b) && c"},
+		{name: "function names are case-insensitive", expr: "startsWith(github.head_ref, 'release-')", expected: "startswith(github.head_ref, 'release-')"},
+		{name: "format", expr: "format('{0}-{1}', github.ref, 1)", expected: "format('{0}-{1}', github.ref, 1)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := parseExpression(tc.expr)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, node.String())
+		})
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		expr   string
+		offset int
+	}{
+		{name: "unterminated string", expr: "a == 'b", offset: 5},
+		{name: "unknown function", expr: "nope(a)", offset: 0},
+		{name: "wrong number of arguments", expr: "contains(a)", offset: 0},
+		{name: "missing operand", expr: "a ==", offset: 4},
+		{name: "unclosed parenthesis", expr: "(a", offset: 2},
+		{name: "trailing tokens", expr: "a b", offset: 2},
+		{name: "unexpected character", expr: "a = b", offset: 2},
+		{name: "invalid number", expr: "1.2.3", offset: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseExpression(tc.expr)
+
+			var parseErr errExpressionParse
+			require.ErrorAs(t, err, &parseErr)
+			require.Equal(t, tc.offset, parseErr.Offset)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/redmatter/go-globre/v2"
+)
+
+// matchAll is the glob which matches every path or branch.
+const matchAll = "**"
+
+// filterSegment is a run of positive patterns from a GitHub Actions filter,
+// along with the negated patterns which come after it. A value is in the
+// segment if it matches one of the `Include` patterns and none of the
+// `Exclude` patterns.
+type filterSegment struct {
+	Include []string
+	Exclude []string
+}
+
+// matchesAll reports whether the segment's include patterns match every value.
+// An empty segment, which is what we use when there is no filter at all,
+// matches everything too.
+func (fs filterSegment) matchesAll() bool {
+	return len(fs.Include) == 0 || slices.Contains(fs.Include, matchAll)
+}
+
+// matches checks if a value, like a file's path, is in the segment. Invalid
+// globs don't match anything.
+func (fs filterSegment) matches(value string) bool {
+	globMatches := func(glob string) bool {
+		matched, err := regexp.MatchString(globre.RegexFromGlob(glob), value)
+		return err == nil && matched
+	}
+
+	if !fs.matchesAll() && !slices.ContainsFunc(fs.Include, globMatches) {
+		return false
+	}
+
+	return !slices.ContainsFunc(fs.Exclude, globMatches)
+}
+
+// covers checks if every path which matches one of the globs is in the
+// segment. We can only tell from the globs' literal prefixes, like `src/` in
+// `src/**`, so it errs on the side of false.
+func (fs filterSegment) covers(globs []string) bool {
+	if len(globs) == 0 {
+		return false
+	}
+
+	for _, glob := range globs {
+		if strings.HasPrefix(glob, "!") {
+			return false
+		}
+
+		if !fs.matchesAll() && !slices.ContainsFunc(fs.Include, func(include string) bool {
+			return include == glob || globContains(include, glob)
+		}) {
+			return false
+		}
+
+		if slices.ContainsFunc(fs.Exclude, func(exclude string) bool { return globsOverlap(exclude, glob) }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// literalPrefix returns the part of a glob before its first wildcard.
+func literalPrefix(glob string) string {
+	if i := strings.IndexAny(glob, "*?[{"); i >= 0 {
+		return glob[:i]
+	}
+
+	return glob
+}
+
+// globContains checks if a glob like `src/**` matches every path another glob
+// can match, because the other glob starts with its literal prefix.
+func globContains(outer, inner string) bool {
+	prefix, ok := strings.CutSuffix(outer, matchAll)
+	return ok && literalPrefix(outer) == prefix && strings.HasPrefix(literalPrefix(inner), prefix)
+}
+
+// globsOverlap checks if two globs might match the same path: unless one's
+// literal prefix starts with the other's, they can't.
+func globsOverlap(a, b string) bool {
+	pa, pb := literalPrefix(a), literalPrefix(b)
+	return strings.HasPrefix(pa, pb) || strings.HasPrefix(pb, pa)
+}
+
+// splitFilter splits a list of GitHub Actions filter patterns into segments.
+// GitHub checks the patterns in order and the last one which matches wins. So
+// a value is matched if it matches a positive pattern and none of the negated
+// (`!`-prefixed) patterns after it. Negated patterns before the first positive
+// pattern can never change the result, so they are dropped.
+//
+// A value is matched by the filter if it is in any of the segments.
+func splitFilter(patterns []string) []filterSegment {
+	var segments []filterSegment
+
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			for i := range segments {
+				segments[i].Exclude = append(segments[i].Exclude, negated)
+			}
+			continue
+		}
+
+		// Consecutive positive patterns are excluded by the same negations,
+		// so they can share a segment.
+		if n := len(segments); n > 0 && len(segments[n-1].Exclude) == 0 {
+			segments[n-1].Include = append(segments[n-1].Include, pattern)
+			continue
+		}
+
+		segments = append(segments, filterSegment{Include: []string{pattern}})
+	}
+
+	return segments
+}
+
+// invertFilter turns an ignore list, like `paths-ignore`, into the equivalent
+// include list. Ignoring `a` is the same as including everything apart from
+// `a`, and un-ignoring `!b` is the same as including `b`.
+func invertFilter(patterns []string) []string {
+	inverted := []string{matchAll}
+
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			inverted = append(inverted, negated)
+			continue
+		}
+
+		inverted = append(inverted, "!"+pattern)
+	}
+
+	return inverted
+}
+
+// filterSegments returns the segments for a filter and its ignore list, such as
+// `branches` and `branches-ignore`. If there is no filter at all, it returns a
+// single empty segment, which matches everything. If the filter can't match
+// anything, for example because it only has negated patterns, it returns no
+// segments.
+//
+// GitHub doesn't allow a filter and its ignore list on the same event, and
+// such workflows are rejected (see validateTriggers). If both are given anyway,
+// the ignored patterns are excluded from every segment of the filter.
+func filterSegments(filter, ignore []string) []filterSegment {
+	if len(filter) == 0 && len(ignore) == 0 {
+		return []filterSegment{{}}
+	}
+
+	if len(filter) == 0 {
+		return splitFilter(invertFilter(ignore))
+	}
+
+	segments := splitFilter(filter)
+
+	for _, pattern := range ignore {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+
+		for i := range segments {
+			segments[i].Exclude = append(segments[i].Exclude, pattern)
+		}
+	}
+
+	return segments
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitFilter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		expected []filterSegment
+	}{
+		{
+			name:     "no patterns",
+			patterns: nil,
+			expected: nil,
+		},
+		{
+			name:     "only positive patterns",
+			patterns: []string{"src/**", "go.mod"},
+			expected: []filterSegment{
+				{Include: []string{"src/**", "go.mod"}},
+			},
+		},
+		{
+			name:     "negation after positive patterns",
+			patterns: []string{"src/**", "!src/**/*.md"},
+			expected: []filterSegment{
+				{Include: []string{"src/**"}, Exclude: []string{"src/**/*.md"}},
+			},
+		},
+		{
+			name:     "positive pattern after negation",
+			patterns: []string{"src/**", "!src/**/*.md", "src/README.md", "!src/vendor/**"},
+			expected: []filterSegment{
+				{Include: []string{"src/**"}, Exclude: []string{"src/**/*.md", "src/vendor/**"}},
+				{Include: []string{"src/README.md"}, Exclude: []string{"src/vendor/**"}},
+			},
+		},
+		{
+			name:     "leading negation is dropped",
+			patterns: []string{"!docs/**", "src/**"},
+			expected: []filterSegment{
+				{Include: []string{"src/**"}},
+			},
+		},
+		{
+			name:     "only negations",
+			patterns: []string{"!docs/**"},
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, splitFilter(tc.patterns))
+		})
+	}
+}
+
+func TestInvertFilter(t *testing.T) {
+	require.Equal(t,
+		[]string{"**", "!docs/**", "docs/api/**"},
+		invertFilter([]string{"docs/**", "!docs/api/**"}),
+	)
+}
+
+func TestFilterSegments(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filter   []string
+		ignore   []string
+		expected []filterSegment
+	}{
+		{
+			name:     "no filter",
+			expected: []filterSegment{{}},
+		},
+		{
+			name:   "only filter",
+			filter: []string{"main", "!main-old"},
+			expected: []filterSegment{
+				{Include: []string{"main"}, Exclude: []string{"main-old"}},
+			},
+		},
+		{
+			name:   "only ignore",
+			ignore: []string{"release/**", "!release/next"},
+			expected: []filterSegment{
+				{Include: []string{"**"}, Exclude: []string{"release/**"}},
+				{Include: []string{"release/next"}},
+			},
+		},
+		{
+			name:   "filter and ignore",
+			filter: []string{"src/**"},
+			ignore: []string{"src/vendor/**", "!src/vendor/ours/**"},
+			expected: []filterSegment{
+				{Include: []string{"src/**"}, Exclude: []string{"src/vendor/**"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, filterSegments(tc.filter, tc.ignore))
+		})
+	}
+}
+
+func TestFilterSegmentMatches(t *testing.T) {
+	testCases := []struct {
+		name     string
+		segment  filterSegment
+		value    string
+		expected bool
+	}{
+		{
+			name:     "empty segment",
+			value:    ".github/workflows/build.yml",
+			expected: true,
+		},
+		{
+			name:     "included",
+			segment:  filterSegment{Include: []string{".github/**"}},
+			value:    ".github/workflows/build.yml",
+			expected: true,
+		},
+		{
+			name:    "not included",
+			segment: filterSegment{Include: []string{"src/**"}},
+			value:   ".github/workflows/build.yml",
+		},
+		{
+			name:    "excluded",
+			segment: filterSegment{Include: []string{"**"}, Exclude: []string{".github/**"}},
+			value:   ".github/workflows/build.yml",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.segment.matches(tc.value))
+		})
+	}
+}
+
+func TestFilterSegmentCovers(t *testing.T) {
+	tests := []struct {
+		segment  filterSegment
+		globs    []string
+		expected bool
+	}{
+		{segment: filterSegment{}, globs: []string{"src/**"}, expected: true},
+		{segment: filterSegment{Include: []string{"**"}}, globs: []string{"src/**"}, expected: true},
+		{segment: filterSegment{Include: []string{"src/**"}}, globs: []string{"src/api/**", "src/main.go"}, expected: true},
+		{segment: filterSegment{Include: []string{"src/*.go"}}, globs: []string{"src/*.go"}, expected: true},
+		{segment: filterSegment{Include: []string{"**"}, Exclude: []string{"docs/**"}}, globs: []string{"src/**"}, expected: true},
+		{segment: filterSegment{Include: []string{"src/**"}}, globs: []string{"src/**", "docs/**"}},
+		{segment: filterSegment{Include: []string{"src/*.go"}}, globs: []string{"src/main.go"}},
+		{segment: filterSegment{Include: []string{"**"}, Exclude: []string{"src/gen/**"}}, globs: []string{"src/**"}},
+		{segment: filterSegment{Include: []string{"**"}}, globs: []string{"!src/**"}},
+		{segment: filterSegment{Include: []string{"**"}}},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, tt.segment.covers(tt.globs), "%+v covers %v", tt.segment, tt.globs)
+	}
+}
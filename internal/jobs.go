@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// stringList is a YAML value which can be a single string or a list of them,
+// like a job's `needs`.
+type stringList []string
+
+// UnmarshalYAML implements custom unmarshaling for stringList.
+func (sl *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*sl = stringList{node.Value}
+		return nil
+	}
+
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return errWorkflowParse{Err: err, Pos: positionOf(node)}
+	}
+
+	*sl = list
+	return nil
+}
+
+// gitHubWorkflowJob represents a job in a GitHub Actions workflow. A job
+// either has steps, or `uses` a reusable workflow.
+type gitHubWorkflowJob struct {
+	Name        string
+	If          string
+	Needs       stringList
+	Uses        string
+	With        map[string]string
+	Strategy    *jobStrategy
+	Steps       []gitHubWorkflowStep
+	Concurrency *workflowConcurrency
+	Permissions *workflowPermissions
+	Environment *jobEnvironment
+	Outputs     map[string]string
+	Pos         Position `yaml:"-"`
+
+	// callee is the local reusable workflow the job calls. It is filled in
+	// by ResolveReusableWorkflows.
+	callee *upstreamWorkflow
+}
+
+// gitHubWorkflowStep represents a step in a job. A step either `uses` an
+// action or has a command to `run`.
+type gitHubWorkflowStep struct {
+	ID   string
+	Name string
+	If   string
+	Uses string
+	Run  string
+	With map[string]string
+	Pos  Position `yaml:"-"`
+
+	// filters are the filters of a paths-filter step. They are filled in by
+	// ResolvePathsFilters.
+	filters pathsFilters
+}
+
+// UnmarshalYAML implements custom unmarshaling for gitHubWorkflowStep, to
+// record its position.
+func (step *gitHubWorkflowStep) UnmarshalYAML(node *yaml.Node) error {
+	type rawStep gitHubWorkflowStep
+	if err := node.Decode((*rawStep)(step)); err != nil {
+		return err
+	}
+
+	step.Pos = positionOf(node)
+	return nil
+}
+
+// jobEnvironment represents the environment a job deploys to. It can be given
+// as just the environment's name.
+type jobEnvironment struct {
+	Name string
+	URL  string
+	Pos  Position `yaml:"-"`
+}
+
+// UnmarshalYAML implements custom unmarshaling for jobEnvironment.
+func (env *jobEnvironment) UnmarshalYAML(node *yaml.Node) error {
+	env.Pos = positionOf(node)
+
+	if node.Kind == yaml.ScalarNode {
+		env.Name = node.Value
+		return nil
+	}
+
+	type rawEnvironment jobEnvironment
+	return node.Decode((*rawEnvironment)(env))
+}
+
+// jobStrategy represents a job's `strategy`.
+type jobStrategy struct {
+	Matrix      *jobMatrix
+	FailFast    string   `yaml:"fail-fast"`
+	MaxParallel string   `yaml:"max-parallel"`
+	Pos         Position `yaml:"-"`
+}
+
+// UnmarshalYAML implements custom unmarshaling for jobStrategy, to record its
+// position. The whole strategy can be an expression, like
+// `${{ fromJSON(needs.setup.outputs.strategy) }}`, in which case its matrix is
+// only known when the workflow runs too.
+func (js *jobStrategy) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		js.Pos = positionOf(node)
+		js.Matrix = &jobMatrix{Expression: node.Value, Pos: js.Pos}
+		return nil
+	}
+
+	type rawStrategy jobStrategy
+	if err := node.Decode((*rawStrategy)(js)); err != nil {
+		return err
+	}
+
+	js.Pos = positionOf(node)
+	return nil
+}
+
+// matrixEntry is one key and value of a matrix combination.
+type matrixEntry struct {
+	Key   string
+	Value interface{}
+}
+
+// matrixCombination is an entry of a matrix's `include` or `exclude` list. The
+// order of the keys is kept, since GitHub uses it to name the jobs.
+type matrixCombination []matrixEntry
+
+// UnmarshalYAML implements custom unmarshaling for matrixCombination.
+func (mc *matrixCombination) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return errUnexpectedMatrixType{Pos: positionOf(node)}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var value interface{}
+		if err := node.Content[i+1].Decode(&value); err != nil {
+			return err
+		}
+
+		*mc = append(*mc, matrixEntry{Key: node.Content[i].Value, Value: value})
+	}
+
+	return nil
+}
+
+// matrixDimension is one of the keys of a matrix, with the values the jobs
+// take for it. Expression is set instead of Values when the values are only
+// known when the workflow runs, like `${{ fromJSON(needs.setup.outputs.os) }}`.
+type matrixDimension struct {
+	Key        string
+	Values     []interface{}
+	Expression string
+	Pos        Position `yaml:"-"`
+}
+
+// jobMatrix represents a job's `strategy.matrix`. Expression is set when the
+// whole matrix, or its `include` or `exclude` list, is an expression which is
+// only known when the workflow runs. The order of the dimensions is kept,
+// since GitHub uses it to name the jobs.
+type jobMatrix struct {
+	Dimensions []matrixDimension
+	Include    []matrixCombination
+	Exclude    []matrixCombination
+	Expression string
+	Pos        Position `yaml:"-"`
+}
+
+// UnmarshalYAML implements custom unmarshaling for jobMatrix.
+func (m *jobMatrix) UnmarshalYAML(node *yaml.Node) error {
+	m.Pos = positionOf(node)
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		m.Expression = node.Value
+		return nil
+	case yaml.MappingNode:
+	default:
+		return errUnexpectedMatrixType{Pos: m.Pos}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		switch key.Value {
+		case "include", "exclude":
+			if value.Kind == yaml.ScalarNode {
+				m.Expression = value.Value
+				continue
+			}
+
+			var combinations []matrixCombination
+			if err := value.Decode(&combinations); err != nil {
+				return err
+			}
+
+			if key.Value == "include" {
+				m.Include = combinations
+			} else {
+				m.Exclude = combinations
+			}
+		default:
+			dimension := matrixDimension{Key: key.Value, Pos: positionOf(key)}
+
+			switch value.Kind {
+			case yaml.ScalarNode:
+				dimension.Expression = value.Value
+			case yaml.SequenceNode:
+				if err := value.Decode(&dimension.Values); err != nil {
+					return err
+				}
+			default:
+				return errUnexpectedMatrixType{Pos: positionOf(value)}
+			}
+
+			m.Dimensions = append(m.Dimensions, dimension)
+		}
+	}
+
+	return nil
+}
+
+// statusFunctions are the functions which let a job run even when one of the
+// jobs it needs didn't succeed.
+var statusFunctions = []string{"always()", "failure()", "cancelled()"}
+
+// dependsOnNeeds checks if a job is skipped when one of the jobs it `needs` is
+// skipped. That's the default, unless its condition uses a status function.
+func (job gitHubWorkflowJob) dependsOnNeeds() bool {
+	return !slices.ContainsFunc(statusFunctions, func(f string) bool {
+		return strings.Contains(job.If, f)
+	})
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"log/slog"
+
+	"github.com/palantir/policy-bot/policy/predicate"
+)
+
+// LargeDiffStrategy says how the rules for workflows with path filters treat
+// pull requests with large diffs. GitHub only checks the first 300 files of a
+// diff against a workflow's path filters: if none of them match, the workflow
+// doesn't run, even if a later file would have matched. policy-bot checks
+// every file, so it can wait for a workflow which never runs. It can't count
+// files, so a diff's size is measured in modified lines instead.
+type LargeDiffStrategy string
+
+const (
+	// LargeDiffsPaths checks the path filters against every file, however
+	// large the diff is.
+	LargeDiffsPaths LargeDiffStrategy = "paths"
+	// LargeDiffsSkip doesn't require workflows with path filters on large
+	// diffs, since GitHub might not run them.
+	LargeDiffsSkip LargeDiffStrategy = "skip"
+	// LargeDiffsRequire requires workflows with path filters on every large
+	// diff, whichever files it changes.
+	LargeDiffsRequire LargeDiffStrategy = "require"
+)
+
+// DefaultLargeDiffLines is the number of modified lines from which a diff
+// counts as large, unless another one is given. Lines are a poor stand-in for
+// files: a diff with a few dozen generated or vendored files can easily have
+// thousands of lines. It is high enough that such diffs are rarely affected,
+// at the cost of missing diffs with more than 300 small files.
+const DefaultLargeDiffLines = 10000
+
+// largeDiffs holds the strategy for large diffs, and the number of modified
+// lines from which a diff counts as large.
+type largeDiffs struct {
+	Strategy LargeDiffStrategy
+	Lines    int64
+}
+
+const (
+	skipLargeDiffsDescription = "GitHub only checks the first 300 changed files against the workflow's path filters, " +
+		"so the workflow isn't required when the diff is large."
+	requireLargeDiffsDescription = "GitHub only checks the first 300 changed files against the workflow's path filters, " +
+		"so the workflow is required whenever the diff is large."
+)
+
+// HandleLargeDiffs returns a copy of the collection in which the rules for
+// workflows with path filters treat diffs with at least lines modified lines
+// according to strategy (see LargeDiffStrategy). Since modified lines only
+// approximate the number of files GitHub checks, a strategy other than
+// LargeDiffsPaths is reported, so that its effect doesn't go unnoticed.
+func (workflows GitHubWorkflowCollection) HandleLargeDiffs(strategy LargeDiffStrategy, lines int64) GitHubWorkflowCollection {
+	switch strategy {
+	case LargeDiffsSkip:
+		slog.Warn("workflows with path filters aren't required on diffs with many modified lines, whichever files they change", "lines", lines)
+	case LargeDiffsRequire:
+		slog.Warn("workflows with path filters are required on every diff with many modified lines, whichever files they change", "lines", lines)
+	}
+
+	resolved := make(GitHubWorkflowCollection, len(workflows))
+	for path, wf := range workflows {
+		wf.largeDiffs = largeDiffs{Strategy: strategy, Lines: lines}
+		resolved[path] = wf
+	}
+
+	return resolved
+}
+
+// pathPredicates are the predicates which decide if a rule applies, given the
+// files a pull request changes, with an explanation for the rule if they need
+// one. Segment is the segment of the path filters they come from.
+type pathPredicates struct {
+	Segment       filterSegment
+	ChangedFiles  *predicate.ChangedFiles
+	ModifiedLines *predicate.ModifiedLines
+	Description   string
+}
+
+// pathPredicates converts each segment of the trigger's path filters into
+// predicates, and adjusts them for large diffs. With LargeDiffsSkip, the
+// segments which don't match every file only apply to small diffs. With
+// LargeDiffsRequire, there's an extra entry which applies to every large diff,
+// if any segment doesn't match every file.
+func (tf triggerFilters) pathPredicates() ([]pathPredicates, error) {
+	var result []pathPredicates
+	filtered := false
+
+	for _, segment := range tf.Paths {
+		changedFiles, err := changedFilesPredicate(segment)
+		if err != nil {
+			return nil, err
+		}
+
+		p := pathPredicates{Segment: segment, ChangedFiles: changedFiles}
+		if changedFiles != nil {
+			filtered = true
+
+			if tf.LargeDiffs.Strategy == LargeDiffsSkip {
+				p.ModifiedLines = &predicate.ModifiedLines{
+					Total: predicate.ComparisonExpr{Op: predicate.OpLessThan, Value: tf.LargeDiffs.Lines},
+				}
+				p.Description = skipLargeDiffsDescription
+			}
+		}
+
+		result = append(result, p)
+	}
+
+	if filtered && tf.LargeDiffs.Strategy == LargeDiffsRequire {
+		result = append(result, pathPredicates{
+			ModifiedLines: &predicate.ModifiedLines{
+				Total: predicate.ComparisonExpr{Op: predicate.OpGreaterThan, Value: tf.LargeDiffs.Lines - 1},
+			},
+			Description: requireLargeDiffsDescription,
+		})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMakeApprovalRulesLargeDiffs(t *testing.T) {
+	const path = ".github/workflows/ci.yml"
+
+	var wf GitHubWorkflow
+	require.NoError(t, yaml.Unmarshal([]byte(`
+on:
+  pull_request:
+    paths: ["src/**"]
+  pull_request_review:
+    types: [submitted]
+`), &wf))
+
+	small := &predicate.ModifiedLines{Total: predicate.ComparisonExpr{Op: predicate.OpLessThan, Value: 300}}
+	large := &predicate.ModifiedLines{Total: predicate.ComparisonExpr{Op: predicate.OpGreaterThan, Value: 299}}
+	changedFiles := &predicate.ChangedFiles{Paths: mustRegexpsFromGlobs(t, []string{"src/**"})}
+
+	t.Run("paths", func(t *testing.T) {
+		wf := GitHubWorkflowCollection{path: wf}.HandleLargeDiffs(LargeDiffsPaths, 300)[path]
+
+		result, err := makeApprovalRules(path, wf)
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 2)
+		require.Equal(t, changedFiles, result.Rules[0].Predicates.ChangedFiles)
+		require.Nil(t, result.Rules[0].Predicates.ModifiedLines)
+		require.Nil(t, result.Rules[1].Predicates.ModifiedLines)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		wf := GitHubWorkflowCollection{path: wf}.HandleLargeDiffs(LargeDiffsSkip, 300)[path]
+
+		result, err := makeApprovalRules(path, wf)
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 2)
+		require.Equal(t, changedFiles, result.Rules[0].Predicates.ChangedFiles)
+		require.Equal(t, small, result.Rules[0].Predicates.ModifiedLines)
+		require.Equal(t, skipLargeDiffsDescription, result.Rules[0].Description)
+
+		// Reviews aren't filtered by path, so they're unaffected.
+		require.Nil(t, result.Rules[1].Predicates.ModifiedLines)
+	})
+
+	t.Run("require", func(t *testing.T) {
+		wf := GitHubWorkflowCollection{path: wf}.HandleLargeDiffs(LargeDiffsRequire, 300)[path]
+
+		result, err := makeApprovalRules(path, wf)
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 3)
+
+		require.Equal(t, "Workflow .github/workflows/ci.yml succeeded or skipped (pull_request, part 1)", result.Rules[0].Name)
+		require.Equal(t, changedFiles, result.Rules[0].Predicates.ChangedFiles)
+		require.Nil(t, result.Rules[0].Predicates.ModifiedLines)
+
+		require.Equal(t, "Workflow .github/workflows/ci.yml succeeded or skipped (pull_request, part 2)", result.Rules[1].Name)
+		require.Nil(t, result.Rules[1].Predicates.ChangedFiles)
+		require.Equal(t, large, result.Rules[1].Predicates.ModifiedLines)
+		require.Equal(t, requireLargeDiffsDescription, result.Rules[1].Description)
+
+		require.Equal(t, map[string]interface{}{"and": []interface{}{
+			result.Rules[0].Name,
+			result.Rules[1].Name,
+			result.Rules[2].Name,
+		}}, result.Policy)
+	})
+
+	t.Run("no path filters", func(t *testing.T) {
+		var wf GitHubWorkflow
+		require.NoError(t, yaml.Unmarshal([]byte(`on: pull_request`), &wf))
+		wf = GitHubWorkflowCollection{path: wf}.HandleLargeDiffs(LargeDiffsRequire, 300)[path]
+
+		result, err := makeApprovalRules(path, wf)
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 1)
+		require.Nil(t, result.Rules[0].Predicates.ModifiedLines)
+	})
+}
@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"io/fs"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pathsFilterAction is the action which works out which areas of the
+// repository a pull request changes, so that later jobs can be skipped when
+// their area hasn't changed.
+//
+// https://github.com/dorny/paths-filter
+const pathsFilterAction = "dorny/paths-filter"
+
+// checkoutAction checks out the repository, which paths-filter needs when its
+// filters are in a file.
+const checkoutAction = "actions/checkout"
+
+// usesAction checks if a step uses an action, at any version.
+func (step gitHubWorkflowStep) usesAction(action string) bool {
+	name, _, _ := strings.Cut(step.Uses, "@")
+	return strings.EqualFold(name, action)
+}
+
+// pathsFilters are the filters of a paths-filter step, by name. A filter is
+// nil if it can't be expressed as a list of globs any of which must match.
+type pathsFilters map[string][]string
+
+// get returns the globs of a filter. Outputs are case-insensitive, like the
+// rest of the expression syntax.
+func (pf pathsFilters) get(name string) ([]string, bool) {
+	for filter, globs := range pf {
+		if strings.EqualFold(filter, name) {
+			return globs, true
+		}
+	}
+
+	return nil, false
+}
+
+// isPathsFilterFile checks if a paths-filter step's `filters` input is the
+// path of a file rather than the filters themselves, the same way the action
+// does.
+func isPathsFilterFile(filters string) bool {
+	return !strings.Contains(filters, "\n") && !strings.Contains(filters, ":")
+}
+
+// parsePathsFilters parses the filters of a paths-filter step. Each filter is
+// a glob or a list of them, which can be nested when YAML anchors are used,
+// and can be given for particular kinds of change, like `added|modified`.
+// We treat those as applying to any change, since `changed_files` does.
+//
+// A pattern starting with `!` excludes files. By default, a file passes the
+// filter if it matches any of the patterns, and almost every file matches a
+// negated one, so we can't express the filter. With `predicate-quantifier:
+// every`, a file must match all of them, so we leave the negated patterns out
+// and the filter matches more files than it should, which is safe.
+func parsePathsFilters(contents []byte, every bool) (pathsFilters, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, err
+	}
+
+	filters := make(pathsFilters, len(raw))
+	for name, value := range raw {
+		globs, ok := pathsFilterGlobs(value, every)
+		if !ok {
+			globs = nil
+		}
+		filters[name] = globs
+	}
+
+	return filters, nil
+}
+
+// pathsFilterGlobs flattens a filter's patterns into a list of globs. It
+// returns false if the filter can't be expressed as one (see
+// parsePathsFilters).
+func pathsFilterGlobs(value interface{}, every bool) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		if strings.HasPrefix(v, "!") {
+			return nil, every
+		}
+		return []string{v}, true
+	case []interface{}:
+		var globs []string
+		for _, item := range v {
+			itemGlobs, ok := pathsFilterGlobs(item, every)
+			if !ok {
+				return nil, false
+			}
+			globs = append(globs, itemGlobs...)
+		}
+		return globs, true
+	case map[string]interface{}:
+		var globs []string
+		for _, kind := range slices.Sorted(maps.Keys(v)) {
+			itemGlobs, ok := pathsFilterGlobs(v[kind], every)
+			if !ok {
+				return nil, false
+			}
+			globs = append(globs, itemGlobs...)
+		}
+		return globs, true
+	}
+
+	return nil, false
+}
+
+// ResolvePathsFilters finds the filters of the paths-filter steps in each
+// workflow, reading them from the repository if they are in a file, and
+// returns a copy of the collection with them recorded on the steps. Filters
+// which can't be read or parsed are reported and left out.
+func (workflows GitHubWorkflowCollection) ResolvePathsFilters(root fs.FS) GitHubWorkflowCollection {
+	resolved := make(GitHubWorkflowCollection, len(workflows))
+	for path, wf := range workflows {
+		jobs := make(map[string]gitHubWorkflowJob, len(wf.Jobs))
+		for id, job := range wf.Jobs {
+			steps := make([]gitHubWorkflowStep, len(job.Steps))
+			for i, step := range job.Steps {
+				if step.usesAction(pathsFilterAction) {
+					step.filters = readPathsFilters(root, path, id, step)
+				}
+				steps[i] = step
+			}
+
+			if job.Steps != nil {
+				job.Steps = steps
+			}
+			jobs[id] = job
+		}
+
+		if wf.Jobs != nil {
+			wf.Jobs = jobs
+		}
+		resolved[path] = wf
+	}
+
+	return resolved
+}
+
+// readPathsFilters reads and parses the filters of a paths-filter step.
+func readPathsFilters(root fs.FS, path, job string, step gitHubWorkflowStep) pathsFilters {
+	contents := []byte(step.With["filters"])
+	every := step.With["predicate-quantifier"] == "every"
+
+	if file := strings.TrimSpace(step.With["filters"]); isPathsFilterFile(file) {
+		var err error
+		contents, err = fs.ReadFile(root, strings.TrimPrefix(file, "./"))
+		if err != nil {
+			slog.Warn("failed to read paths-filter filters", "path", Location{Path: path, Pos: step.Pos}, "job", job, "file", file, "error", err)
+			return nil
+		}
+	}
+
+	filters, err := parsePathsFilters(contents, every)
+	if err != nil {
+		slog.Warn("failed to parse paths-filter filters", "path", Location{Path: path, Pos: step.Pos}, "job", job, "error", err)
+		return nil
+	}
+
+	return filters
+}
+
+// onlyFiltersPaths checks if a job does nothing but work out which areas a
+// pull request changes with paths-filter, so that it doesn't count as work
+// the workflow does.
+func (job gitHubWorkflowJob) onlyFiltersPaths() bool {
+	filters := false
+	for _, step := range job.Steps {
+		switch {
+		case step.usesAction(pathsFilterAction):
+			filters = true
+		case step.usesAction(checkoutAction):
+		default:
+			return false
+		}
+	}
+
+	return filters
+}
+
+// pathsFilterOutput is a job output which comes from a paths-filter step.
+// Either it says whether one filter matched, or it is the list of the filters
+// which matched, from the `changes` output.
+type pathsFilterOutput struct {
+	Globs   []string
+	Changes pathsFilters
+}
+
+// pathsFilterOutputs finds the job outputs which come from paths-filter steps,
+// keyed by how later jobs refer to them, like `needs.changes.outputs.backend`.
+func (wf GitHubWorkflow) pathsFilterOutputs() map[string]pathsFilterOutput {
+	outputs := make(map[string]pathsFilterOutput)
+
+	for id, job := range wf.Jobs {
+		for name, value := range job.Outputs {
+			expr, ok := strings.CutPrefix(strings.TrimSpace(value), "${{")
+			if !ok {
+				continue
+			}
+			expr, ok = strings.CutSuffix(expr, "}}")
+			if !ok {
+				continue
+			}
+
+			node, err := parseExpression(strings.TrimSpace(expr))
+			if err != nil {
+				continue
+			}
+
+			path, ok := contextPath(node)
+			if !ok {
+				continue
+			}
+
+			parts := strings.Split(path, ".")
+			if len(parts) != 4 || parts[0] != "steps" || parts[2] != "outputs" {
+				continue
+			}
+
+			for _, step := range job.Steps {
+				if !strings.EqualFold(step.ID, parts[1]) || step.filters == nil {
+					continue
+				}
+
+				key := strings.ToLower("needs." + id + ".outputs." + name)
+				if parts[3] == "changes" {
+					outputs[key] = pathsFilterOutput{Changes: step.filters}
+				} else if globs, ok := step.filters.get(parts[3]); ok {
+					outputs[key] = pathsFilterOutput{Globs: globs}
+				}
+			}
+		}
+	}
+
+	return outputs
+}
@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParsePathsFilters(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filters  string
+		every    bool
+		expected pathsFilters
+	}{
+		{
+			name: "lists and strings",
+			filters: `
+backend:
+  - 'pkg/**'
+  - 'go.mod'
+docs: 'docs/**'
+`,
+			expected: pathsFilters{
+				"backend": {"pkg/**", "go.mod"},
+				"docs":    {"docs/**"},
+			},
+		},
+		{
+			name: "anchors",
+			filters: `
+shared: &shared
+  - 'common/**'
+web:
+  - *shared
+  - 'web/**'
+`,
+			expected: pathsFilters{
+				"shared": {"common/**"},
+				"web":    {"common/**", "web/**"},
+			},
+		},
+		{
+			name: "change types",
+			filters: `
+added:
+  - added: 'migrations/**'
+  - added|modified: ['schema/**']
+`,
+			expected: pathsFilters{
+				"added": {"migrations/**", "schema/**"},
+			},
+		},
+		{
+			name: "negated patterns",
+			filters: `
+code:
+  - '**'
+  - '!**/*.md'
+`,
+			expected: pathsFilters{
+				"code": nil,
+			},
+		},
+		{
+			name: "negated patterns which must all match",
+			filters: `
+code:
+  - '**'
+  - '!**/*.md'
+`,
+			every: true,
+			expected: pathsFilters{
+				"code": {"**"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filters, err := parsePathsFilters([]byte(tc.filters), tc.every)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, filters)
+		})
+	}
+}
+
+// pathsFilterWorkflow is a workflow which works out which areas changed in one
+// job, and runs the others depending on it.
+const pathsFilterWorkflow = `
+on: pull_request
+jobs:
+  changes:
+    outputs:
+      backend: ${{ steps.filter.outputs.backend }}
+      frontend: ${{ steps.filter.outputs.frontend }}
+      changes: ${{ steps.filter.outputs.changes }}
+    steps:
+      - uses: actions/checkout@v4
+      - uses: dorny/paths-filter@v3
+        id: filter
+        with:
+          filters: %s
+  backend:
+    needs: changes
+    if: needs.changes.outputs.backend == 'true'
+  frontend:
+    needs: changes
+    if: ${{ contains(fromJSON(needs.changes.outputs.changes), 'frontend') }}
+  e2e:
+    needs: changes
+    if: needs.changes.outputs.backend == 'true' || needs.changes.outputs.frontend == 'true'
+`
+
+func TestResolvePathsFilters(t *testing.T) {
+	inline := `|
+            backend:
+              - 'pkg/**'
+            frontend:
+              - 'public/**'`
+
+	root := fstest.MapFS{
+		".github/filters.yml": &fstest.MapFile{Data: []byte(`
+backend:
+  - 'pkg/**'
+frontend:
+  - 'public/**'
+`)},
+	}
+
+	expected := []jobGate{
+		{conditionPredicates: conditionPredicates{Paths: []string{"pkg/**"}}},
+		{conditionPredicates: conditionPredicates{Paths: []string{"pkg/**", "public/**"}}},
+		{conditionPredicates: conditionPredicates{Paths: []string{"public/**"}}},
+	}
+
+	for name, filters := range map[string]string{
+		"inline": inline,
+		"file":   ".github/filters.yml",
+	} {
+		t.Run(name, func(t *testing.T) {
+			var wf GitHubWorkflow
+			require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(pathsFilterWorkflow, filters)), &wf))
+
+			wf = GitHubWorkflowCollection{"ci.yml": wf}.ResolvePathsFilters(root)["ci.yml"]
+
+			gates, unmapped := wf.jobGates("pull_request")
+			require.Equal(t, expected, gates)
+			require.Empty(t, unmapped)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		var wf GitHubWorkflow
+		require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(pathsFilterWorkflow, "missing.yml")), &wf))
+
+		wf = GitHubWorkflowCollection{"ci.yml": wf}.ResolvePathsFilters(root)["ci.yml"]
+
+		gates, unmapped := wf.jobGates("pull_request")
+		require.Nil(t, gates)
+		require.Len(t, unmapped, 3)
+	})
+}
+
+func TestMakeApprovalRulesPathsFilter(t *testing.T) {
+	const path = ".github/workflows/ci.yml"
+
+	var wf GitHubWorkflow
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(pathsFilterWorkflow, ".github/filters.yml")), &wf))
+
+	root := fstest.MapFS{
+		".github/filters.yml": &fstest.MapFile{Data: []byte(`
+backend: ['pkg/**']
+frontend: ['public/**']
+`)},
+	}
+	wf = GitHubWorkflowCollection{path: wf}.ResolvePathsFilters(root)[path]
+
+	result, err := makeApprovalRules(path, wf)
+	require.NoError(t, err)
+
+	require.Len(t, result.Rules, 3)
+	require.Equal(t, &predicate.ChangedFiles{Paths: mustRegexpsFromGlobs(t, []string{"pkg/**"})}, result.Rules[0].Predicates.ChangedFiles)
+	require.Equal(t, &predicate.ChangedFiles{Paths: mustRegexpsFromGlobs(t, []string{"pkg/**", "public/**"})}, result.Rules[1].Predicates.ChangedFiles)
+	require.Equal(t, &predicate.ChangedFiles{Paths: mustRegexpsFromGlobs(t, []string{"public/**"})}, result.Rules[2].Predicates.ChangedFiles)
+}
+
+func TestMakeApprovalRulesPathsFilterWithTriggerPaths(t *testing.T) {
+	const path = ".github/workflows/ci.yml"
+
+	root := fstest.MapFS{
+		".github/filters.yml": &fstest.MapFile{Data: []byte(`
+backend: ['pkg/**']
+frontend: ['public/**']
+`)},
+	}
+
+	changedFiles := func(include []string, exclude ...string) *predicate.ChangedFiles {
+		cf := &predicate.ChangedFiles{Paths: mustRegexpsFromGlobs(t, include)}
+		if len(exclude) > 0 {
+			cf.IgnorePaths = mustRegexpsFromGlobs(t, exclude)
+		}
+		return cf
+	}
+
+	tests := []struct {
+		name     string
+		paths    string
+		expected []*predicate.ChangedFiles
+	}{
+		{
+			// The trigger fires whenever any of the gates matches, so each
+			// job is only required for its own area.
+			name:  "broad trigger",
+			paths: "['**', '!docs/**']",
+			expected: []*predicate.ChangedFiles{
+				changedFiles([]string{"pkg/**"}),
+				changedFiles([]string{"pkg/**", "public/**"}),
+				changedFiles([]string{"public/**"}),
+			},
+		},
+		{
+			name:  "trigger covering some gates",
+			paths: "['pkg/**']",
+			expected: []*predicate.ChangedFiles{
+				changedFiles([]string{"pkg/**"}),
+				changedFiles([]string{"pkg/**"}),
+				changedFiles([]string{"pkg/**"}),
+			},
+		},
+		{
+			// An ignored path could be in a gate's area, so the trigger's
+			// filter is needed.
+			name:  "trigger ignoring part of a gate",
+			paths: "['**', '!pkg/generated/**']",
+			expected: []*predicate.ChangedFiles{
+				changedFiles([]string{"**"}, "pkg/generated/**"),
+				changedFiles([]string{"**"}, "pkg/generated/**"),
+				changedFiles([]string{"public/**"}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents := strings.Replace(
+				fmt.Sprintf(pathsFilterWorkflow, ".github/filters.yml"),
+				"on: pull_request",
+				"on:\n  pull_request:\n    paths: "+tt.paths,
+				1,
+			)
+
+			var wf GitHubWorkflow
+			require.NoError(t, yaml.Unmarshal([]byte(contents), &wf))
+			wf = GitHubWorkflowCollection{path: wf}.ResolvePathsFilters(root)[path]
+
+			result, err := makeApprovalRules(path, wf)
+			require.NoError(t, err)
+
+			var actual []*predicate.ChangedFiles
+			for _, rule := range result.Rules {
+				actual = append(actual, rule.Predicates.ChangedFiles)
+			}
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
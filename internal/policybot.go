@@ -1,10 +1,12 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"iter"
 	"log/slog"
+	"reflect"
 	"slices"
 	"strings"
 
@@ -26,6 +28,26 @@ const DefaultToApproval = "default to approval"
 // allow the approval rule.
 var SkippedOrSuccess = predicate.AllowedConclusions{"skipped", "success"}
 
+// SkippedSuccessOrCancelled contains the conclusions we look for in the runs of
+// workflows whose `concurrency` settings cancel runs in progress. When a newer
+// run supersedes one, the older run is left `cancelled`, and policy-bot may see
+// it before the newer run completes, or instead of it.
+var SkippedSuccessOrCancelled = predicate.AllowedConclusions{"cancelled", "skipped", "success"}
+
+// skipsDraftsDescription describes the rules for workflows which skip draft
+// pull requests. policy-bot has no predicate for drafts, so we can't leave these
+// workflows out while the pull request is a draft. The skipped run on a draft
+// satisfies the rule, but there must have been one.
+const skipsDraftsDescription = "The workflow is skipped on draft pull requests. " +
+	"Policy Bot can't tell whether a pull request is a draft, so this is " +
+	"pending until the workflow has run for the latest commit, even if it was skipped."
+
+// afterReviewDescription describes the rules for workflows which run when a
+// review is submitted. policy-bot can't tell whether there has been a review,
+// so the rule is pending until there is one for the latest commit.
+const afterReviewDescription = "The workflow runs when a review is submitted, " +
+	"so this is pending until the latest commit has been reviewed."
+
 // regexpsFromGlobs converts a sequence of glob patterns into a sequence of regular
 // expressions. A conversion is needed because policy-bot takes regular
 // expressions and GitHub Actions workflows use glob patterns.
@@ -83,66 +105,924 @@ func branchRegexp(branches []string) (common.Regexp, error) {
 	return regex, err
 }
 
-func makeApprovalRule(path string, wf GitHubWorkflow) (*approval.Rule, error) {
-	name := fmt.Sprintf("Workflow %s succeeded or skipped", path)
+// conditionRegexp combines the regular expressions of a job condition's branch
+// checks, any of which can match. GitHub compares strings case-insensitively,
+// so we do too.
+func conditionRegexp(patterns []string) (common.Regexp, error) {
+	return common.NewRegexp(fmt.Sprintf("(?i)(%s)", strings.Join(patterns, "|")))
+}
+
+// policyBotPredicates converts the predicates of a job condition into
+// policy-bot's. Checks for drafts have no equivalent, so they are left out.
+func (p conditionPredicates) policyBotPredicates() (predicate.Predicates, error) {
+	var predicates predicate.Predicates
+
+	if len(p.BaseBranches) > 0 {
+		pattern, err := conditionRegexp(p.BaseBranches)
+		if err != nil {
+			return predicate.Predicates{}, fmt.Errorf("couldn't parse base branch condition: %w", err)
+		}
+		predicates.TargetsBranch = &predicate.TargetsBranch{Pattern: pattern}
+	}
+
+	if len(p.HeadBranches) > 0 {
+		pattern, err := conditionRegexp(p.HeadBranches)
+		if err != nil {
+			return predicate.Predicates{}, fmt.Errorf("couldn't parse head branch condition: %w", err)
+		}
+		predicates.FromBranch = &predicate.FromBranch{Pattern: pattern}
+	}
+
+	if len(p.Authors) > 0 {
+		predicates.HasAuthorIn = &predicate.HasAuthorIn{Actors: common.Actors{Users: p.Authors}}
+	}
+
+	if len(p.Labels) > 0 {
+		labels := p.Labels
+		predicates.HasLabels = (*predicate.HasLabels)(&labels)
+	}
+
+	if len(p.Paths) > 0 {
+		paths, err := RegexpsFromGlobs(p.Paths)
+		if err != nil {
+			return predicate.Predicates{}, fmt.Errorf("couldn't parse paths-filter filters: %w", err)
+		}
+		predicates.ChangedFiles = &predicate.ChangedFiles{Paths: paths}
+	}
+
+	return predicates, nil
+}
+
+// workflowRules holds the approval rules generated for a single workflow, and
+// the entry in the approval policy which combines them. For most workflows,
+// this is one rule, referenced by name.
+type workflowRules struct {
+	Rules  []*approval.Rule
+	Policy interface{}
+}
+
+// qualifiedName adds qualifiers to a rule's name when a workflow needs several
+// rules, so that the names are unique. Empty qualifiers are left out.
+func qualifiedName(name string, qualifiers ...string) string {
+	qualifiers = slices.DeleteFunc(qualifiers, func(q string) bool { return q == "" })
+	if len(qualifiers) == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s (%s)", name, strings.Join(qualifiers, ", "))
+}
+
+// partQualifier numbers one of n parts, or returns an empty qualifier if
+// there's only one part.
+func partQualifier(i, n int) string {
+	if n <= 1 {
+		return ""
+	}
+
+	return fmt.Sprintf("part %d", i+1)
+}
+
+// changedFilesPredicate converts a segment of a workflow's path filters into a
+// `changed_files` predicate. It returns nil if the segment matches every file.
+func changedFilesPredicate(segment filterSegment) (*predicate.ChangedFiles, error) {
+	if segment.matchesAll() && len(segment.Exclude) == 0 {
+		return nil, nil
+	}
+
+	include := segment.Include
+	if len(include) == 0 {
+		// A `changed_files` predicate without any paths doesn't match
+		// anything, so we need to be explicit.
+		include = []string{matchAll}
+	}
 
-	pathRegexes, err := RegexpsFromGlobs(wf.paths())
+	pathRegexes, err := RegexpsFromGlobs(include)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't parse path filters: %w", err)
 	}
 
-	ignoreRegexes, err := RegexpsFromGlobs(wf.ignorePaths())
+	ignoreRegexes, err := RegexpsFromGlobs(segment.Exclude)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't parse ignore path filters: %w", err)
 	}
 
-	var preds predicate.Predicates
-	if len(pathRegexes) > 0 || len(ignoreRegexes) > 0 {
-		preds.ChangedFiles = &predicate.ChangedFiles{
-			Paths:       pathRegexes,
-			IgnorePaths: ignoreRegexes,
-		}
+	return &predicate.ChangedFiles{
+		Paths:       pathRegexes,
+		IgnorePaths: ignoreRegexes,
+	}, nil
+}
+
+// targetsBranchPredicate converts a segment of a workflow's branch filters
+// into a `targets_branch` predicate. It returns nil if the segment matches
+// every branch. The segment's excluded branches can't be expressed here: see
+// makeExemptionRule.
+func targetsBranchPredicate(segment filterSegment) (*predicate.TargetsBranch, error) {
+	if segment.matchesAll() {
+		return nil, nil
 	}
 
-	branchRegexp, err := branchRegexp(wf.branches())
+	branchRegexp, err := branchRegexp(segment.Include)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't parse branch filters: %w", err)
 	}
 
-	if branchRegexp != (common.Regexp{}) {
-		preds.TargetsBranch = &predicate.TargetsBranch{
-			Pattern: branchRegexp,
+	return &predicate.TargetsBranch{
+		Pattern: branchRegexp,
+	}, nil
+}
+
+// exemptionQualifier tells a workflow's exemption rules apart from the rules
+// which require it.
+const exemptionQualifier = "not required for ignored branches"
+
+// makeExemptionRule builds a rule which approves when a pull request targets
+// one of the branches excluded from a segment of the workflow's branch
+// filters, by `branches-ignore` or by a `!` pattern. GitHub doesn't run the
+// workflow for those pull requests, so we mustn't wait for it. policy-bot's
+// `targets_branch` predicate can only match branches, not exclude them, and
+// Go's regular expressions can't do lookahead, so the "not targeting" part is
+// expressed in the approval policy instead: the exemption is OR-ed with the
+// workflow's rule. It returns nil if the segment doesn't exclude any branches.
+func makeExemptionRule(name string, segment filterSegment) (*approval.Rule, error) {
+	if len(segment.Exclude) == 0 {
+		return nil, nil
+	}
+
+	branchRegexp, err := branchRegexp(segment.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse ignored branch filters: %w", err)
+	}
+
+	return &approval.Rule{
+		Name: name,
+		Predicates: predicate.Predicates{
+			TargetsBranch: &predicate.TargetsBranch{
+				Pattern: branchRegexp,
+			},
+		},
+	}, nil
+}
+
+// makeExclusionRule builds a rule which approves when a pull request matches
+// one of the exclusions of a job's gate, since the job doesn't run for it. Like
+// an exemption rule, it is OR-ed with the workflow's rule.
+func makeExclusionRule(name string, exclusion gateExclusion) (*approval.Rule, error) {
+	predicates, err := exclusion.Predicates.policyBotPredicates()
+	if err != nil {
+		return nil, err
+	}
+
+	return &approval.Rule{
+		Name:       qualifiedName(name, "not required when "+exclusion.Condition),
+		Predicates: predicates,
+	}, nil
+}
+
+// triggerFilters holds the branch and path filters of one of a workflow's
+// triggers, split into segments. HeadBranches, if set, are the globs the pull
+// request's head branch must match. Gates, if set, are the gates of the
+// workflow's jobs (see jobGates). LargeDiffs says how the path filters apply
+// to large diffs.
+type triggerFilters struct {
+	Event        string
+	Branches     []filterSegment
+	Paths        []filterSegment
+	HeadBranches []string
+	Gates        []jobGate
+	AfterReview  bool
+	LargeDiffs   largeDiffs
+	// Requires replaces what the rules built from the filters require, if it
+	// is set. `workflow_run` runs belong to the default branch's commit, so
+	// the rules for them require the statuses the workflow reports on the pull
+	// request instead of its run.
+	Requires *approval.Requires
+}
+
+// description explains the parts of the filters and of one of their gates
+// which policy-bot can't check itself, for the rules built from them, followed
+// by the explanation of their path predicates, if any.
+func (tf triggerFilters) description(gate jobGate, paths pathPredicates) string {
+	var parts []string
+	if tf.AfterReview {
+		parts = append(parts, afterReviewDescription)
+	}
+	if gate.SkipsDrafts {
+		parts = append(parts, skipsDraftsDescription)
+	}
+	if paths.Description != "" {
+		parts = append(parts, paths.Description)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// equalFilters checks if two triggers have exactly the same filters, in which
+// case they would generate the same rules.
+func (tf triggerFilters) equalFilters(other triggerFilters) bool {
+	return reflect.DeepEqual(tf.Branches, other.Branches) &&
+		reflect.DeepEqual(tf.Paths, other.Paths) &&
+		slices.Equal(tf.HeadBranches, other.HeadBranches) &&
+		slices.EqualFunc(tf.Gates, other.Gates, equalGates) &&
+		tf.AfterReview == other.AfterReview &&
+		tf.LargeDiffs == other.LargeDiffs &&
+		reflect.DeepEqual(tf.Requires, other.Requires)
+}
+
+// pullRequestTriggerFilters returns the filters for each of a workflow's pull
+// request triggers which can result in a run we can rely on. Triggers which
+// don't run on `synchronize`, or whose filters can't match anything, are left
+// out. If gated is true, the filters also record the gates of the workflow's
+// jobs, and the parts of the jobs' conditions which can't be expressed as
+// predicates are reported.
+func pullRequestTriggerFilters(path string, wf GitHubWorkflow, gated bool) []triggerFilters {
+	var triggers []triggerFilters
+
+	var unmapped []unmappedTerm
+	gates := func(event string) []jobGate {
+		if !gated {
+			return nil
+		}
+
+		gates, terms := wf.jobGates(event)
+		for _, term := range terms {
+			if !slices.Contains(unmapped, term) {
+				unmapped = append(unmapped, term)
+			}
+		}
+
+		return gates
+	}
+	defer func() { warnUnmappedTerms(path, unmapped) }()
+
+	for _, trigger := range wf.pullRequestTriggers() {
+		if !trigger.runsOnSynchronize() {
+			slog.Debug("skipping trigger that doesn't run on synchronize", "path", path, "event", trigger.Event)
+			continue
+		}
+
+		filters := triggerFilters{
+			Event:      trigger.Event,
+			Branches:   filterSegments(trigger.Branches, trigger.BranchesIgnore),
+			Paths:      filterSegments(trigger.Paths, trigger.PathsIgnore),
+			Gates:      gates(trigger.Event),
+			LargeDiffs: wf.largeDiffs,
 		}
+
+		if len(filters.Branches) == 0 || len(filters.Paths) == 0 {
+			slog.Debug("trigger filters don't match anything", "path", path, "event", trigger.Event)
+			continue
+		}
+
+		if slices.ContainsFunc(filters.Gates, func(g jobGate) bool { return len(g.Labels) > 0 }) && !trigger.runsOn("labeled") {
+			slog.Warn(
+				"workflow is gated on labels but doesn't run on labeled, it won't run until the next push after a label is added",
+				"path", Location{Path: path, Pos: trigger.Pos},
+				"event", trigger.Event,
+			)
+		}
+
+		if slices.ContainsFunc(filters.Gates, func(g jobGate) bool { return g.SkipsDrafts }) && !trigger.runsOn("ready_for_review") {
+			slog.Warn(
+				"workflow skips drafts but doesn't run on ready_for_review, it won't run until the next push after a draft is marked ready",
+				"path", Location{Path: path, Pos: trigger.Pos},
+				"event", trigger.Event,
+			)
+		}
+
+		triggers = append(triggers, filters)
 	}
 
-	regexPath, err := RegexpsFromGlobs([]string{path})
+	// Reviews can't be filtered by branch or path, so the workflow is required
+	// on every pull request.
+	if wf.IsPullRequestReviewWorkflow() {
+		triggers = append(triggers, triggerFilters{
+			Event:       "pull_request_review",
+			Branches:    []filterSegment{{}},
+			Paths:       []filterSegment{{}},
+			Gates:       gates("pull_request_review"),
+			AfterReview: true,
+		})
+	}
+
+	return triggers
+}
+
+// workflowRunHeadBranches converts a `workflow_run` trigger's branch filters
+// into globs for the pull request's head branch. policy-bot's `from_branch`
+// predicate can't exclude branches, so it returns false if the filters use
+// `branches-ignore` or `!` patterns.
+func workflowRunHeadBranches(wr *gitHubWorkflowOnWorkflowRun) ([]string, bool) {
+	segments := filterSegments(wr.Branches, wr.BranchesIgnore)
+	if len(segments) != 1 || len(segments[0].Exclude) > 0 {
+		return nil, false
+	}
+
+	if segments[0].matchesAll() {
+		return nil, true
+	}
+
+	return segments[0].Include, true
+}
+
+// workflowTriggerFilters returns the filters for each of the workflow's
+// triggers which run it for pull requests: its own pull request triggers, and
+// those of the pull request workflows which trigger it through `workflow_run`.
+// Triggers with exactly the same filters as an earlier one are left out, since
+// they would generate the same rules.
+//
+// Job gates only apply to the workflow's own triggers:
+// `workflow_run` events don't carry the pull request, and the upstream workflow
+// triggers this one even if all of its jobs were skipped.
+//
+// A `workflow_run` run belongs to the default branch's commit, not the pull
+// request's, so policy-bot can't find it. The workflow is only required after
+// its upstream workflows if its `status` directives say which statuses it
+// reports on the pull request's head commit.
+func workflowTriggerFilters(path string, wf GitHubWorkflow) []triggerFilters {
+	triggers := pullRequestTriggerFilters(path, wf, true)
+
+	if len(wf.triggeredBy) > 0 {
+		headBranches, ok := workflowRunHeadBranches(wf.On.WorkflowRun)
+		if !ok {
+			slog.Warn(
+				"can't express workflow_run branch filters, not requiring the workflow after its upstream workflows",
+				"path", Location{Path: path, Pos: wf.TriggerPosition("workflow_run")},
+			)
+			wf.triggeredBy = nil
+		}
+
+		if ok && len(wf.directives.Statuses) == 0 {
+			slog.Warn(
+				"workflow_run runs aren't on the pull request's commit, not requiring the workflow after its upstream workflows; "+
+					"add `status` directives for the statuses it reports on the pull request to require them",
+				"path", Location{Path: path, Pos: wf.TriggerPosition("workflow_run")},
+			)
+			wf.triggeredBy = nil
+		}
+
+		requires := statusRequires(wf.directives.Statuses, wf.conclusions())
+
+		for _, upstream := range wf.triggeredBy {
+			for _, filters := range pullRequestTriggerFilters(upstream.Path, upstream.Workflow, false) {
+				filters.Event = fmt.Sprintf("after %s on %s", upstream.Path, filters.Event)
+				filters.HeadBranches = headBranches
+				// The upstream workflow's path filters decide if this one
+				// runs, but it's this workflow's rules we're building.
+				filters.LargeDiffs = wf.largeDiffs
+				filters.Requires = &requires
+				triggers = append(triggers, filters)
+			}
+		}
+	}
+
+	var deduped []triggerFilters
+	for _, filters := range triggers {
+		if slices.ContainsFunc(deduped, filters.equalFilters) {
+			continue
+		}
+
+		deduped = append(deduped, filters)
+	}
+
+	return deduped
+}
+
+// mergeQueueTriggerFilters returns the filters for each of the workflow's
+// merge queue triggers. Merge queue runs aren't filtered by path: the branch
+// filters are all we have.
+func mergeQueueTriggerFilters(wf GitHubWorkflow) []triggerFilters {
+	var triggers []triggerFilters
+
+	if mg := wf.On.MergeGroup; mg != nil {
+		triggers = append(triggers, triggerFilters{
+			Event:    "merge_group",
+			Branches: filterSegments(mg.Branches, mg.BranchesIgnore),
+			Paths:    []filterSegment{{}},
+		})
+	}
+
+	if branches := wf.mergeQueuePushBranches(); len(branches) > 0 {
+		filters := triggerFilters{
+			Event:    "push",
+			Branches: filterSegments(branches, nil),
+			Paths:    []filterSegment{{}},
+		}
+
+		if !slices.ContainsFunc(triggers, filters.equalFilters) {
+			triggers = append(triggers, filters)
+		}
+	}
+
+	return triggers
+}
+
+// makeApprovalRules builds the approval rules which require a workflow to pass
+// on pull requests. The workflow's directives, and the tool config's overrides
+// (see ApplyToolConfig), can change the rules' names, the conclusions they
+// allow and their predicates, or require the workflow on every pull request.
+func makeApprovalRules(path string, wf GitHubWorkflow) (workflowRules, error) {
+	warnUnwatchedCallees(path, wf)
+	warnUnwatchedLocalActions(path, wf)
+
+	name := wf.approvalRuleName(path)
+
+	triggers := workflowTriggerFilters(path, wf)
+	if wf.directives.Always && len(triggers) > 0 {
+		triggers = unconditionalTriggerFilters
+	}
+
+	rules, err := makeWorkflowRules(
+		path,
+		wf.calleePaths(),
+		name,
+		"",
+		triggers,
+		workflowResultRequires(path, wf.conclusions()),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't convert path to regex: %w", err)
+		return workflowRules{}, err
 	}
 
-	preds.FileNotDeleted = &predicate.FileNotDeleted{
-		Paths: regexPath,
+	if wf.jobStatuses.enabled() {
+		rules = requireJobStatuses(path, wf, rules)
 	}
 
-	requires := approval.Requires{
+	if wf.IsCommentWorkflow() {
+		commentRules, err := makeCommentRules(path, wf)
+		if err != nil {
+			return workflowRules{}, err
+		}
+
+		rules = combineWorkflowRules(rules, commentRules)
+	}
+
+	applyPredicates(wf, rules)
+
+	return rules, nil
+}
+
+// applyPredicates adds the predicates of the workflow's `predicates` directive,
+// and the tool config's overrides, to the rules which require it. Exemption and
+// exclusion rules don't require anything, and the directive's predicates are
+// only meant to narrow down when the workflow is required. The tool config can
+// replace the generated predicates entirely instead.
+func applyPredicates(wf GitHubWorkflow, rules workflowRules) {
+	for _, rule := range rules.Rules {
+		if reflect.ValueOf(rule.Requires).IsZero() {
+			continue
+		}
+
+		if wf.replacePredicates {
+			rule.Predicates = wf.directives.Predicates
+		} else {
+			mergePredicates(&rule.Predicates, wf.directives.Predicates)
+		}
+	}
+}
+
+// unconditionalTriggerFilters are the filters of a workflow which is required
+// on every pull request, because of an `always` directive.
+var unconditionalTriggerFilters = []triggerFilters{{
+	Event:    "pull_request",
+	Branches: []filterSegment{{}},
+	Paths:    []filterSegment{{}},
+}}
+
+// conclusions returns the conclusions the workflow's run and its jobs' check
+// runs may have: those of its `conclusions` directive, or else
+// SkippedSuccessOrCancelled if it cancels superseded runs, or else
+// SkippedOrSuccess.
+func (wf GitHubWorkflow) conclusions() predicate.AllowedConclusions {
+	if len(wf.directives.Conclusions) > 0 {
+		return wf.directives.Conclusions
+	}
+
+	if wf.cancelsSupersededRuns() {
+		return SkippedSuccessOrCancelled
+	}
+
+	return SkippedOrSuccess
+}
+
+// warnUnwatchedCallees reports the reusable workflows which a workflow calls,
+// but whose changes don't trigger it because of its path filters. A pull
+// request which only changes one of them changes what the workflow does, but
+// GitHub doesn't run it, so we can't require it either.
+func warnUnwatchedCallees(path string, wf GitHubWorkflow) {
+	callees := wf.calleePaths()
+
+	for _, trigger := range wf.pullRequestTriggers() {
+		segments := filterSegments(trigger.Paths, trigger.PathsIgnore)
+
+		for _, callee := range callees {
+			if slices.ContainsFunc(segments, func(s filterSegment) bool { return s.matches(callee) }) {
+				continue
+			}
+
+			slog.Warn(
+				"workflow's path filters don't match a reusable workflow it calls, changes to it alone won't run the workflow",
+				"path", Location{Path: path, Pos: trigger.Pos},
+				"event", trigger.Event,
+				"callee", callee,
+			)
+		}
+	}
+}
+
+// workflowResultRequires requires a workflow's run for the pull request's
+// head commit to have one of the conclusions, usually SkippedOrSuccess.
+func workflowResultRequires(path string, conclusions predicate.AllowedConclusions) approval.Requires {
+	return approval.Requires{
 		Conditions: predicate.Predicates{
 			HasWorkflowResult: &predicate.HasWorkflowResult{
-				Conclusions: SkippedOrSuccess,
+				Conclusions: conclusions,
 				Workflows:   []string{path},
 			},
 		},
 	}
+}
 
-	return &approval.Rule{
-		Name:       name,
-		Predicates: preds,
-		Requires:   requires,
+// statusRequires requires the commit statuses or check runs a workflow reports
+// on the pull request's head commit to have one of the conclusions.
+func statusRequires(statuses []string, conclusions predicate.AllowedConclusions) approval.Requires {
+	return approval.Requires{
+		Conditions: predicate.Predicates{
+			HasStatus: &predicate.HasStatus{
+				Conclusions: conclusions,
+				Statuses:    statuses,
+			},
+		},
+	}
+}
+
+// requireJobStatuses adds rules which require the check runs of a workflow's
+// jobs to the rules for the workflow, or replaces them, depending on the
+// workflow's JobStatusMode. If we can't work out the check runs, the workflow's
+// rules are kept as they are.
+func requireJobStatuses(path string, wf GitHubWorkflow, rules workflowRules) workflowRules {
+	// Runs started by `workflow_run` belong to the default branch, so their
+	// check runs aren't on the pull request.
+	if wf.IsWorkflowRunForPullRequest() {
+		slog.Warn(
+			"can't require the jobs of a workflow_run workflow, requiring the whole workflow instead",
+			"path", Location{Path: path, Pos: wf.TriggerPosition("workflow_run")},
+		)
+		return rules
+	}
+
+	jobRules, err := makeJobRules(path, wf)
+	if err != nil {
+		slog.Warn(
+			"can't require the workflow's jobs, requiring the whole workflow instead",
+			"path", Location{Path: path, Pos: ErrorPosition(err)},
+			"error", err,
+		)
+		return rules
+	}
+
+	if wf.jobStatuses == JobStatusesInstead {
+		return jobRules
+	}
+
+	return combineWorkflowRules(rules, jobRules)
+}
+
+// makeJobRules builds the approval rules which require the check runs of each
+// of a workflow's jobs to pass. Each job's rules only apply when the job's own
+// condition lets it run, as far as we can tell (see jobGate).
+func makeJobRules(path string, wf GitHubWorkflow) (workflowRules, error) {
+	names, err := wf.checkRunNames(nil)
+	if err != nil {
+		return workflowRules{}, err
+	}
+
+	triggers := pullRequestTriggerFilters(path, wf, false)
+
+	var result workflowRules
+	for _, id := range sortedJobIDs(wf) {
+		if len(names[id]) == 0 {
+			continue
+		}
+
+		var jobTriggers []triggerFilters
+		for _, trigger := range triggers {
+			gate, runs := wf.jobGate(id, trigger.Event, map[string]bool{})
+			if !runs {
+				continue
+			}
+
+			if !gate.isEmpty() {
+				trigger.Gates = []jobGate{gate}
+			}
+			jobTriggers = append(jobTriggers, trigger)
+		}
+
+		if wf.directives.Always && len(triggers) > 0 {
+			jobTriggers = unconditionalTriggerFilters
+		}
+
+		rules, err := makeWorkflowRules(
+			path,
+			wf.calleePaths(),
+			wf.approvalRuleName(path),
+			"job "+id,
+			jobTriggers,
+			statusRequires(names[id], wf.conclusions()),
+		)
+		if err != nil {
+			return workflowRules{}, err
+		}
+
+		result = combineWorkflowRules(result, rules)
+	}
+
+	return result, nil
+}
+
+// anyConclusion contains every result a status can have, including the empty
+// conclusion of a check run which hasn't finished yet. A `has_status`
+// predicate with all of them matches as soon as the status exists.
+var anyConclusion = predicate.AllowedConclusions{
+	"", "action_required", "cancelled", "error", "failure", "neutral",
+	"pending", "skipped", "stale", "success", "timed_out",
+}
+
+// requestedDescription describes the rules for comment-triggered workflows
+// which are required once they have been requested.
+const requestedDescription = "The workflow is started by a comment. " +
+	"Once it has reported its status on the latest commit, it must pass."
+
+// makeCommentRules builds the approval rule which requires a workflow started
+// by comments to pass. policy-bot looks for workflow runs on the pull
+// request's head commit, but comment-triggered runs belong to the default
+// branch, so we look at the statuses the workflow reports instead. If the
+// workflow has `label` directives, it is required when the pull request has
+// the labels. Otherwise, it is required once it has reported a status on the
+// latest commit.
+func makeCommentRules(path string, wf GitHubWorkflow) (workflowRules, error) {
+	regexPath, err := RegexpsFromGlobs([]string{path})
+	if err != nil {
+		return workflowRules{}, fmt.Errorf("couldn't convert path to regex: %w", err)
+	}
+
+	rule := &approval.Rule{
+		Name: qualifiedName(wf.approvalRuleName(path), "requested by comment"),
+		Predicates: predicate.Predicates{
+			FileNotDeleted: &predicate.FileNotDeleted{
+				Paths: regexPath,
+			},
+		},
+		Requires: statusRequires(wf.directives.Statuses, wf.conclusions()),
+	}
+
+	if labels := wf.directives.Labels; len(labels) > 0 {
+		rule.Predicates.HasLabels = (*predicate.HasLabels)(&labels)
+	} else {
+		rule.Description = requestedDescription
+		rule.Predicates.HasStatus = &predicate.HasStatus{
+			Conclusions: anyConclusion,
+			Statuses:    wf.directives.Statuses,
+		}
+	}
+
+	return workflowRules{
+		Rules:  []*approval.Rule{rule},
+		Policy: rule.Name,
 	}, nil
 }
 
-func (workflows GitHubWorkflowCollection) PolicyBotConfig() policy.Config {
+// combineWorkflowRules combines the rules for different kinds of trigger of
+// the same workflow, or for its jobs. The workflow must pass for all of them.
+// Rules which both have, like exemption rules for the same branches, are only
+// kept once.
+func combineWorkflowRules(a, b workflowRules) workflowRules {
+	switch {
+	case a.Policy == nil:
+		return b
+	case b.Policy == nil:
+		return a
+	}
+
+	rules := slices.Clone(a.Rules)
+	for _, rule := range b.Rules {
+		if !slices.ContainsFunc(rules, func(r *approval.Rule) bool { return r.Name == rule.Name }) {
+			rules = append(rules, rule)
+		}
+	}
+
+	return workflowRules{
+		Rules:  rules,
+		Policy: map[string]interface{}{"and": []interface{}{a.Policy, b.Policy}},
+	}
+}
+
+// makeMergeQueueRules builds the approval rules which require a workflow to
+// pass in the merge queue. They are named like the workflow's pull request
+// rules, with a `merge queue` qualifier, and get the same predicates from its
+// directives and the tool config.
+func makeMergeQueueRules(path string, wf GitHubWorkflow) (workflowRules, error) {
+	rules, err := makeWorkflowRules(
+		path,
+		wf.calleePaths(),
+		wf.approvalRuleName(path),
+		"merge queue",
+		mergeQueueTriggerFilters(wf),
+		workflowResultRequires(path, wf.conclusions()),
+	)
+	if err != nil {
+		return workflowRules{}, err
+	}
+
+	applyPredicates(wf, rules)
+
+	return rules, nil
+}
+
+// makeWorkflowRules builds the approval rules for a workflow. Each of the
+// workflow's triggers has its own filters, and the workflow is required if any
+// of them would fire. GitHub's filters are ordered lists where the last
+// matching pattern wins, which we split into segments (see splitFilter). Each
+// combination of a branch segment and a path segment of a trigger gets its own
+// rule, and so does each gate of the workflow's jobs. A gate's exclusions get
+// exemption rules, like excluded branches do. policy-bot's `and` then requires
+// the workflow if any of the rules applies: it is pending if any rule is
+// pending, and skipped only if every rule is skipped. Each rule requires the
+// conditions in requires, usually the workflow's result, unless its trigger
+// replaces them. The rules are skipped
+// if the pull request deletes the workflow or any of the reusable workflows in
+// callees, since GitHub can't run it then.
+//
+// Every rule's name is the workflow's rule name (see approvalRuleName) with
+// qualifiers: kind, if set, tells apart the rules requiring different things,
+// like a job's rules. Exemption and exclusion rules only depend on the filters,
+// so they don't get kind, and the rules of every kind share them.
+func makeWorkflowRules(path string, callees []string, name, kind string, triggers []triggerFilters, requires approval.Requires) (workflowRules, error) {
+	if len(triggers) == 0 {
+		return workflowRules{}, nil
+	}
+
+	regexPath, err := RegexpsFromGlobs(append([]string{path}, callees...))
+	if err != nil {
+		return workflowRules{}, fmt.Errorf("couldn't convert path to regex: %w", err)
+	}
+
+	var result workflowRules
+	var terms []interface{}
+
+	for _, trigger := range triggers {
+		var event string
+		if len(triggers) > 1 {
+			event = trigger.Event
+		}
+
+		gates := trigger.Gates
+		if len(gates) == 0 {
+			gates = []jobGate{{}}
+		}
+
+		paths, err := trigger.pathPredicates()
+		if err != nil {
+			return workflowRules{}, err
+		}
+
+		nParts := len(trigger.Branches) * len(paths) * len(gates)
+
+		var fromBranch *predicate.FromBranch
+		if len(trigger.HeadBranches) > 0 {
+			pattern, err := branchRegexp(trigger.HeadBranches)
+			if err != nil {
+				return workflowRules{}, fmt.Errorf("couldn't parse head branch filters: %w", err)
+			}
+
+			fromBranch = &predicate.FromBranch{Pattern: pattern}
+		}
+
+		for i, branchSegment := range trigger.Branches {
+			exemptionRule, err := makeExemptionRule(
+				qualifiedName(name, exemptionQualifier, event, partQualifier(i, len(trigger.Branches))),
+				branchSegment,
+			)
+			if err != nil {
+				return workflowRules{}, err
+			}
+
+			if exemptionRule != nil {
+				result.Rules = append(result.Rules, exemptionRule)
+			}
+
+			targetsBranch, err := targetsBranchPredicate(branchSegment)
+			if err != nil {
+				return workflowRules{}, err
+			}
+
+			for j, pathPreds := range paths {
+				for k, gate := range gates {
+					predicates, err := gate.policyBotPredicates()
+					if err != nil {
+						return workflowRules{}, err
+					}
+
+					// The trigger's own filters take precedence: we can't
+					// require both patterns to match, and the job can only
+					// run if the trigger fires.
+					if targetsBranch != nil || predicates.TargetsBranch == nil {
+						predicates.TargetsBranch = targetsBranch
+					}
+					if fromBranch != nil || predicates.FromBranch == nil {
+						predicates.FromBranch = fromBranch
+					}
+					// A paths-filter gate is kept if the trigger's path filter
+					// covers it, though: the trigger then fires whenever the
+					// gate lets the job run.
+					if predicates.ChangedFiles == nil || pathPreds.ChangedFiles != nil && !pathPreds.Segment.covers(gate.Paths) {
+						predicates.ChangedFiles = pathPreds.ChangedFiles
+					}
+					predicates.ModifiedLines = pathPreds.ModifiedLines
+					predicates.FileNotDeleted = &predicate.FileNotDeleted{
+						Paths: regexPath,
+					}
+
+					part := (i*len(paths)+j)*len(gates) + k
+
+					rule := &approval.Rule{
+						Name:       qualifiedName(name, kind, event, partQualifier(part, nParts)),
+						Predicates: predicates,
+						Requires:   requires,
+					}
+					if trigger.Requires != nil {
+						rule.Requires = *trigger.Requires
+					}
+					rule.Description = trigger.description(gate, pathPreds)
+					result.Rules = append(result.Rules, rule)
+
+					var alternatives []interface{}
+					if exemptionRule != nil {
+						// Either the pull request targets an excluded branch,
+						// or the workflow must have passed.
+						alternatives = append(alternatives, exemptionRule.Name)
+					}
+
+					for _, exclusion := range gate.Exclusions {
+						exclusionRule, err := makeExclusionRule(name, exclusion)
+						if err != nil {
+							return workflowRules{}, err
+						}
+
+						if !slices.ContainsFunc(result.Rules, func(r *approval.Rule) bool { return r.Name == exclusionRule.Name }) {
+							result.Rules = append(result.Rules, exclusionRule)
+						}
+
+						alternatives = append(alternatives, exclusionRule.Name)
+					}
+
+					if len(alternatives) == 0 {
+						terms = append(terms, rule.Name)
+						continue
+					}
+
+					terms = append(terms, map[string]interface{}{
+						"or": append(alternatives, rule.Name),
+					})
+				}
+			}
+		}
+	}
+
+	result.Policy = terms[0]
+	if len(terms) > 1 {
+		result.Policy = map[string]interface{}{"and": terms}
+	}
+
+	return result, nil
+}
+
+// PolicyBotConfig builds a policy-bot config which requires the workflows in
+// the collection to pass on pull requests. Workflows whose rules can't be built
+// are reported and left out of the config, and the error joins the problems
+// with each of them. It also returns the part of the config's approval policy
+// which requires each workflow, which other configs can refer to (see
+// ResolveWorkflowReferences).
+func (workflows GitHubWorkflowCollection) PolicyBotConfig() (policy.Config, WorkflowPolicies, error) {
+	return workflows.policyBotConfig(makeApprovalRules)
+}
+
+// MergeQueuePolicyBotConfig builds a policy-bot config which requires the
+// workflows in the collection which run in a merge queue to pass there. It is
+// separate from the pull request config, so that a workflow can be required in
+// the merge queue but not on the pull request. Problems are handled like in
+// PolicyBotConfig.
+func (workflows GitHubWorkflowCollection) MergeQueuePolicyBotConfig() (policy.Config, error) {
+	config, _, err := workflows.policyBotConfig(makeMergeQueueRules)
+	return config, err
+}
+
+func (workflows GitHubWorkflowCollection) policyBotConfig(makeRules func(string, GitHubWorkflow) (workflowRules, error)) (policy.Config, WorkflowPolicies, error) {
 	approvalRules := make([]*approval.Rule, 0, len(workflows))
 	policyApprovals := make([]interface{}, 0, len(workflows))
+	policies := make(WorkflowPolicies)
+
+	var problems []error
+	ruleNames := map[string]bool{DefaultToApproval: true}
 
 	paths := maps.Keys(workflows)
 	slices.Sort(paths)
@@ -153,18 +1033,40 @@ func (workflows GitHubWorkflowCollection) PolicyBotConfig() policy.Config {
 		slog.Debug(
 			"building approval rule",
 			"path", path,
-			"n_path_filters", len(wf.paths()),
-			"n_ignore_path_filters", len(wf.ignorePaths()),
+			"n_triggers", len(wf.pullRequestTriggers()),
 		)
 
-		approvalRule, err := makeApprovalRule(path, wf)
+		if wf.directives.Ignore {
+			slog.Debug("skipping workflow ignored by a directive", "path", path)
+			continue
+		}
+
+		rules, err := makeRules(path, wf)
 		if err != nil {
-			slog.Warn("failed to build approval rule", "path", path, "error", err)
+			err := errBuildRules{Path: path, Err: err}
+			slog.Warn("failed to build approval rule", "path", err.Location(), "error", err.Err)
+			problems = append(problems, err)
 			continue
 		}
 
-		approvalRules = append(approvalRules, approvalRule)
-		policyApprovals = append(policyApprovals, approvalRule.Name)
+		if rules.Policy == nil {
+			continue
+		}
+
+		if i := slices.IndexFunc(rules.Rules, func(r *approval.Rule) bool { return ruleNames[r.Name] }); i >= 0 {
+			err := errBuildRules{Path: path, Err: errDuplicateRuleName{Name: rules.Rules[i].Name}}
+			slog.Warn("failed to build approval rule", "path", err.Location(), "error", err.Err)
+			problems = append(problems, err)
+			continue
+		}
+
+		for _, rule := range rules.Rules {
+			ruleNames[rule.Name] = true
+		}
+
+		approvalRules = append(approvalRules, rules.Rules...)
+		policyApprovals = append(policyApprovals, rules.Policy)
+		policies.add(wf.id(path), path, rules.Policy)
 	}
 
 	var andApprovals approval.Policy
@@ -200,7 +1102,7 @@ func (workflows GitHubWorkflowCollection) PolicyBotConfig() policy.Config {
 
 	slog.Info("built Policy Bot config", "n_workflows", len(approvalRules))
 
-	return config
+	return config, policies, errors.Join(problems...)
 }
 
 func WriteYamlToWriter(w io.Writer, data interface{}) error {
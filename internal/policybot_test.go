@@ -249,19 +249,1234 @@ func TestMakeApprovalRule(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result, err := makeApprovalRule(tc.path, tc.workflow)
+			result, err := makeApprovalRules(tc.path, tc.workflow)
 
 			if tc.expectedErr {
 				require.Error(t, err)
 				return
 			}
 
+			require.NoError(t, err)
+			require.Equal(t, []*approval.Rule{tc.expected}, result.Rules)
+			require.Equal(t, tc.expected.Name, result.Policy)
+		})
+	}
+}
+
+func TestMakeExemptionRule(t *testing.T) {
+	testCases := []struct {
+		name     string
+		segment  filterSegment
+		expected *approval.Rule
+	}{
+		{
+			name: "no excluded branches",
+			segment: filterSegment{
+				Include: []string{"main"},
+			},
+		},
+		{
+			name: "excluded branches",
+			segment: filterSegment{
+				Include: []string{"**"},
+				Exclude: []string{"release/**", "gh-pages"},
+			},
+			expected: &approval.Rule{
+				Name: "exemption",
+				Predicates: predicate.Predicates{
+					TargetsBranch: &predicate.TargetsBranch{
+						Pattern: mustRegexp(t, `(^release\/.*$|^gh-pages$)`),
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := makeExemptionRule("exemption", tc.segment)
 			require.NoError(t, err)
 			require.Equal(t, tc.expected, result)
 		})
 	}
 }
 
+func TestMakeApprovalRulesNegatedPatterns(t *testing.T) {
+	const path = ".github/workflows/test.yml"
+	const name = "Workflow .github/workflows/test.yml succeeded or skipped"
+
+	fileNotDeleted := &predicate.FileNotDeleted{
+		Paths: mustRegexpsFromGlobs(t, []string{path}),
+	}
+	requires := approval.Requires{
+		Conditions: predicate.Predicates{
+			HasWorkflowResult: &predicate.HasWorkflowResult{
+				Conclusions: SkippedOrSuccess,
+				Workflows:   []string{path},
+			},
+		},
+	}
+
+	t.Run("negated paths", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Paths: []string{"docs/**", "!docs/generated/**", "docs/generated/index.md"},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name + " (part 1)",
+				Predicates: predicate.Predicates{
+					ChangedFiles: &predicate.ChangedFiles{
+						Paths:       mustRegexpsFromGlobs(t, []string{"docs/**"}),
+						IgnorePaths: mustRegexpsFromGlobs(t, []string{"docs/generated/**"}),
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+			{
+				Name: name + " (part 2)",
+				Predicates: predicate.Predicates{
+					ChangedFiles: &predicate.ChangedFiles{
+						Paths: mustRegexpsFromGlobs(t, []string{"docs/generated/index.md"}),
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+
+		require.Equal(t, map[string]interface{}{
+			"and": []interface{}{name + " (part 1)", name + " (part 2)"},
+		}, result.Policy)
+	})
+
+	t.Run("paths-ignore", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					PathsIgnore: []string{"docs/**", "!docs/examples/**"},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name + " (part 1)",
+				Predicates: predicate.Predicates{
+					ChangedFiles: &predicate.ChangedFiles{
+						Paths:       mustRegexpsFromGlobs(t, []string{"**"}),
+						IgnorePaths: mustRegexpsFromGlobs(t, []string{"docs/**"}),
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+			{
+				Name: name + " (part 2)",
+				Predicates: predicate.Predicates{
+					ChangedFiles: &predicate.ChangedFiles{
+						Paths: mustRegexpsFromGlobs(t, []string{"docs/examples/**"}),
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+	})
+
+	t.Run("negated branches", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Branches: []string{"release/**", "!release/old-*"},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: "Workflow .github/workflows/test.yml succeeded or skipped (not required for ignored branches)",
+				Predicates: predicate.Predicates{
+					TargetsBranch: &predicate.TargetsBranch{
+						Pattern: mustRegexp(t, `(^release\/old-.*$)`),
+					},
+				},
+			},
+			{
+				Name: name,
+				Predicates: predicate.Predicates{
+					TargetsBranch: &predicate.TargetsBranch{
+						Pattern: mustRegexp(t, `(^release\/.*$)`),
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+
+		require.Equal(t, map[string]interface{}{
+			"or": []interface{}{
+				"Workflow .github/workflows/test.yml succeeded or skipped (not required for ignored branches)",
+				name,
+			},
+		}, result.Policy)
+	})
+
+	t.Run("only negated patterns", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Paths: []string{"!docs/**"},
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, workflowRules{}, result)
+	})
+}
+
+func TestMakeApprovalRulesTriggers(t *testing.T) {
+	const path = ".github/workflows/test.yml"
+	const name = "Workflow .github/workflows/test.yml succeeded or skipped"
+
+	fileNotDeleted := &predicate.FileNotDeleted{
+		Paths: mustRegexpsFromGlobs(t, []string{path}),
+	}
+	requires := approval.Requires{
+		Conditions: predicate.Predicates{
+			HasWorkflowResult: &predicate.HasWorkflowResult{
+				Conclusions: SkippedOrSuccess,
+				Workflows:   []string{path},
+			},
+		},
+	}
+
+	t.Run("triggers with different filters", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Paths: []string{"src/**"},
+				},
+				PullRequestTarget: &gitHubWorkflowOnPullRequest{},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name + " (pull_request)",
+				Predicates: predicate.Predicates{
+					ChangedFiles: &predicate.ChangedFiles{
+						Paths: mustRegexpsFromGlobs(t, []string{"src/**"}),
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+			{
+				Name: name + " (pull_request_target)",
+				Predicates: predicate.Predicates{
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+
+		require.Equal(t, map[string]interface{}{
+			"and": []interface{}{name + " (pull_request)", name + " (pull_request_target)"},
+		}, result.Policy)
+	})
+
+	t.Run("ignore list is not shared between triggers", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Paths: []string{"src/**"},
+				},
+				PullRequestTarget: &gitHubWorkflowOnPullRequest{
+					PathsIgnore: []string{"src/**"},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 2)
+		require.Empty(t, result.Rules[0].Predicates.ChangedFiles.IgnorePaths)
+		require.Equal(t, mustRegexpsFromGlobs(t, []string{"src/**"}), result.Rules[1].Predicates.ChangedFiles.IgnorePaths)
+	})
+
+	t.Run("triggers with the same filters", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest:       &gitHubWorkflowOnPullRequest{},
+				PullRequestTarget: &gitHubWorkflowOnPullRequest{},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name,
+				Predicates: predicate.Predicates{
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+		require.Equal(t, name, result.Policy)
+	})
+
+	t.Run("trigger which doesn't run on synchronize", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Paths: []string{"src/**"},
+					Types: []string{"opened"},
+				},
+				PullRequestTarget: &gitHubWorkflowOnPullRequest{
+					Paths: []string{"docs/**"},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 1)
+		require.Equal(t, name, result.Rules[0].Name)
+		require.Equal(t, mustRegexpsFromGlobs(t, []string{"docs/**"}), result.Rules[0].Predicates.ChangedFiles.Paths)
+	})
+}
+
+func TestMakeApprovalRulesLabels(t *testing.T) {
+	const path = ".github/workflows/e2e.yml"
+	const name = "Workflow .github/workflows/e2e.yml succeeded or skipped"
+
+	fileNotDeleted := &predicate.FileNotDeleted{
+		Paths: mustRegexpsFromGlobs(t, []string{path}),
+	}
+	requires := approval.Requires{
+		Conditions: predicate.Predicates{
+			HasWorkflowResult: &predicate.HasWorkflowResult{
+				Conclusions: SkippedOrSuccess,
+				Workflows:   []string{path},
+			},
+		},
+	}
+
+	t.Run("one label", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Types: []string{"labeled", "synchronize"},
+				},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"e2e": {If: "contains(github.event.pull_request.labels.*.name, 'run-e2e')"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name,
+				Predicates: predicate.Predicates{
+					HasLabels:      &predicate.HasLabels{"run-e2e"},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+		require.Equal(t, name, result.Policy)
+	})
+
+	t.Run("different labels", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Types: []string{"labeled", "synchronize"},
+				},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"e2e":  {If: "contains(github.event.pull_request.labels.*.name, 'run-e2e')"},
+				"perf": {If: "contains(github.event.pull_request.labels.*.name, 'run-perf')"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name + " (part 1)",
+				Predicates: predicate.Predicates{
+					HasLabels:      &predicate.HasLabels{"run-e2e"},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+			{
+				Name: name + " (part 2)",
+				Predicates: predicate.Predicates{
+					HasLabels:      &predicate.HasLabels{"run-perf"},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+		require.Equal(t, map[string]interface{}{
+			"and": []interface{}{name + " (part 1)", name + " (part 2)"},
+		}, result.Policy)
+	})
+
+	t.Run("not gated", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"e2e":  {If: "contains(github.event.pull_request.labels.*.name, 'run-e2e')"},
+				"lint": {},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 1)
+		require.Nil(t, result.Rules[0].Predicates.HasLabels)
+	})
+}
+
+func TestMakeApprovalRulesConditions(t *testing.T) {
+	const path = ".github/workflows/test.yml"
+	const name = "Workflow .github/workflows/test.yml succeeded or skipped"
+
+	fileNotDeleted := &predicate.FileNotDeleted{
+		Paths: mustRegexpsFromGlobs(t, []string{path}),
+	}
+	requires := approval.Requires{
+		Conditions: predicate.Predicates{
+			HasWorkflowResult: &predicate.HasWorkflowResult{
+				Conclusions: SkippedOrSuccess,
+				Workflows:   []string{path},
+			},
+		},
+	}
+
+	t.Run("branches and authors", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"backport": {If: "startsWith(github.base_ref, 'release-') && github.head_ref == 'backport' && github.event.pull_request.user.login == 'grafana-bot'"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name,
+				Predicates: predicate.Predicates{
+					TargetsBranch:  &predicate.TargetsBranch{Pattern: mustRegexp(t, "(?i)(^release-)")},
+					FromBranch:     &predicate.FromBranch{Pattern: mustRegexp(t, "(?i)(^backport$)")},
+					HasAuthorIn:    &predicate.HasAuthorIn{Actors: common.Actors{Users: []string{"grafana-bot"}}},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+		require.Equal(t, name, result.Policy)
+	})
+
+	t.Run("branch filters take precedence", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Branches: []string{"main"},
+				},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"test": {If: "github.base_ref == 'release'"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 1)
+		require.Equal(t, &predicate.TargetsBranch{Pattern: mustRegexp(t, "(^main$)")}, result.Rules[0].Predicates.TargetsBranch)
+	})
+
+	t.Run("exclusions", func(t *testing.T) {
+		const botName = "Workflow .github/workflows/test.yml succeeded or skipped (not required when github.event.pull_request.user.login == 'renovate[bot]')"
+		const labelName = "Workflow .github/workflows/test.yml succeeded or skipped (not required when contains(github.event.pull_request.labels.*.name, 'no-ci'))"
+
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"test": {If: "github.event.pull_request.user.login != 'renovate[bot]' && !contains(github.event.pull_request.labels.*.name, 'no-ci')"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name,
+				Predicates: predicate.Predicates{
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+			{
+				Name: botName,
+				Predicates: predicate.Predicates{
+					HasAuthorIn: &predicate.HasAuthorIn{Actors: common.Actors{Users: []string{"renovate[bot]"}}},
+				},
+			},
+			{
+				Name: labelName,
+				Predicates: predicate.Predicates{
+					HasLabels: &predicate.HasLabels{"no-ci"},
+				},
+			},
+		}, result.Rules)
+		require.Equal(t, map[string]interface{}{
+			"or": []interface{}{botName, labelName, name},
+		}, result.Policy)
+	})
+}
+
+func TestMakeApprovalRulesJobStatuses(t *testing.T) {
+	const path = ".github/workflows/test.yml"
+	const name = "Workflow .github/workflows/test.yml succeeded or skipped"
+	const testName = "Workflow .github/workflows/test.yml succeeded or skipped (job test)"
+	const e2eName = "Workflow .github/workflows/test.yml succeeded or skipped (job e2e)"
+
+	fileNotDeleted := &predicate.FileNotDeleted{
+		Paths: mustRegexpsFromGlobs(t, []string{path}),
+	}
+
+	wf := GitHubWorkflow{
+		On: githubWorkflowHeader{
+			PullRequest: &gitHubWorkflowOnPullRequest{
+				Types: []string{"labeled", "synchronize"},
+			},
+		},
+		Jobs: map[string]gitHubWorkflowJob{
+			"test": {
+				Strategy: &jobStrategy{
+					Matrix: &jobMatrix{
+						Dimensions: []matrixDimension{{Key: "shard", Values: []interface{}{1, 2}}},
+					},
+				},
+			},
+			"e2e": {
+				Name: "End-to-end tests",
+				If:   "contains(github.event.pull_request.labels.*.name, 'run-e2e')",
+			},
+		},
+	}
+
+	jobRules := []*approval.Rule{
+		{
+			Name: e2eName,
+			Predicates: predicate.Predicates{
+				HasLabels:      &predicate.HasLabels{"run-e2e"},
+				FileNotDeleted: fileNotDeleted,
+			},
+			Requires: approval.Requires{
+				Conditions: predicate.Predicates{
+					HasStatus: &predicate.HasStatus{
+						Conclusions: SkippedOrSuccess,
+						Statuses:    []string{"End-to-end tests"},
+					},
+				},
+			},
+		},
+		{
+			Name: testName,
+			Predicates: predicate.Predicates{
+				FileNotDeleted: fileNotDeleted,
+			},
+			Requires: approval.Requires{
+				Conditions: predicate.Predicates{
+					HasStatus: &predicate.HasStatus{
+						Conclusions: SkippedOrSuccess,
+						Statuses:    []string{"test (1)", "test (2)"},
+					},
+				},
+			},
+		},
+	}
+	jobPolicy := map[string]interface{}{"and": []interface{}{e2eName, testName}}
+
+	t.Run("instead", func(t *testing.T) {
+		wf := wf
+		wf.jobStatuses = JobStatusesInstead
+
+		result, err := makeApprovalRules(path, wf)
+		require.NoError(t, err)
+
+		require.Equal(t, jobRules, result.Rules)
+		require.Equal(t, jobPolicy, result.Policy)
+	})
+
+	t.Run("alongside", func(t *testing.T) {
+		wf := wf
+		wf.jobStatuses = JobStatusesAlongside
+
+		result, err := makeApprovalRules(path, wf)
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 3)
+		require.Equal(t, name, result.Rules[0].Name)
+		require.Equal(t, jobRules, result.Rules[1:])
+		require.Equal(t, map[string]interface{}{"and": []interface{}{name, jobPolicy}}, result.Policy)
+	})
+
+	t.Run("unknown check runs", func(t *testing.T) {
+		wf := wf
+		wf.jobStatuses = JobStatusesInstead
+		wf.Jobs = map[string]gitHubWorkflowJob{
+			"test": {Name: "Test ${{ github.head_ref }}"},
+		}
+
+		result, err := makeApprovalRules(path, wf)
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 1)
+		require.Equal(t, name, result.Rules[0].Name)
+	})
+}
+
+func TestMakeApprovalRulesDrafts(t *testing.T) {
+	const path = ".github/workflows/test.yml"
+
+	t.Run("skips drafts", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Types:          []string{"ready_for_review", "synchronize"},
+					BranchesIgnore: []string{"release/**"},
+				},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"test": {If: "github.event.pull_request.draft == false"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 2)
+		// The exemption rule doesn't need a description.
+		require.Empty(t, result.Rules[0].Description)
+		require.Equal(t, skipsDraftsDescription, result.Rules[1].Description)
+	})
+
+	t.Run("runs on drafts", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"test": {},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 1)
+		require.Empty(t, result.Rules[0].Description)
+	})
+}
+
+func TestMakeApprovalRulesPullRequestReview(t *testing.T) {
+	const path = ".github/workflows/review.yml"
+	const name = "Workflow .github/workflows/review.yml succeeded or skipped"
+
+	fileNotDeleted := &predicate.FileNotDeleted{
+		Paths: mustRegexpsFromGlobs(t, []string{path}),
+	}
+	requires := approval.Requires{
+		Conditions: predicate.Predicates{
+			HasWorkflowResult: &predicate.HasWorkflowResult{
+				Conclusions: SkippedOrSuccess,
+				Workflows:   []string{path},
+			},
+		},
+	}
+
+	t.Run("review only", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequestReview: &gitHubWorkflowOnPullRequestReview{
+					Types: []string{"submitted"},
+				},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"e2e": {If: "github.event.pull_request.draft == false"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name:        name,
+				Description: afterReviewDescription + " " + skipsDraftsDescription,
+				Predicates: predicate.Predicates{
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+		require.Equal(t, name, result.Policy)
+	})
+
+	t.Run("review and pull request", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Paths: []string{"src/**"},
+				},
+				PullRequestReview: &gitHubWorkflowOnPullRequestReview{},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name + " (pull_request)",
+				Predicates: predicate.Predicates{
+					ChangedFiles: &predicate.ChangedFiles{
+						Paths: mustRegexpsFromGlobs(t, []string{"src/**"}),
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+			{
+				Name:        name + " (pull_request_review)",
+				Description: afterReviewDescription,
+				Predicates: predicate.Predicates{
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+	})
+
+	t.Run("review types which don't include submitted", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequestReview: &gitHubWorkflowOnPullRequestReview{
+					Types: []string{"dismissed"},
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, workflowRules{}, result)
+	})
+}
+
+func TestMakeApprovalRulesComment(t *testing.T) {
+	const path = ".github/workflows/integration.yml"
+	const name = "Workflow .github/workflows/integration.yml succeeded or skipped (requested by comment)"
+
+	fileNotDeleted := &predicate.FileNotDeleted{
+		Paths: mustRegexpsFromGlobs(t, []string{path}),
+	}
+	requires := approval.Requires{
+		Conditions: predicate.Predicates{
+			HasStatus: &predicate.HasStatus{
+				Conclusions: SkippedOrSuccess,
+				Statuses:    []string{"integration"},
+			},
+		},
+	}
+
+	t.Run("required once requested", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				IssueComment: &gitHubWorkflowOnIssueComment{},
+			},
+			directives: workflowDirectives{
+				Statuses: []string{"integration"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name:        name,
+				Description: requestedDescription,
+				Predicates: predicate.Predicates{
+					HasStatus: &predicate.HasStatus{
+						Conclusions: anyConclusion,
+						Statuses:    []string{"integration"},
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+		require.Equal(t, name, result.Policy)
+	})
+
+	t.Run("required with a label", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				IssueComment: &gitHubWorkflowOnIssueComment{},
+			},
+			directives: workflowDirectives{
+				Statuses: []string{"integration"},
+				Labels:   []string{"run-integration"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name,
+				Predicates: predicate.Predicates{
+					HasLabels:      &predicate.HasLabels{"run-integration"},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+	})
+
+	t.Run("also a pull request workflow", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest:  &gitHubWorkflowOnPullRequest{},
+				IssueComment: &gitHubWorkflowOnIssueComment{},
+			},
+			directives: workflowDirectives{
+				Statuses: []string{"integration"},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 2)
+		require.Equal(t, map[string]interface{}{
+			"and": []interface{}{
+				"Workflow .github/workflows/integration.yml succeeded or skipped",
+				name,
+			},
+		}, result.Policy)
+	})
+
+	t.Run("no status directive", func(t *testing.T) {
+		result, err := makeApprovalRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				IssueComment: &gitHubWorkflowOnIssueComment{},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, workflowRules{}, result)
+	})
+}
+
+func TestMakeApprovalRulesWorkflowRun(t *testing.T) {
+	const path = ".github/workflows/coverage.yml"
+	const name = "Workflow .github/workflows/coverage.yml succeeded or skipped"
+
+	ci := GitHubWorkflow{
+		Name: "CI",
+		On: githubWorkflowHeader{
+			PullRequest: &gitHubWorkflowOnPullRequest{
+				Paths:    []string{"src/**"},
+				Branches: []string{"main"},
+			},
+		},
+	}
+
+	t.Run("upstream filters are used", func(t *testing.T) {
+		workflows := GitHubWorkflowCollection{
+			".github/workflows/ci.yml": ci,
+			path: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					WorkflowRun: &gitHubWorkflowOnWorkflowRun{
+						Workflows: []string{"CI"},
+						Branches:  []string{"renovate/**"},
+					},
+				},
+				directives: workflowDirectives{Statuses: []string{"coverage"}},
+			},
+		}.ResolveWorkflowRuns()
+
+		result, err := makeApprovalRules(path, workflows[path])
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name,
+				Predicates: predicate.Predicates{
+					ChangedFiles: &predicate.ChangedFiles{
+						Paths: mustRegexpsFromGlobs(t, []string{"src/**"}),
+					},
+					TargetsBranch: &predicate.TargetsBranch{
+						Pattern: mustRegexp(t, "(^main$)"),
+					},
+					FromBranch: &predicate.FromBranch{
+						Pattern: mustRegexp(t, `(^renovate\/.*$)`),
+					},
+					FileNotDeleted: &predicate.FileNotDeleted{
+						Paths: mustRegexpsFromGlobs(t, []string{path}),
+					},
+				},
+				Requires: approval.Requires{
+					Conditions: predicate.Predicates{
+						HasStatus: &predicate.HasStatus{
+							Conclusions: SkippedOrSuccess,
+							Statuses:    []string{"coverage"},
+						},
+					},
+				},
+			},
+		}, result.Rules)
+	})
+
+	t.Run("no statuses on the pull request", func(t *testing.T) {
+		workflows := GitHubWorkflowCollection{
+			".github/workflows/ci.yml": ci,
+			path: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					PullRequest: &gitHubWorkflowOnPullRequest{},
+					WorkflowRun: &gitHubWorkflowOnWorkflowRun{
+						Workflows: []string{"CI"},
+					},
+				},
+			},
+		}.ResolveWorkflowRuns()
+
+		// Only the workflow's own trigger is required, through its run.
+		result, err := makeApprovalRules(path, workflows[path])
+		require.NoError(t, err)
+		require.Len(t, result.Rules, 1)
+		require.Equal(t, name, result.Rules[0].Name)
+		require.Equal(t, workflowResultRequires(path, SkippedOrSuccess), result.Rules[0].Requires)
+
+		workflows[path] = GitHubWorkflow{
+			On: githubWorkflowHeader{
+				WorkflowRun: &gitHubWorkflowOnWorkflowRun{Workflows: []string{"CI"}},
+			},
+		}
+
+		result, err = makeApprovalRules(path, workflows.ResolveWorkflowRuns()[path])
+		require.NoError(t, err)
+		require.Equal(t, workflowRules{}, result)
+	})
+
+	t.Run("head branch filters that can't be expressed", func(t *testing.T) {
+		workflows := GitHubWorkflowCollection{
+			".github/workflows/ci.yml": ci,
+			path: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					WorkflowRun: &gitHubWorkflowOnWorkflowRun{
+						Workflows:      []string{"CI"},
+						BranchesIgnore: []string{"renovate/**"},
+					},
+				},
+			},
+		}.ResolveWorkflowRuns()
+
+		result, err := makeApprovalRules(path, workflows[path])
+		require.NoError(t, err)
+		require.Equal(t, workflowRules{}, result)
+	})
+}
+
+func TestMakeApprovalRulesReusableWorkflows(t *testing.T) {
+	const path = ".github/workflows/ci.yml"
+
+	workflows := GitHubWorkflowCollection{
+		path: GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					Paths: []string{"src/**"},
+				},
+			},
+			Jobs: map[string]gitHubWorkflowJob{
+				"build": {Uses: "./.github/workflows/_build.yml"},
+				"test":  {Uses: "./.github/workflows/_test.yml"},
+			},
+		},
+		".github/workflows/_build.yml": GitHubWorkflow{
+			Jobs: map[string]gitHubWorkflowJob{
+				"lint": {Uses: "./.github/workflows/_lint.yml"},
+			},
+		},
+		".github/workflows/_test.yml": GitHubWorkflow{
+			Jobs: map[string]gitHubWorkflowJob{
+				"lint": {Uses: "./.github/workflows/_lint.yml"},
+			},
+		},
+		".github/workflows/_lint.yml": GitHubWorkflow{},
+	}.ResolveReusableWorkflows()
+
+	result, err := makeApprovalRules(path, workflows[path])
+	require.NoError(t, err)
+
+	require.Len(t, result.Rules, 1)
+	require.Equal(t, &predicate.ChangedFiles{
+		Paths: mustRegexpsFromGlobs(t, []string{"src/**"}),
+	}, result.Rules[0].Predicates.ChangedFiles)
+	require.Equal(t, &predicate.FileNotDeleted{
+		Paths: mustRegexpsFromGlobs(t, []string{
+			path,
+			".github/workflows/_build.yml",
+			".github/workflows/_lint.yml",
+			".github/workflows/_test.yml",
+		}),
+	}, result.Rules[0].Predicates.FileNotDeleted)
+}
+
+func TestMakeApprovalRulesDirectives(t *testing.T) {
+	const path = ".github/workflows/ci.yml"
+
+	const workflow = `
+on:
+  pull_request:
+    branches: [main]
+    paths: ['src/**']
+`
+
+	parse := func(t *testing.T, directives string) GitHubWorkflow {
+		t.Helper()
+
+		wf, err := ParseWorkflow([]byte(directives + workflow))
+		require.NoError(t, err)
+		return wf
+	}
+
+	t.Run("name, conclusions and predicates", func(t *testing.T) {
+		wf := parse(t, `# generate-policy-bot-config: name=CI must pass
+# generate-policy-bot-config: conclusion=success
+# generate-policy-bot-config: predicates={has_labels: [ready], targets_branch: {pattern: '^release$'}}
+`)
+
+		result, err := makeApprovalRules(path, wf)
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: "CI must pass",
+				Predicates: predicate.Predicates{
+					ChangedFiles: &predicate.ChangedFiles{
+						Paths: mustRegexpsFromGlobs(t, []string{"src/**"}),
+					},
+					TargetsBranch: &predicate.TargetsBranch{
+						Pattern: mustRegexp(t, "^release$"),
+					},
+					HasLabels: &predicate.HasLabels{"ready"},
+					FileNotDeleted: &predicate.FileNotDeleted{
+						Paths: mustRegexpsFromGlobs(t, []string{path}),
+					},
+				},
+				Requires: approval.Requires{
+					Conditions: predicate.Predicates{
+						HasWorkflowResult: &predicate.HasWorkflowResult{
+							Conclusions: predicate.AllowedConclusions{"success"},
+							Workflows:   []string{path},
+						},
+					},
+				},
+			},
+		}, result.Rules)
+		require.Equal(t, "CI must pass", result.Policy)
+	})
+
+	t.Run("always", func(t *testing.T) {
+		wf := parse(t, "# generate-policy-bot-config: always\n")
+
+		result, err := makeApprovalRules(path, wf)
+		require.NoError(t, err)
+
+		require.Len(t, result.Rules, 1)
+		require.Equal(t, predicate.Predicates{
+			FileNotDeleted: &predicate.FileNotDeleted{
+				Paths: mustRegexpsFromGlobs(t, []string{path}),
+			},
+		}, result.Rules[0].Predicates)
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		config, _, err := GitHubWorkflowCollection{
+			path: parse(t, "# generate-policy-bot-config: ignore\n"),
+		}.PolicyBotConfig()
+		require.NoError(t, err)
+
+		require.Empty(t, config.ApprovalRules)
+	})
+}
+
+func TestMakeApprovalRulesCancelInProgress(t *testing.T) {
+	const path = ".github/workflows/ci.yml"
+
+	wf, err := ParseWorkflow([]byte(`
+on: pull_request
+concurrency:
+  group: ci-${{ github.head_ref }}
+  cancel-in-progress: true
+`))
+	require.NoError(t, err)
+
+	result, err := makeApprovalRules(path, wf)
+	require.NoError(t, err)
+	require.Len(t, result.Rules, 1)
+	require.Equal(t, SkippedSuccessOrCancelled, result.Rules[0].Requires.Conditions.HasWorkflowResult.Conclusions)
+
+	// A directive still decides.
+	wf.directives.Conclusions = []string{"success"}
+
+	result, err = makeApprovalRules(path, wf)
+	require.NoError(t, err)
+	require.Equal(t, predicate.AllowedConclusions{"success"}, result.Rules[0].Requires.Conditions.HasWorkflowResult.Conclusions)
+}
+
+func TestMakeMergeQueueRules(t *testing.T) {
+	const path = ".github/workflows/test.yml"
+	const name = "Workflow .github/workflows/test.yml succeeded or skipped"
+
+	fileNotDeleted := &predicate.FileNotDeleted{
+		Paths: mustRegexpsFromGlobs(t, []string{path}),
+	}
+	requires := approval.Requires{
+		Conditions: predicate.Predicates{
+			HasWorkflowResult: &predicate.HasWorkflowResult{
+				Conclusions: SkippedOrSuccess,
+				Workflows:   []string{path},
+			},
+		},
+	}
+
+	t.Run("not a merge queue workflow", func(t *testing.T) {
+		result, err := makeMergeQueueRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, workflowRules{}, result)
+	})
+
+	t.Run("merge_group and push", func(t *testing.T) {
+		result, err := makeMergeQueueRules(path, GitHubWorkflow{
+			On: githubWorkflowHeader{
+				MergeGroup: &gitHubWorkflowOnMergeGroup{
+					Branches: []string{"main"},
+				},
+				Push: &gitHubWorkflowOnPush{
+					Branches: []string{"gh-readonly-queue/release/**"},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []*approval.Rule{
+			{
+				Name: name + " (merge queue, merge_group)",
+				Predicates: predicate.Predicates{
+					TargetsBranch: &predicate.TargetsBranch{
+						Pattern: mustRegexp(t, "(^main$)"),
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+			{
+				Name: name + " (merge queue, push)",
+				Predicates: predicate.Predicates{
+					TargetsBranch: &predicate.TargetsBranch{
+						Pattern: mustRegexp(t, "(^release$)"),
+					},
+					FileNotDeleted: fileNotDeleted,
+				},
+				Requires: requires,
+			},
+		}, result.Rules)
+	})
+}
+
+func TestGitHubWorkflowCollectionMergeQueuePolicyBotConfig(t *testing.T) {
+	workflows := GitHubWorkflowCollection{
+		".github/workflows/pr.yml": GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{},
+			},
+		},
+		".github/workflows/queue.yml": GitHubWorkflow{
+			On: githubWorkflowHeader{
+				MergeGroup: &gitHubWorkflowOnMergeGroup{},
+			},
+		},
+	}
+
+	result, err := workflows.MergeQueuePolicyBotConfig()
+	require.NoError(t, err)
+
+	require.Equal(t, approval.Policy{
+		map[string]interface{}{
+			"or": []interface{}{
+				map[string]interface{}{
+					"and": []interface{}{
+						"Workflow .github/workflows/queue.yml succeeded or skipped (merge queue)",
+						DefaultToApproval,
+					},
+				},
+			},
+		},
+	}, result.Policy.Approval)
+
+	prResult, _, err := workflows.PolicyBotConfig()
+	require.NoError(t, err)
+	require.Len(t, prResult.ApprovalRules, 2)
+	require.Equal(t, "Workflow .github/workflows/pr.yml succeeded or skipped", prResult.ApprovalRules[0].Name)
+}
+
+func TestGitHubWorkflowCollectionPolicyBotConfigBranchesIgnore(t *testing.T) {
+	workflows := GitHubWorkflowCollection{
+		".github/workflows/test.yml": GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest: &gitHubWorkflowOnPullRequest{
+					BranchesIgnore: []string{"release/**"},
+				},
+			},
+		},
+	}
+
+	result, _, err := workflows.PolicyBotConfig()
+	require.NoError(t, err)
+
+	require.Equal(t, approval.Policy{
+		map[string]interface{}{
+			"or": []interface{}{
+				map[string]interface{}{
+					"and": []interface{}{
+						map[string]interface{}{
+							"or": []interface{}{
+								"Workflow .github/workflows/test.yml succeeded or skipped (not required for ignored branches)",
+								"Workflow .github/workflows/test.yml succeeded or skipped",
+							},
+						},
+						DefaultToApproval,
+					},
+				},
+			},
+		},
+	}, result.Policy.Approval)
+
+	require.Len(t, result.ApprovalRules, 3)
+	require.Equal(t, "Workflow .github/workflows/test.yml succeeded or skipped (not required for ignored branches)", result.ApprovalRules[0].Name)
+	require.Equal(t, "Workflow .github/workflows/test.yml succeeded or skipped", result.ApprovalRules[1].Name)
+	require.Nil(t, result.ApprovalRules[1].Predicates.TargetsBranch)
+	require.Equal(t, DefaultToApproval, result.ApprovalRules[2].Name)
+}
+
 func TestGitHubWorkflowCollectionPolicyBotConfig(t *testing.T) {
 	workflows := GitHubWorkflowCollection{
 		".github/workflows/test.yml": GitHubWorkflow{
@@ -336,7 +1551,8 @@ func TestGitHubWorkflowCollectionPolicyBotConfig(t *testing.T) {
 		},
 	}
 
-	result := workflows.PolicyBotConfig()
+	result, _, err := workflows.PolicyBotConfig()
+	require.NoError(t, err)
 
 	require.Equal(t, expected, result)
 
@@ -366,7 +1582,7 @@ func BenchmarkMakeApprovalRule(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := makeApprovalRule(path, workflow)
+		_, err := makeApprovalRules(path, workflow)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -403,6 +1619,6 @@ on:
 		// We're not checking the result, just ensuring it doesn't panic
 		_ = yaml.Unmarshal(yamlData, &wf)
 
-		_, _ = makeApprovalRule(path, wf)
+		_, _ = makeApprovalRules(path, wf)
 	})
 }
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"fmt"
+	"log/slog"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Position is a location in a workflow file. Lines and columns start at 1. The
+// zero value means the position isn't known, for example because the element
+// was built in code rather than parsed.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// positionOf returns the position of a YAML node.
+func positionOf(node *yaml.Node) Position {
+	return Position{Line: node.Line, Column: node.Column}
+}
+
+// IsValid checks if the position is known.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Location is a position in one of the repository's files, like a workflow.
+type Location struct {
+	Path string
+	Pos  Position
+}
+
+// String renders the location like `path:line:col`, the way compilers do, so
+// that editors and terminals can link to it. The position is left out if it
+// isn't known, and so is the column if only the line is.
+func (l Location) String() string {
+	switch {
+	case !l.Pos.IsValid():
+		return l.Path
+	case l.Pos.Column <= 0:
+		return fmt.Sprintf("%s:%d", l.Path, l.Pos.Line)
+	}
+
+	return fmt.Sprintf("%s:%s", l.Path, l.Pos)
+}
+
+// LogValue implements slog.LogValuer, so that locations are logged the same
+// way they are printed.
+func (l Location) LogValue() slog.Value {
+	return slog.StringValue(l.String())
+}
+
+// mappingValue returns the value for a key in a mapping node, and the key's
+// node. It returns nil if the node isn't a mapping or doesn't have the key.
+func mappingValue(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1], node.Content[i]
+		}
+	}
+
+	return nil, nil
+}
+
+// keyPositions returns the positions of the keys of a mapping node.
+func keyPositions(node *yaml.Node) map[string]Position {
+	positions := make(map[string]Position)
+	if node.Kind != yaml.MappingNode {
+		return positions
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		positions[node.Content[i].Value] = positionOf(node.Content[i])
+	}
+
+	return positions
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// clearPositions zeroes all the positions in a parsed value, so tests which
+// aren't about positions can compare it with a value built in code.
+func clearPositions[T any](v T) T {
+	clearPositionsValue(reflect.ValueOf(&v).Elem())
+	return v
+}
+
+func clearPositionsValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			clearPositionsValue(v.Elem())
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(Position{}) {
+			if v.CanSet() {
+				v.SetZero()
+			}
+			return
+		}
+
+		for i := range v.NumField() {
+			if v.Field(i).CanSet() {
+				clearPositionsValue(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			clearPositionsValue(v.Index(i))
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			clearPositionsValue(elem)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+}
+
+func TestWorkflowPositions(t *testing.T) {
+	var wf GitHubWorkflow
+	err := yaml.Unmarshal([]byte(`name: CI
+on:
+  pull_request:
+    paths: [src/**]
+  push:
+jobs:
+  build:
+    environment: production
+    concurrency:
+      group: build
+      cancel-in-progress: true
+    strategy:
+      matrix:
+        os: [ubuntu-latest, macos-latest]
+    steps:
+      - uses: actions/checkout@v4
+      - run: make
+`), &wf)
+	require.NoError(t, err)
+
+	require.Equal(t, Position{Line: 3, Column: 3}, wf.On.PullRequest.Pos)
+	require.Equal(t, Position{Line: 5, Column: 3}, wf.On.Push.Pos)
+
+	job := wf.Jobs["build"]
+	require.Equal(t, Position{Line: 7, Column: 3}, job.Pos)
+	require.Equal(t, Position{Line: 8, Column: 18}, job.Environment.Pos)
+	require.Equal(t, Position{Line: 10, Column: 7}, job.Concurrency.Pos)
+	require.Equal(t, Position{Line: 13, Column: 7}, job.Strategy.Pos)
+	require.Equal(t, Position{Line: 14, Column: 9}, job.Strategy.Matrix.Pos)
+	require.Equal(t, Position{Line: 14, Column: 9}, job.Strategy.Matrix.Dimensions[0].Pos)
+	require.Equal(t, Position{Line: 16, Column: 9}, job.Steps[0].Pos)
+	require.Equal(t, Position{Line: 17, Column: 9}, job.Steps[1].Pos)
+}
+
+func TestWorkflowPositionsOnList(t *testing.T) {
+	var wf GitHubWorkflow
+	err := yaml.Unmarshal([]byte("on: [push, pull_request]\n"), &wf)
+	require.NoError(t, err)
+
+	require.Equal(t, Position{Line: 1, Column: 5}, wf.On.Pos)
+	require.Equal(t, Position{Line: 1, Column: 6}, wf.On.Push.Pos)
+	require.Equal(t, Position{Line: 1, Column: 12}, wf.On.PullRequest.Pos)
+	require.Equal(t, "1:12", wf.On.PullRequest.Pos.String())
+	require.True(t, wf.On.PullRequest.Pos.IsValid())
+	require.False(t, Position{}.IsValid())
+}
+
+func TestErrorPosition(t *testing.T) {
+	testCases := []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{
+			name:     "unexpected type for on",
+			contents: "on: 42\n",
+			expected: "invalid workflow file ci.yml:1:5: unexpected type for workflow `on`. got: int. expected: string, list or map",
+		},
+		{
+			name: "unexpected matrix type",
+			contents: `on: pull_request
+jobs:
+  build:
+    strategy:
+      matrix:
+        os: {ubuntu: true}
+`,
+			expected: "invalid workflow file ci.yml:6:13: unexpected type in `strategy.matrix`. expected: expression, list or map",
+		},
+		{
+			name: "wrong type in a trigger",
+			contents: `on:
+  pull_request:
+    branches: {main: true}
+`,
+			expected: "invalid workflow file ci.yml:3: failed to parse workflow: yaml: unmarshal errors:\n  line 3: cannot unmarshal !!map into []string",
+		},
+		{
+			name:     "syntax error",
+			contents: "on: [pull_request\n",
+			expected: "invalid workflow file ci.yml:1: yaml: line 1: did not find expected ',' or ']'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseWorkflow([]byte(tc.contents))
+			require.Error(t, err)
+
+			require.EqualError(t, ErrInvalidWorkflow{Path: "ci.yml", Err: err}, tc.expected)
+		})
+	}
+
+	t.Run("invalid directive", func(t *testing.T) {
+		wf, err := ParseWorkflow([]byte("on: issue_comment\n  # generate-policy-bot-config: colour=blue\n"))
+		require.NoError(t, err)
+		require.Len(t, wf.InvalidDirectives(), 1)
+
+		require.EqualError(t, ErrInvalidWorkflow{Path: "ci.yml", Err: wf.InvalidDirectives()[0]},
+			"invalid workflow file ci.yml:2:3: invalid directive `colour=blue`. expected `ignore`, `always`, `status=<name>`, `label=<name>`, "+
+				"`conclusion=<conclusion>`, `name=<rule name>`, `id=<ID>` or `predicates=<YAML>`")
+	})
+}
+
+func TestLocationString(t *testing.T) {
+	require.Equal(t, "ci.yml", Location{Path: "ci.yml"}.String())
+	require.Equal(t, "ci.yml:3", Location{Path: "ci.yml", Pos: Position{Line: 3}}.String())
+	require.Equal(t, "ci.yml:3:5", Location{Path: "ci.yml", Pos: Position{Line: 3, Column: 5}}.String())
+}
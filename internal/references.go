@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
+	"gopkg.in/yaml.v3"
+)
+
+// WorkflowReferencePrefix marks a reference to the rules which require a
+// workflow, by the workflow's ID, in the approval policy of a config merged
+// with the generated one, like `workflow:ci`.
+const WorkflowReferencePrefix = "workflow:"
+
+// workflowIDPattern matches the IDs workflows can declare.
+var workflowIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// WorkflowID returns the ID of the workflow at the given path, unless it
+// declares its own: the file's name without its extension, like `ci` for
+// `.github/workflows/ci.yml`.
+func WorkflowID(p string) string {
+	base := path.Base(p)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// id returns the workflow's ID: the one its `id` directive declares, or else
+// the one its path gives it.
+func (wf GitHubWorkflow) id(p string) string {
+	if wf.directives.ID != "" {
+		return wf.directives.ID
+	}
+
+	return WorkflowID(p)
+}
+
+// WorkflowPolicies holds the part of a generated approval policy which
+// requires each workflow, keyed by the workflow's ID. An ID which several
+// workflows have maps to nil, since references to it would be ambiguous.
+type WorkflowPolicies map[string]interface{}
+
+// add records the policy which requires the workflow with the given ID and
+// path.
+func (wp WorkflowPolicies) add(id, path string, entry interface{}) {
+	if _, ok := wp[id]; ok {
+		slog.Warn("several workflows have the same ID, references to it won't resolve", "path", Location{Path: path}, "id", id)
+		wp[id] = nil
+		return
+	}
+
+	wp[id] = entry
+}
+
+// ResolveWorkflowReferences returns a copy of the config in which each
+// reference to a workflow's rules in its approval policy, like `workflow:ci`,
+// is replaced by the part of the generated policy which requires that
+// workflow. It fails if a reference doesn't identify exactly one generated
+// workflow, so that references to workflows which were renamed or removed
+// don't go unnoticed.
+func ResolveWorkflowReferences(config policy.Config, policies WorkflowPolicies) (policy.Config, error) {
+	var resolve func(value interface{}) (interface{}, error)
+	resolve = func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			id, ok := strings.CutPrefix(v, WorkflowReferencePrefix)
+			if !ok {
+				return v, nil
+			}
+
+			entry, ok := policies[id]
+			if !ok {
+				return nil, errWorkflowReference{Reference: v, Reason: "no generated workflow has this ID"}
+			}
+			if entry == nil {
+				return nil, errWorkflowReference{Reference: v, Reason: "several generated workflows have this ID"}
+			}
+
+			return entry, nil
+		case []interface{}:
+			resolved := make([]interface{}, len(v))
+			for i, item := range v {
+				var err error
+				if resolved[i], err = resolve(item); err != nil {
+					return nil, err
+				}
+			}
+
+			return resolved, nil
+		case map[string]interface{}:
+			resolved := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				var err error
+				if resolved[key], err = resolve(item); err != nil {
+					return nil, err
+				}
+			}
+
+			return resolved, nil
+		default:
+			return v, nil
+		}
+	}
+
+	if config.Policy.Approval == nil {
+		return config, nil
+	}
+
+	resolved, err := resolve([]interface{}(config.Policy.Approval))
+	if err != nil {
+		return policy.Config{}, err
+	}
+
+	config.Policy.Approval = approval.Policy(resolved.([]interface{}))
+	return config, nil
+}
+
+// RewriteWorkflowReferences rewrites the references to a workflow's rules in
+// a config, after the workflow has been moved from one path to another. Only
+// whole strings are rewritten: the workflow's path, the names of its rules
+// rendered from tmpl, or DefaultRuleNameTemplate if it is nil, with any
+// qualifiers, and references to it by ID. Names given by a `name` directive and
+// IDs declared by an `id` directive don't change when the workflow moves. Only
+// the strings which change are replaced in contents, so that everything else
+// in the file is kept as it is. It returns the new contents and the number of
+// strings it changed.
+func RewriteWorkflowReferences(contents []byte, from, to string, wf GitHubWorkflow, tmpl *template.Template) ([]byte, int, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(contents, &node); err != nil {
+		return nil, 0, ErrInvalidPolicyBotConfig{Err: err}
+	}
+
+	rewrites := map[string]string{from: to}
+	if wf.directives.ID == "" {
+		rewrites[WorkflowReferencePrefix+WorkflowID(from)] = WorkflowReferencePrefix + WorkflowID(to)
+	}
+
+	// Rule names are told apart by the workflow's path if they clash, so the
+	// path can be one of the qualifiers even if the name doesn't depend on it.
+	fromName, toName := wf.directives.Name, wf.directives.Name
+	if fromName == "" {
+		if tmpl == nil {
+			tmpl = template.Must(ParseRuleNameTemplate(DefaultRuleNameTemplate))
+		}
+
+		var err error
+		if fromName, err = renderRuleName(tmpl, wf.ruleNameData(from)); err != nil {
+			return nil, 0, errBuildRules{Path: from, Err: fmt.Errorf("couldn't render the rule name: %w", err)}
+		}
+		if toName, err = renderRuleName(tmpl, wf.ruleNameData(to)); err != nil {
+			return nil, 0, errBuildRules{Path: to, Err: fmt.Errorf("couldn't render the rule name: %w", err)}
+		}
+	}
+
+	var edits []scalarEdit
+	var rewrite func(node *yaml.Node)
+	rewrite = func(node *yaml.Node) {
+		if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+			value, ok := rewrites[node.Value]
+			if !ok {
+				if qualifiers, found := strings.CutPrefix(node.Value, fromName); found && isQualifiers(qualifiers) {
+					if rest, found := strings.CutPrefix(qualifiers, " ("+from+")"); found && isQualifiers(rest) {
+						qualifiers = " (" + to + ")" + rest
+					}
+					value, ok = toName+qualifiers, true
+				}
+			}
+
+			if ok && value != node.Value {
+				edits = append(edits, scalarEdit{Node: node, Value: value})
+			}
+		}
+
+		for _, child := range node.Content {
+			rewrite(child)
+		}
+	}
+	rewrite(&node)
+
+	rewritten, err := replaceScalars(contents, edits)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return rewritten, len(edits), nil
+}
+
+// isQualifiers checks if s is what qualifiedName adds to a name: nothing, or
+// qualifiers in parentheses.
+func isQualifiers(s string) bool {
+	return s == "" || strings.HasPrefix(s, " (") && strings.HasSuffix(s, ")")
+}
+
+// scalarEdit replaces the value of a scalar in a YAML file.
+type scalarEdit struct {
+	Node  *yaml.Node
+	Value string
+}
+
+// replaceScalars applies edits to the YAML file they were made for, replacing
+// the text of each scalar in place. A scalar keeps its quoting, unless its new
+// value needs quotes where it had none. It fails if a scalar spans several
+// lines, since we can't tell where its text ends.
+func replaceScalars(contents []byte, edits []scalarEdit) ([]byte, error) {
+	lines := strings.SplitAfter(string(contents), "\n")
+
+	// Edits further along a line go first, so that the columns of the
+	// earlier ones stay right.
+	slices.SortFunc(edits, func(a, b scalarEdit) int {
+		if a.Node.Line != b.Node.Line {
+			return b.Node.Line - a.Node.Line
+		}
+		return b.Node.Column - a.Node.Column
+	})
+
+	for _, edit := range edits {
+		pos := positionOf(edit.Node)
+		if pos.Line < 1 || pos.Line > len(lines) {
+			return nil, errRewriteScalar{Value: edit.Node.Value, Pos: pos}
+		}
+
+		// Columns count characters, not bytes.
+		line := []rune(lines[pos.Line-1])
+		start := pos.Column - 1
+		end := scalarEnd(line, start, edit.Node.Value, edit.Node.Style)
+		if end < 0 {
+			return nil, errRewriteScalar{Value: edit.Node.Value, Pos: pos}
+		}
+
+		var value string
+		if err := yaml.Unmarshal([]byte(string(line[start:end])), &value); err != nil || value != edit.Node.Value {
+			return nil, errRewriteScalar{Value: edit.Node.Value, Pos: pos}
+		}
+
+		style := edit.Node.Style
+		if style == 0 && strings.ContainsAny(edit.Value, ",[]{}") {
+			// Plain scalars can't contain these in flow collections.
+			style = yaml.SingleQuotedStyle
+		}
+
+		text, err := yaml.Marshal(&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: edit.Value, Style: style})
+		if err != nil {
+			return nil, err
+		}
+
+		lines[pos.Line-1] = string(line[:start]) + strings.TrimSuffix(string(text), "\n") + string(line[end:])
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// scalarEnd returns the index just after the text of the scalar with the
+// given value and style which starts at index start of the line, or -1 if it
+// doesn't end on the line.
+func scalarEnd(line []rune, start int, value string, style yaml.Style) int {
+	if start < 0 || start >= len(line) {
+		return -1
+	}
+
+	switch style {
+	case 0:
+		// A plain scalar on one line is its value.
+		end := start + len([]rune(value))
+		if end <= len(line) && string(line[start:end]) == value {
+			return end
+		}
+	case yaml.SingleQuotedStyle:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] != '\'' {
+				continue
+			}
+			if i+1 < len(line) && line[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	case yaml.DoubleQuotedStyle:
+		for i := start + 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+	}
+
+	return -1
+}
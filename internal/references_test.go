@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/palantir/policy-bot/policy"
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkflowID(t *testing.T) {
+	require.Equal(t, "ci", WorkflowID(".github/workflows/ci.yml"))
+	require.Equal(t, "build.test", WorkflowID(".github/workflows/build.test.yaml"))
+
+	wf := GitHubWorkflow{directives: workflowDirectives{ID: "tests"}}
+	require.Equal(t, "tests", wf.id(".github/workflows/ci.yml"))
+}
+
+func TestPolicyBotConfigWorkflowPolicies(t *testing.T) {
+	workflows := GitHubWorkflowCollection{
+		".github/workflows/ci.yml": GitHubWorkflow{
+			On: githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}},
+		},
+		".github/workflows/lint.yml": GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest:       &gitHubWorkflowOnPullRequest{},
+				PullRequestTarget: &gitHubWorkflowOnPullRequest{Branches: []string{"main"}},
+			},
+			directives: workflowDirectives{ID: "checks"},
+		},
+		".github/workflows/ci.yaml": GitHubWorkflow{
+			On: githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}},
+		},
+	}
+
+	_, policies, err := workflows.PolicyBotConfig()
+	require.NoError(t, err)
+
+	require.Equal(t, WorkflowPolicies{
+		// ci.yaml and ci.yml have the same ID.
+		"ci": nil,
+		"checks": map[string]interface{}{"and": []interface{}{
+			"Workflow .github/workflows/lint.yml succeeded or skipped (pull_request)",
+			"Workflow .github/workflows/lint.yml succeeded or skipped (pull_request_target)",
+		}},
+	}, policies)
+}
+
+func TestResolveWorkflowReferences(t *testing.T) {
+	policies := WorkflowPolicies{
+		"ci":     "Workflow .github/workflows/ci.yml succeeded or skipped",
+		"checks": map[string]interface{}{"and": []interface{}{"a", "b"}},
+		"twice":  nil,
+	}
+
+	config := policy.Config{
+		Policy: policy.Policy{
+			Approval: approval.Policy{
+				map[string]interface{}{"or": []interface{}{
+					"MERGE_WITH_GENERATED",
+					"workflow:ci",
+				}},
+				map[string]interface{}{"or": []interface{}{"workflow:checks", "override"}},
+			},
+		},
+		ApprovalRules: []*approval.Rule{{Name: "override"}},
+	}
+
+	resolved, err := ResolveWorkflowReferences(config, policies)
+	require.NoError(t, err)
+	require.Equal(t, approval.Policy{
+		map[string]interface{}{"or": []interface{}{
+			"MERGE_WITH_GENERATED",
+			"Workflow .github/workflows/ci.yml succeeded or skipped",
+		}},
+		map[string]interface{}{"or": []interface{}{
+			map[string]interface{}{"and": []interface{}{"a", "b"}},
+			"override",
+		}},
+	}, resolved.Policy.Approval)
+	require.Equal(t, config.ApprovalRules, resolved.ApprovalRules)
+
+	// The original config isn't changed.
+	require.Equal(t, "workflow:ci", config.Policy.Approval[0].(map[string]interface{})["or"].([]interface{})[1])
+
+	for reference, msg := range map[string]string{
+		"workflow:deleted": "can't resolve `workflow:deleted`: no generated workflow has this ID",
+		"workflow:twice":   "can't resolve `workflow:twice`: several generated workflows have this ID",
+	} {
+		_, err := ResolveWorkflowReferences(policy.Config{
+			Policy: policy.Policy{Approval: approval.Policy{reference}},
+		}, policies)
+		require.EqualError(t, err, msg)
+	}
+}
+
+func TestRewriteWorkflowReferences(t *testing.T) {
+	const config = `# Overrides for the generated rules.
+policy:
+  approval:
+    - or:
+        - MERGE_WITH_GENERATED
+        - workflow:ci # by ID
+        - Workflow .github/workflows/ci.yml succeeded or skipped
+        - "Workflow .github/workflows/ci.yml succeeded or skipped (job test)"
+        - Workflow .github/workflows/ci.yml succeeded or skipped twice
+        - Docs for .github/workflows/ci.yml
+        - workflow:cinema
+approval_rules:
+  - name: 'Workflow .github/workflows/ci.yml succeeded or skipped'
+    requires:
+      conditions:
+        has_workflow_result:
+          workflows: [.github/workflows/ci.yml, .github/workflows/ci.yml.bak]
+`
+
+	tests := []struct {
+		name     string
+		workflow string
+		template string
+		to       string
+		config   string
+		changed  int
+		expected string
+	}{
+		{
+			name:     "ID from the path",
+			workflow: "on: pull_request\n",
+			config:   config,
+			changed:  5,
+			expected: `# Overrides for the generated rules.
+policy:
+  approval:
+    - or:
+        - MERGE_WITH_GENERATED
+        - workflow:tests # by ID
+        - Workflow .github/workflows/build/tests.yml succeeded or skipped
+        - "Workflow .github/workflows/build/tests.yml succeeded or skipped (job test)"
+        - Workflow .github/workflows/ci.yml succeeded or skipped twice
+        - Docs for .github/workflows/ci.yml
+        - workflow:cinema
+approval_rules:
+  - name: 'Workflow .github/workflows/build/tests.yml succeeded or skipped'
+    requires:
+      conditions:
+        has_workflow_result:
+          workflows: [.github/workflows/build/tests.yml, .github/workflows/ci.yml.bak]
+`,
+		},
+		{
+			name:     "declared ID",
+			workflow: "# generate-policy-bot-config: id=ci\non: pull_request\n",
+			config:   config,
+			changed:  4,
+			expected: `# Overrides for the generated rules.
+policy:
+  approval:
+    - or:
+        - MERGE_WITH_GENERATED
+        - workflow:ci # by ID
+        - Workflow .github/workflows/build/tests.yml succeeded or skipped
+        - "Workflow .github/workflows/build/tests.yml succeeded or skipped (job test)"
+        - Workflow .github/workflows/ci.yml succeeded or skipped twice
+        - Docs for .github/workflows/ci.yml
+        - workflow:cinema
+approval_rules:
+  - name: 'Workflow .github/workflows/build/tests.yml succeeded or skipped'
+    requires:
+      conditions:
+        has_workflow_result:
+          workflows: [.github/workflows/build/tests.yml, .github/workflows/ci.yml.bak]
+`,
+		},
+		{
+			name:     "custom template",
+			workflow: "name: CI\non: pull_request\n",
+			template: "{{.ID}} ({{.Name}}) passed",
+			config: `policy:
+  approval:
+    - or: [ci (CI) passed, "ci (CI) passed (job test)", Workflow .github/workflows/ci.yml succeeded or skipped]
+`,
+			changed: 2,
+			expected: `policy:
+  approval:
+    - or: [tests (CI) passed, "tests (CI) passed (job test)", Workflow .github/workflows/ci.yml succeeded or skipped]
+`,
+		},
+		{
+			name:     "name told apart by the path",
+			workflow: "name: CI\non: pull_request\n",
+			template: "{{.Name}} passed",
+			config: `policy:
+  approval:
+    - or: [CI passed (.github/workflows/ci.yml), 'CI passed (.github/workflows/ci.yml) (job test)']
+`,
+			changed: 2,
+			expected: `policy:
+  approval:
+    - or: [CI passed (.github/workflows/build/tests.yml), 'CI passed (.github/workflows/build/tests.yml) (job test)']
+`,
+		},
+		{
+			name:     "name directive",
+			workflow: "# generate-policy-bot-config: name=CI everywhere\non: pull_request\n",
+			config: `policy:
+  approval:
+    - or: [CI everywhere, CI everywhere (.github/workflows/ci.yml)]
+`,
+			changed: 1,
+			expected: `policy:
+  approval:
+    - or: [CI everywhere, CI everywhere (.github/workflows/build/tests.yml)]
+`,
+		},
+		{
+			name:     "new value needs quotes",
+			workflow: "on: pull_request\n",
+			to:       ".github/workflows/build/tests,ci.yml",
+			config:   "workflows: [.github/workflows/ci.yml] # CI\n",
+			changed:  1,
+			expected: "workflows: ['.github/workflows/build/tests,ci.yml'] # CI\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, err := ParseWorkflow([]byte(tt.workflow))
+			require.NoError(t, err)
+
+			var tmpl *template.Template
+			if tt.template != "" {
+				tmpl, err = ParseRuleNameTemplate(tt.template)
+				require.NoError(t, err)
+			}
+
+			to := tt.to
+			if to == "" {
+				to = ".github/workflows/build/tests.yml"
+			}
+
+			out, changed, err := RewriteWorkflowReferences([]byte(tt.config), ".github/workflows/ci.yml", to, wf, tmpl)
+			require.NoError(t, err)
+			require.Equal(t, tt.changed, changed)
+			require.Equal(t, tt.expected, string(out))
+		})
+	}
+}
+
+func TestRewriteWorkflowReferencesMultilineString(t *testing.T) {
+	config := "workflows:\n  - >-\n    .github/workflows/ci.yml\n"
+
+	_, _, err := RewriteWorkflowReferences([]byte(config), ".github/workflows/ci.yml", ".github/workflows/tests.yml", GitHubWorkflow{}, nil)
+	require.ErrorContains(t, err, "can't rewrite `.github/workflows/ci.yml` at 2:5 in place")
+}
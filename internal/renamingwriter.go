@@ -26,9 +26,10 @@ type RenamingWriter struct {
 }
 
 // Close closes the writer and renames the temporary file to the destination. It
-// is used when exiting successfully.
+// is used when exiting successfully. Closing a nil writer, for an optional
+// output which wasn't requested, does nothing.
 func (rw *RenamingWriter) Close() error {
-	if rw.WriteCloserRenamerRemover == nil {
+	if rw == nil || rw.WriteCloserRenamerRemover == nil {
 		return nil
 	}
 	defer func() { rw.WriteCloserRenamerRemover = nil }()
@@ -51,9 +52,9 @@ func (rw *RenamingWriter) Close() error {
 }
 
 // Abort closes the writer and removes the temporary file. It is used when
-// exiting with an error.
+// exiting with an error. Aborting a nil writer does nothing.
 func (rw *RenamingWriter) Abort() error {
-	if rw.WriteCloserRenamerRemover == nil {
+	if rw == nil || rw.WriteCloserRenamerRemover == nil {
 		return nil
 	}
 	defer func() { rw.WriteCloserRenamerRemover = nil }()
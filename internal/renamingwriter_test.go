@@ -221,3 +221,10 @@ func TestRenamingWriterMultipleCalls(t *testing.T) {
 	require.Equal(t, 1, fake.renameCount)
 	require.Equal(t, 0, fake.removeCount)
 }
+
+func TestRenamingWriterNil(t *testing.T) {
+	var rw *RenamingWriter
+
+	require.NoError(t, rw.Close())
+	require.NoError(t, rw.Abort())
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// DefaultRuleNameTemplate is the template for the names of the rules which
+// require a workflow, unless another one is given. The name doesn't change with
+// the conclusions the rules accept, so it says `succeeded or skipped` even for
+// workflows whose cancelled runs are accepted too: other policies refer to the
+// rules by name.
+const DefaultRuleNameTemplate = "Workflow {{.Path}} succeeded or skipped"
+
+// RuleNameData is what a rule name template can refer to.
+type RuleNameData struct {
+	// Path is the workflow's path, like `.github/workflows/ci.yml`.
+	Path string
+	// ID is the workflow's ID, like `ci` (see WorkflowID).
+	ID string
+	// Name is the workflow's `name`, or its path if it doesn't have one, which
+	// is how GitHub shows it.
+	Name string
+	// Triggers are the events which run the workflow for pull requests, like
+	// `pull_request`, in order.
+	Triggers []string
+}
+
+// ruleNameFuncs are the functions rule name templates can use, on top of the
+// ones text/template has.
+var ruleNameFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// ParseRuleNameTemplate parses a template for the names of the rules which
+// require a workflow (see RuleNameData). It fails if the template refers to
+// anything which isn't there, or renders an empty name.
+func ParseRuleNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("rule name").Funcs(ruleNameFuncs).Parse(text)
+	if err != nil {
+		return nil, errInvalidRuleNameTemplate{Template: text, Err: err}
+	}
+
+	name, err := renderRuleName(tmpl, RuleNameData{
+		Path:     ".github/workflows/ci.yml",
+		ID:       "ci",
+		Name:     "CI",
+		Triggers: []string{"pull_request"},
+	})
+	if err != nil {
+		return nil, errInvalidRuleNameTemplate{Template: text, Err: err}
+	}
+
+	if name == "" {
+		return nil, errInvalidRuleNameTemplate{Template: text, Err: fmt.Errorf("it renders an empty name")}
+	}
+
+	return tmpl, nil
+}
+
+// renderRuleName renders a rule name template, trimming any surrounding
+// whitespace.
+func renderRuleName(tmpl *template.Template, data RuleNameData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// ruleNameData returns what a rule name template can refer to for the
+// workflow.
+func (wf GitHubWorkflow) ruleNameData(path string) RuleNameData {
+	data := RuleNameData{Path: path, ID: wf.id(path), Name: wf.Name}
+	if data.Name == "" {
+		data.Name = path
+	}
+
+	for _, trigger := range wf.pullRequestTriggers() {
+		data.Triggers = append(data.Triggers, trigger.Event)
+	}
+	if wf.On.PullRequestReview != nil {
+		data.Triggers = append(data.Triggers, "pull_request_review")
+	}
+	if wf.IsCommentWorkflow() {
+		data.Triggers = append(data.Triggers, "issue_comment")
+	}
+	if wf.On.WorkflowRun != nil {
+		data.Triggers = append(data.Triggers, "workflow_run")
+	}
+
+	return data
+}
+
+// NameRules returns a copy of the collection in which the rules generated for
+// each workflow are named after the result of rendering tmpl, or
+// DefaultRuleNameTemplate if it is nil, unless the workflow has a `name`
+// directive. If several workflows
+// would get the same name, which would make their rules clash, each of them is
+// told apart by its path, and the clash is reported. Names only depend on the
+// workflows, so they stay the same from one run to the next. It fails if the
+// template can't be rendered for a workflow.
+func (workflows GitHubWorkflowCollection) NameRules(tmpl *template.Template) (GitHubWorkflowCollection, error) {
+	if tmpl == nil {
+		tmpl = template.Must(ParseRuleNameTemplate(DefaultRuleNameTemplate))
+	}
+
+	names := make(map[string]string, len(workflows))
+	paths := make(map[string][]string)
+	for _, path := range slices.Sorted(maps.Keys(workflows)) {
+		wf := workflows[path]
+
+		name := wf.directives.Name
+		if name == "" {
+			var err error
+			name, err = renderRuleName(tmpl, wf.ruleNameData(path))
+			if err != nil {
+				return nil, errBuildRules{Path: path, Err: fmt.Errorf("couldn't render the rule name: %w", err)}
+			}
+		}
+
+		names[path] = name
+
+		// Ignored workflows don't get any rules, so they can't clash.
+		if !wf.directives.Ignore {
+			paths[name] = append(paths[name], path)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(paths)) {
+		if len(paths[name]) > 1 {
+			slog.Warn("workflows would have rules with the same name, adding their paths", "name", name, "workflows", paths[name])
+		}
+	}
+
+	resolved := make(GitHubWorkflowCollection, len(workflows))
+	for path, wf := range workflows {
+		wf.ruleName = names[path]
+		if len(paths[wf.ruleName]) > 1 {
+			wf.ruleName = qualifiedName(wf.ruleName, path)
+		}
+
+		resolved[path] = wf
+	}
+
+	return resolved, nil
+}
+
+// NameRulesTogether names the rules generated for the workflows in several
+// collections, like NameRules, as if they were one collection: a workflow in
+// more than one of them gets the same name in each, and its name is told apart
+// from the names of the workflows in all of them. It returns the named
+// collections in the same order.
+func NameRulesTogether(tmpl *template.Template, collections ...GitHubWorkflowCollection) ([]GitHubWorkflowCollection, error) {
+	all := make(GitHubWorkflowCollection)
+	for _, workflows := range collections {
+		for path, wf := range workflows {
+			if _, ok := all[path]; !ok {
+				all[path] = wf
+			}
+		}
+	}
+
+	named, err := all.NameRules(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make([]GitHubWorkflowCollection, len(collections))
+	for i, workflows := range collections {
+		resolved[i] = make(GitHubWorkflowCollection, len(workflows))
+		for path, wf := range workflows {
+			wf.ruleName = named[path].ruleName
+			resolved[i][path] = wf
+		}
+	}
+
+	return resolved, nil
+}
+
+// approvalRuleName returns the name of the rules which require the workflow on
+// pull requests, before any qualifiers are added to tell them apart. It is the
+// one set by NameRules, or else the one the workflow's `name` directive gives,
+// or else the default.
+func (wf GitHubWorkflow) approvalRuleName(path string) string {
+	if wf.ruleName != "" {
+		return wf.ruleName
+	}
+
+	if wf.directives.Name != "" {
+		return wf.directives.Name
+	}
+
+	return defaultRuleName(path)
+}
+
+// defaultRuleName returns the name DefaultRuleNameTemplate gives the rules
+// which require the workflow at the given path.
+func defaultRuleName(path string) string {
+	return fmt.Sprintf("Workflow %s succeeded or skipped", path)
+}
@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/palantir/policy-bot/policy"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRuleNameTemplate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		errorMsg string
+	}{
+		{
+			name:     "default",
+			template: DefaultRuleNameTemplate,
+		},
+		{
+			name:     "name and triggers",
+			template: "{{.Name}} passed on {{join .Triggers \", \"}}",
+		},
+		{
+			name:     "syntax error",
+			template: "{{.Name",
+			errorMsg: "invalid rule name template `{{.Name`",
+		},
+		{
+			name:     "unknown field",
+			template: "{{.Workflow}}",
+			errorMsg: "can't evaluate field Workflow",
+		},
+		{
+			name:     "empty",
+			template: "  {{if false}}x{{end}} ",
+			errorMsg: "it renders an empty name",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseRuleNameTemplate(tc.template)
+			if tc.errorMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorContains(t, err, tc.errorMsg)
+
+			var invalid errInvalidRuleNameTemplate
+			require.ErrorAs(t, err, &invalid)
+		})
+	}
+}
+
+func TestNameRules(t *testing.T) {
+	workflows := GitHubWorkflowCollection{
+		".github/workflows/ci.yml": GitHubWorkflow{
+			Name: "CI",
+			On:   githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}, PullRequestTarget: &gitHubWorkflowOnPullRequest{}},
+		},
+		".github/workflows/lint.yml": GitHubWorkflow{
+			On: githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}},
+		},
+		".github/workflows/other-ci.yml": GitHubWorkflow{
+			Name: "CI",
+			On:   githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}, PullRequestTarget: &gitHubWorkflowOnPullRequest{}},
+		},
+		".github/workflows/renamed.yml": GitHubWorkflow{
+			Name:       "CI",
+			On:         githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}},
+			directives: workflowDirectives{Name: "Renamed"},
+		},
+		".github/workflows/ignored.yml": GitHubWorkflow{
+			Name:       "Lint",
+			On:         githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}},
+			directives: workflowDirectives{Ignore: true},
+		},
+	}
+
+	t.Run("default", func(t *testing.T) {
+		named, err := workflows.NameRules(nil)
+		require.NoError(t, err)
+
+		require.Equal(t, "Workflow .github/workflows/ci.yml succeeded or skipped", named[".github/workflows/ci.yml"].approvalRuleName(".github/workflows/ci.yml"))
+		require.Equal(t, "Renamed", named[".github/workflows/renamed.yml"].approvalRuleName(".github/workflows/renamed.yml"))
+	})
+
+	t.Run("template", func(t *testing.T) {
+		tmpl, err := ParseRuleNameTemplate("{{.Name}} ({{join .Triggers \"/\"}})")
+		require.NoError(t, err)
+
+		named, err := workflows.NameRules(tmpl)
+		require.NoError(t, err)
+
+		names := make(map[string]string)
+		for path, wf := range named {
+			names[path] = wf.approvalRuleName(path)
+		}
+
+		require.Equal(t, map[string]string{
+			".github/workflows/ci.yml":       "CI (pull_request/pull_request_target) (.github/workflows/ci.yml)",
+			".github/workflows/lint.yml":     ".github/workflows/lint.yml (pull_request)",
+			".github/workflows/other-ci.yml": "CI (pull_request/pull_request_target) (.github/workflows/other-ci.yml)",
+			".github/workflows/renamed.yml":  "Renamed",
+			".github/workflows/ignored.yml":  "Lint (pull_request)",
+		}, names)
+
+		// The original collection isn't changed.
+		require.Empty(t, workflows[".github/workflows/ci.yml"].ruleName)
+	})
+
+	t.Run("render error", func(t *testing.T) {
+		tmpl, err := ParseRuleNameTemplate("{{index .Triggers 0}}")
+		require.NoError(t, err)
+
+		_, err = GitHubWorkflowCollection{".github/workflows/none.yml": GitHubWorkflow{}}.NameRules(tmpl)
+		require.ErrorContains(t, err, "failed to build approval rules for .github/workflows/none.yml: couldn't render the rule name")
+	})
+}
+
+func TestNameRulesTogether(t *testing.T) {
+	ci := GitHubWorkflow{
+		Name: "CI",
+		On:   githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}, MergeGroup: &gitHubWorkflowOnMergeGroup{}},
+	}
+	pr := GitHubWorkflowCollection{
+		".github/workflows/ci.yml":   ci,
+		".github/workflows/lint.yml": GitHubWorkflow{Name: "Lint", On: githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}}},
+	}
+	mergeQueue := GitHubWorkflowCollection{
+		".github/workflows/ci.yml":    ci,
+		".github/workflows/merge.yml": GitHubWorkflow{Name: "CI", On: githubWorkflowHeader{MergeGroup: &gitHubWorkflowOnMergeGroup{}}},
+	}
+
+	tmpl, err := ParseRuleNameTemplate("{{.Name}}")
+	require.NoError(t, err)
+
+	named, err := NameRulesTogether(tmpl, pr, mergeQueue)
+	require.NoError(t, err)
+	require.Len(t, named, 2)
+
+	names := func(workflows GitHubWorkflowCollection) map[string]string {
+		names := make(map[string]string)
+		for path, wf := range workflows {
+			names[path] = wf.approvalRuleName(path)
+		}
+		return names
+	}
+
+	// The merge queue workflow's name clashes with the PR one's, so both
+	// configs tell it apart by its path.
+	require.Equal(t, map[string]string{
+		".github/workflows/ci.yml":   "CI (.github/workflows/ci.yml)",
+		".github/workflows/lint.yml": "Lint",
+	}, names(named[0]))
+	require.Equal(t, map[string]string{
+		".github/workflows/ci.yml":    "CI (.github/workflows/ci.yml)",
+		".github/workflows/merge.yml": "CI (.github/workflows/merge.yml)",
+	}, names(named[1]))
+}
+
+func TestNameRulesEveryRule(t *testing.T) {
+	wf, err := ParseWorkflow([]byte(`
+name: CI
+on:
+  pull_request:
+    branches-ignore: [release]
+  merge_group:
+jobs:
+  test:
+    if: "!contains(github.event.pull_request.labels.*.name, 'no-ci')"
+    runs-on: ubuntu-latest
+`))
+	require.NoError(t, err)
+
+	tmpl, err := ParseRuleNameTemplate("{{.Name}} passed")
+	require.NoError(t, err)
+
+	named, err := GitHubWorkflowCollection{".github/workflows/ci.yml": wf}.NameRules(tmpl)
+	require.NoError(t, err)
+
+	ruleNames := func(config policy.Config) []string {
+		var names []string
+		for _, rule := range config.ApprovalRules {
+			names = append(names, rule.Name)
+		}
+
+		return names
+	}
+
+	config, _, err := named.RequireJobStatuses(JobStatusesAlongside).PolicyBotConfig()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"CI passed (not required for ignored branches)",
+		"CI passed",
+		"CI passed (not required when contains(github.event.pull_request.labels.*.name, 'no-ci'))",
+		"CI passed (job test)",
+		DefaultToApproval,
+	}, ruleNames(config))
+
+	mergeQueueConfig, err := named.MergeQueuePolicyBotConfig()
+	require.NoError(t, err)
+	require.Equal(t, []string{"CI passed (merge queue)", DefaultToApproval}, ruleNames(mergeQueueConfig))
+}
+
+func TestPolicyBotConfigDuplicateRuleNames(t *testing.T) {
+	workflows := GitHubWorkflowCollection{
+		".github/workflows/a.yml": GitHubWorkflow{
+			On:         githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}},
+			directives: workflowDirectives{Name: "CI (pull_request)"},
+		},
+		".github/workflows/b.yml": GitHubWorkflow{
+			On: githubWorkflowHeader{
+				PullRequest:       &gitHubWorkflowOnPullRequest{},
+				PullRequestTarget: &gitHubWorkflowOnPullRequest{Branches: []string{"main"}},
+			},
+			directives: workflowDirectives{Name: "CI"},
+		},
+	}
+
+	named, err := workflows.NameRules(nil)
+	require.NoError(t, err)
+
+	config, _, err := named.PolicyBotConfig()
+
+	var duplicate errDuplicateRuleName
+	require.ErrorAs(t, err, &duplicate)
+	require.Equal(t, "CI (pull_request)", duplicate.Name)
+	require.ErrorContains(t, err, "failed to build approval rules for .github/workflows/b.yml")
+
+	require.Len(t, config.ApprovalRules, 2)
+	require.Equal(t, "CI (pull_request)", config.ApprovalRules[0].Name)
+	require.Equal(t, DefaultToApproval, config.ApprovalRules[1].Name)
+}
@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/palantir/policy-bot/policy/predicate"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultToolConfigPath is where the tool's own config is read from, relative
+// to the root of the repository, unless another path is given.
+const DefaultToolConfigPath = ".github/generate-policy-bot-config.yml"
+
+// ToolConfig is the tool's own config, with settings for the repository and
+// overrides for individual workflows. Its schema is documented in
+// generate-policy-bot-config.schema.json, at the root of this repository.
+type ToolConfig struct {
+	// Output is where the generated config is written, unless the `--output`
+	// flag is given.
+	Output string `yaml:"output"`
+	// MergeWith is the config to merge with the generated one, unless the
+	// `--merge-with` flag is given.
+	MergeWith string `yaml:"merge_with"`
+	// Include are globs for the paths of the workflows to generate rules for.
+	// If there aren't any, every workflow is included.
+	Include []string `yaml:"include"`
+	// Exclude are globs for the paths of the workflows not to generate rules
+	// for, even if they are included.
+	Exclude []string `yaml:"exclude"`
+	// Workflows override the settings of the workflows whose paths they match.
+	Workflows []WorkflowOverride `yaml:"workflows"`
+}
+
+// WorkflowOverride changes how the workflows whose paths match one of its
+// globs are required. They work like the workflows' directives, which take
+// precedence over them, except that `required: true` overrides an `ignore`
+// directive. When several overrides match a workflow, the later ones take
+// precedence.
+type WorkflowOverride struct {
+	// Match are globs for the paths of the workflows to override.
+	Match []string `yaml:"match"`
+	// Required leaves the workflows out of the config if it is false, like an
+	// `ignore` directive, unless they have an `always` directive. If it is
+	// true, the workflows are required even if they have an `ignore`
+	// directive.
+	Required *bool `yaml:"required"`
+	// Name replaces the name of the rules which require the workflows.
+	Name string `yaml:"name"`
+	// Conclusions replace the conclusions the workflows' runs may have.
+	Conclusions []string `yaml:"conclusions"`
+	// Predicates are added to the rules which require the workflows,
+	// replacing any generated predicate of the same kind.
+	Predicates predicate.Predicates `yaml:"predicates"`
+	// ReplacePredicates replaces all the generated predicates with
+	// Predicates, instead of only those of the same kind.
+	ReplacePredicates bool `yaml:"replace_predicates"`
+}
+
+// matches checks if the override applies to the workflow at the given path.
+func (o WorkflowOverride) matches(path string) bool {
+	return len(o.Match) > 0 && filterSegment{Include: o.Match}.matches(path)
+}
+
+// includes checks if the config's include and exclude globs leave the workflow
+// at the given path in.
+func (c ToolConfig) includes(path string) bool {
+	return filterSegment{Include: c.Include, Exclude: c.Exclude}.matches(path)
+}
+
+// validateGlobs checks that the globs of a setting are valid.
+func validateGlobs(field string, globs []string) error {
+	if _, err := RegexpsFromGlobs(globs); err != nil {
+		return errInvalidToolConfigField{Field: field, Err: err}
+	}
+
+	return nil
+}
+
+// validate checks the settings which decoding the config doesn't, and returns
+// all the problems, joined.
+func (c ToolConfig) validate() error {
+	problems := []error{
+		validateGlobs("include", c.Include),
+		validateGlobs("exclude", c.Exclude),
+	}
+
+	for i, o := range c.Workflows {
+		field := func(name string) string { return fmt.Sprintf("workflows[%d].%s", i, name) }
+
+		if len(o.Match) == 0 {
+			problems = append(problems, errInvalidToolConfigField{Field: field("match"), Err: errors.New("at least one glob is needed")})
+		}
+		problems = append(problems, validateGlobs(field("match"), o.Match))
+
+		for _, conclusion := range o.Conclusions {
+			if !slices.Contains(workflowConclusions, conclusion) {
+				problems = append(problems, errInvalidToolConfigField{
+					Field: field("conclusions"),
+					Err:   fmt.Errorf("unknown conclusion `%s`", conclusion),
+				})
+			}
+		}
+
+		if o.ReplacePredicates && reflect.ValueOf(o.Predicates).IsZero() {
+			problems = append(problems, errInvalidToolConfigField{
+				Field: field("replace_predicates"),
+				Err:   errors.New("`predicates` must be set to replace the generated ones"),
+			})
+		}
+	}
+
+	return errors.Join(problems...)
+}
+
+// ParseToolConfig parses the contents of the tool's config file. Keys which
+// aren't in the schema are rejected, rather than ignored, so that typos don't
+// go unnoticed. An empty file is the same as no config.
+func ParseToolConfig(contents []byte) (ToolConfig, error) {
+	var config ToolConfig
+
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return ToolConfig{}, err
+	}
+
+	if err := config.validate(); err != nil {
+		return ToolConfig{}, err
+	}
+
+	return config, nil
+}
+
+// override returns the override for the workflow at the given path, combining
+// the ones which match it. Later overrides take precedence.
+func (c ToolConfig) override(path string) WorkflowOverride {
+	var combined WorkflowOverride
+	for _, o := range c.Workflows {
+		if !o.matches(path) {
+			continue
+		}
+
+		if o.Required != nil {
+			combined.Required = o.Required
+		}
+		if o.Name != "" {
+			combined.Name = o.Name
+		}
+		if len(o.Conclusions) > 0 {
+			combined.Conclusions = o.Conclusions
+		}
+		if o.ReplacePredicates {
+			combined.Predicates = o.Predicates
+			combined.ReplacePredicates = true
+		} else {
+			mergePredicates(&combined.Predicates, o.Predicates)
+		}
+	}
+
+	return combined
+}
+
+// ApplyToolConfig returns a copy of the collection without the workflows the
+// config's include and exclude globs leave out, and with the config's
+// overrides applied to the others. A workflow's own directives take precedence
+// over the overrides, except that `required: true` overrides `ignore`.
+func (workflows GitHubWorkflowCollection) ApplyToolConfig(config ToolConfig) GitHubWorkflowCollection {
+	resolved := make(GitHubWorkflowCollection, len(workflows))
+	for _, path := range slices.Sorted(maps.Keys(workflows)) {
+		wf := workflows[path]
+
+		if !config.includes(path) {
+			slog.Debug("skipping workflow excluded by the tool config", "path", path)
+			continue
+		}
+
+		o := config.override(path)
+
+		switch {
+		case o.Required == nil:
+		case *o.Required:
+			wf.directives.Ignore = false
+		case !wf.directives.Always:
+			wf.directives.Ignore = true
+		}
+		if wf.directives.Name == "" {
+			wf.directives.Name = o.Name
+		}
+		if len(wf.directives.Conclusions) == 0 {
+			wf.directives.Conclusions = o.Conclusions
+		}
+
+		predicates := o.Predicates
+		mergePredicates(&predicates, wf.directives.Predicates)
+		wf.directives.Predicates = predicates
+		wf.replacePredicates = o.ReplacePredicates
+
+		resolved[path] = wf
+	}
+
+	return resolved
+}
@@ -0,0 +1,345 @@
+package internal
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/palantir/policy-bot/policy/approval"
+	"github.com/palantir/policy-bot/policy/predicate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseToolConfig(t *testing.T) {
+	optional := false
+
+	tests := []struct {
+		name          string
+		contents      string
+		expected      ToolConfig
+		expectedError string
+	}{
+		{
+			name: "everything",
+			contents: `output: .policy.yml
+merge_with: policy.yml
+include: [".github/workflows/*.yml"]
+exclude: [".github/workflows/release-*.yml"]
+workflows:
+  - match: [".github/workflows/lint.yml"]
+    required: false
+  - match: [".github/workflows/ci.yml", ".github/workflows/e2e.yml"]
+    name: CI must pass
+    conclusions: [success]
+    predicates:
+      has_labels: [ready]
+    replace_predicates: true
+`,
+			expected: ToolConfig{
+				Output:    ".policy.yml",
+				MergeWith: "policy.yml",
+				Include:   []string{".github/workflows/*.yml"},
+				Exclude:   []string{".github/workflows/release-*.yml"},
+				Workflows: []WorkflowOverride{
+					{
+						Match:    []string{".github/workflows/lint.yml"},
+						Required: &optional,
+					},
+					{
+						Match:             []string{".github/workflows/ci.yml", ".github/workflows/e2e.yml"},
+						Name:              "CI must pass",
+						Conclusions:       []string{"success"},
+						Predicates:        predicate.Predicates{HasLabels: &predicate.HasLabels{"ready"}},
+						ReplacePredicates: true,
+					},
+				},
+			},
+		},
+		{
+			name:     "empty",
+			contents: "",
+			expected: ToolConfig{},
+		},
+		{
+			name:          "unknown key",
+			contents:      "output: .policy.yml\nmerge-with: policy.yml\n",
+			expectedError: "yaml: unmarshal errors:\n  line 2: field merge-with not found in type internal.ToolConfig",
+		},
+		{
+			name:          "unknown workflow key",
+			contents:      "workflows:\n  - match: [ci.yml]\n    optional: true\n",
+			expectedError: "yaml: unmarshal errors:\n  line 3: field optional not found in type internal.WorkflowOverride",
+		},
+		{
+			name:          "unknown predicate",
+			contents:      "workflows:\n  - match: [ci.yml]\n    predicates: {has_label: [ready]}\n",
+			expectedError: "yaml: unmarshal errors:\n  line 3: field has_label not found in type predicate.Predicates",
+		},
+		{
+			name:          "no match",
+			contents:      "workflows:\n  - name: CI\n",
+			expectedError: "invalid `workflows[0].match`: at least one glob is needed",
+		},
+		{
+			name:          "unknown conclusion",
+			contents:      "workflows:\n  - match: [ci.yml]\n    conclusions: [success, passed]\n",
+			expectedError: "invalid `workflows[0].conclusions`: unknown conclusion `passed`",
+		},
+		{
+			name:          "nothing to replace the predicates with",
+			contents:      "workflows:\n  - match: [ci.yml]\n    replace_predicates: true\n",
+			expectedError: "invalid `workflows[0].replace_predicates`: `predicates` must be set to replace the generated ones",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseToolConfig([]byte(tt.contents))
+
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, config)
+		})
+	}
+}
+
+func TestInvalidToolConfigLocation(t *testing.T) {
+	_, err := ParseToolConfig([]byte("output: .policy.yml\nmerge-with: policy.yml\n"))
+	require.Error(t, err)
+
+	err = ErrInvalidToolConfig{Path: DefaultToolConfigPath, Err: err}
+	require.Equal(t, Location{Path: DefaultToolConfigPath, Pos: Position{Line: 2}}, err.(ErrInvalidToolConfig).Location())
+}
+
+func TestApplyToolConfig(t *testing.T) {
+	required := true
+	optional := false
+
+	workflows := GitHubWorkflowCollection{
+		".github/workflows/ci.yml": GitHubWorkflow{},
+		".github/workflows/lint.yml": GitHubWorkflow{
+			directives: workflowDirectives{
+				Name:        "Lint",
+				Conclusions: []string{"success"},
+				Predicates:  predicate.Predicates{HasLabels: &predicate.HasLabels{"lint"}},
+			},
+		},
+		".github/workflows/docs.yml":      GitHubWorkflow{},
+		".github/workflows/release.yml":   GitHubWorkflow{},
+		".github/workflows/other.yaml":    GitHubWorkflow{},
+		".github/workflows/optional.yml":  GitHubWorkflow{},
+		".github/workflows/reinstate.yml": GitHubWorkflow{},
+		".github/workflows/opted-out.yml": GitHubWorkflow{
+			directives: workflowDirectives{Ignore: true},
+		},
+		".github/workflows/always.yml": GitHubWorkflow{
+			directives: workflowDirectives{Always: true},
+		},
+	}
+
+	config := ToolConfig{
+		Include: []string{".github/workflows/*.yml"},
+		Exclude: []string{".github/workflows/release.yml"},
+		Workflows: []WorkflowOverride{
+			{
+				Match:       []string{".github/workflows/*.yml"},
+				Name:        "Checks",
+				Conclusions: []string{"success", "skipped"},
+				Predicates: predicate.Predicates{
+					HasLabels:     &predicate.HasLabels{"ready"},
+					TargetsBranch: &predicate.TargetsBranch{Pattern: mustRegexp(t, "^main$")},
+				},
+			},
+			{
+				Match:    []string{".github/workflows/optional.yml", ".github/workflows/reinstate.yml"},
+				Required: &optional,
+			},
+			{
+				Match:    []string{".github/workflows/reinstate.yml", ".github/workflows/opted-out.yml"},
+				Required: &required,
+			},
+			{
+				Match:    []string{".github/workflows/always.yml"},
+				Required: &optional,
+			},
+			{
+				Match:             []string{".github/workflows/docs.yml"},
+				Predicates:        predicate.Predicates{Title: &predicate.Title{}},
+				ReplacePredicates: true,
+			},
+		},
+	}
+
+	resolved := workflows.ApplyToolConfig(config)
+
+	require.Equal(t, []string{
+		".github/workflows/always.yml",
+		".github/workflows/ci.yml",
+		".github/workflows/docs.yml",
+		".github/workflows/lint.yml",
+		".github/workflows/opted-out.yml",
+		".github/workflows/optional.yml",
+		".github/workflows/reinstate.yml",
+	}, slices.Sorted(maps.Keys(resolved)))
+
+	require.Equal(t, workflowDirectives{
+		Name:        "Checks",
+		Conclusions: []string{"success", "skipped"},
+		Predicates: predicate.Predicates{
+			HasLabels:     &predicate.HasLabels{"ready"},
+			TargetsBranch: &predicate.TargetsBranch{Pattern: mustRegexp(t, "^main$")},
+		},
+	}, resolved[".github/workflows/ci.yml"].directives)
+	require.False(t, resolved[".github/workflows/ci.yml"].replacePredicates)
+
+	// The workflow's own directives take precedence.
+	require.Equal(t, workflowDirectives{
+		Name:        "Lint",
+		Conclusions: []string{"success"},
+		Predicates: predicate.Predicates{
+			HasLabels:     &predicate.HasLabels{"lint"},
+			TargetsBranch: &predicate.TargetsBranch{Pattern: mustRegexp(t, "^main$")},
+		},
+	}, resolved[".github/workflows/lint.yml"].directives)
+
+	// Replacing the predicates drops the earlier overrides' ones too.
+	require.Equal(t, predicate.Predicates{Title: &predicate.Title{}}, resolved[".github/workflows/docs.yml"].directives.Predicates)
+	require.True(t, resolved[".github/workflows/docs.yml"].replacePredicates)
+
+	require.True(t, resolved[".github/workflows/optional.yml"].directives.Ignore)
+	require.False(t, resolved[".github/workflows/reinstate.yml"].directives.Ignore)
+
+	// `required: true` overrides an `ignore` directive, but `required: false`
+	// doesn't override an `always` directive.
+	require.False(t, resolved[".github/workflows/opted-out.yml"].directives.Ignore)
+	require.False(t, resolved[".github/workflows/always.yml"].directives.Ignore)
+
+	// The original collection isn't changed.
+	require.Empty(t, workflows[".github/workflows/ci.yml"].directives.Name)
+}
+
+func TestMakeApprovalRulesReplacePredicates(t *testing.T) {
+	const path = ".github/workflows/ci.yml"
+
+	wf, err := ParseWorkflow([]byte(`
+on:
+  pull_request:
+    paths: ['src/**']
+`))
+	require.NoError(t, err)
+
+	wf = GitHubWorkflowCollection{path: wf}.ApplyToolConfig(ToolConfig{
+		Workflows: []WorkflowOverride{{
+			Match:             []string{path},
+			Predicates:        predicate.Predicates{HasLabels: &predicate.HasLabels{"ready"}},
+			ReplacePredicates: true,
+		}},
+	})[path]
+
+	result, err := makeApprovalRules(path, wf)
+	require.NoError(t, err)
+
+	require.Equal(t, []*approval.Rule{
+		{
+			Name:       "Workflow .github/workflows/ci.yml succeeded or skipped",
+			Predicates: predicate.Predicates{HasLabels: &predicate.HasLabels{"ready"}},
+			Requires: approval.Requires{
+				Conditions: predicate.Predicates{
+					HasWorkflowResult: &predicate.HasWorkflowResult{
+						Conclusions: SkippedOrSuccess,
+						Workflows:   []string{path},
+					},
+				},
+			},
+		},
+	}, result.Rules)
+}
+
+func TestMakeMergeQueueRulesToolConfig(t *testing.T) {
+	const path = ".github/workflows/queue.yml"
+
+	wf, err := ParseWorkflow([]byte("on: merge_group\n"))
+	require.NoError(t, err)
+
+	named, err := GitHubWorkflowCollection{path: wf}.ApplyToolConfig(ToolConfig{
+		Workflows: []WorkflowOverride{{
+			Match:       []string{path},
+			Name:        "Queue passed",
+			Conclusions: []string{"success"},
+			Predicates:  predicate.Predicates{HasLabels: &predicate.HasLabels{"ready"}},
+		}},
+	}).NameRules(nil)
+	require.NoError(t, err)
+
+	result, err := makeMergeQueueRules(path, named[path])
+	require.NoError(t, err)
+
+	require.Equal(t, []*approval.Rule{
+		{
+			Name: "Queue passed (merge queue)",
+			Predicates: predicate.Predicates{
+				FileNotDeleted: &predicate.FileNotDeleted{Paths: mustRegexpsFromGlobs(t, []string{path})},
+				HasLabels:      &predicate.HasLabels{"ready"},
+			},
+			Requires: workflowResultRequires(path, predicate.AllowedConclusions{"success"}),
+		},
+	}, result.Rules)
+}
+
+// yamlKeys returns the YAML keys of a struct's fields, in order.
+func yamlKeys(t reflect.Type) []string {
+	var keys []string
+	for field := range t.Fields() {
+		if key, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+// TestToolConfigSchema checks that the documented schema has the same keys as
+// the config we parse, so that they don't drift apart.
+func TestToolConfigSchema(t *testing.T) {
+	contents, err := os.ReadFile("../generate-policy-bot-config.schema.json")
+	require.NoError(t, err)
+
+	type object struct {
+		Properties map[string]struct {
+			Items struct {
+				Enum []string `json:"enum"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+
+	var schema struct {
+		object
+		Defs struct {
+			WorkflowOverride object `json:"workflowOverride"`
+		} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(contents, &schema))
+
+	keys := func(o object) []string {
+		var keys []string
+		for key := range o.Properties {
+			keys = append(keys, key)
+		}
+
+		slices.Sort(keys)
+		return keys
+	}
+
+	require.Equal(t, yamlKeys(reflect.TypeFor[ToolConfig]()), keys(schema.object))
+	require.Equal(t, yamlKeys(reflect.TypeFor[WorkflowOverride]()), keys(schema.Defs.WorkflowOverride))
+	require.Equal(t, workflowConclusions, schema.Defs.WorkflowOverride.Properties["conclusions"].Items.Enum)
+}
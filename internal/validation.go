@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// pullRequestActivityTypes are the activity types of the `pull_request` and
+// `pull_request_target` events.
+//
+// https://docs.github.com/en/actions/writing-workflows/choosing-when-your-workflow-runs/events-that-trigger-workflows#pull_request
+var pullRequestActivityTypes = []string{
+	"assigned", "unassigned", "labeled", "unlabeled", "opened", "edited",
+	"closed", "reopened", "synchronize", "converted_to_draft",
+	"ready_for_review", "locked", "unlocked", "review_requested",
+	"review_request_removed", "auto_merge_enabled", "auto_merge_disabled",
+	"milestoned", "demilestoned", "enqueued", "dequeued",
+}
+
+// pullRequestReviewActivityTypes are the activity types of the
+// `pull_request_review` event.
+var pullRequestReviewActivityTypes = []string{"submitted", "edited", "dismissed"}
+
+// issueCommentActivityTypes are the activity types of the `issue_comment`
+// event.
+var issueCommentActivityTypes = []string{"created", "edited", "deleted"}
+
+// mergeGroupActivityTypes are the activity types of the `merge_group` event.
+var mergeGroupActivityTypes = []string{"checks_requested"}
+
+// workflowRunActivityTypes are the activity types of the `workflow_run`
+// event.
+var workflowRunActivityTypes = []string{"completed", "requested", "in_progress"}
+
+// validateFilter checks that a trigger doesn't have both a filter and its
+// ignore list, like `paths` and `paths-ignore`, which GitHub doesn't allow.
+func validateFilter(event, name string, filter, ignore []string, pos Position) error {
+	if len(filter) == 0 || len(ignore) == 0 {
+		return nil
+	}
+
+	return errInvalidTrigger{
+		Event: event,
+		Msg:   fmt.Sprintf("`%s` and `%s-ignore` can't both be set", name, name),
+		Pos:   pos,
+	}
+}
+
+// validateTypes checks that a trigger's activity types are ones the event
+// has.
+func validateTypes(event string, types, known []string, pos Position) error {
+	var unknown []string
+	for _, t := range types {
+		if !slices.Contains(known, t) {
+			unknown = append(unknown, t)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	return errInvalidTrigger{
+		Event: event,
+		Msg:   fmt.Sprintf("unknown activity types: %s", strings.Join(unknown, ", ")),
+		Pos:   pos,
+	}
+}
+
+// validateTriggers checks the workflow's triggers the way GitHub does when the
+// workflow is pushed. GitHub never runs a workflow which fails these checks, so
+// we mustn't require it either. It returns all the problems, joined.
+func (wf GitHubWorkflow) validateTriggers() error {
+	var problems []error
+
+	for _, trigger := range wf.pullRequestTriggers() {
+		problems = append(problems,
+			validateFilter(trigger.Event, "branches", trigger.Branches, trigger.BranchesIgnore, trigger.Pos),
+			validateFilter(trigger.Event, "paths", trigger.Paths, trigger.PathsIgnore, trigger.Pos),
+			validateTypes(trigger.Event, trigger.Types, pullRequestActivityTypes, trigger.Pos),
+		)
+	}
+
+	if pr := wf.On.PullRequestReview; pr != nil {
+		problems = append(problems, validateTypes("pull_request_review", pr.Types, pullRequestReviewActivityTypes, pr.Pos))
+	}
+
+	if ic := wf.On.IssueComment; ic != nil {
+		problems = append(problems, validateTypes("issue_comment", ic.Types, issueCommentActivityTypes, ic.Pos))
+	}
+
+	if mg := wf.On.MergeGroup; mg != nil {
+		problems = append(problems,
+			validateFilter("merge_group", "branches", mg.Branches, mg.BranchesIgnore, mg.Pos),
+			validateTypes("merge_group", mg.Types, mergeGroupActivityTypes, mg.Pos),
+		)
+	}
+
+	if push := wf.On.Push; push != nil {
+		problems = append(problems,
+			validateFilter("push", "branches", push.Branches, push.BranchesIgnore, push.Pos),
+			validateFilter("push", "paths", push.Paths, push.PathsIgnore, push.Pos),
+		)
+	}
+
+	if wr := wf.On.WorkflowRun; wr != nil {
+		problems = append(problems,
+			validateFilter("workflow_run", "branches", wr.Branches, wr.BranchesIgnore, wr.Pos),
+			validateTypes("workflow_run", wr.Types, workflowRunActivityTypes, wr.Pos),
+		)
+	}
+
+	return errors.Join(problems...)
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateTriggers(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yamlContent string
+		expected    []string
+	}{
+		{
+			name: "valid",
+			yamlContent: `
+on:
+  pull_request:
+    types: [opened, synchronize, reopened, ready_for_review]
+    branches: [main]
+    paths-ignore: [docs/**]
+  pull_request_review:
+    types: [submitted]
+  merge_group:
+    types: [checks_requested]
+  push:
+    branches-ignore: [gh-pages]
+    paths: [src/**]
+  workflow_run:
+    workflows: [CI]
+    types: [completed]
+`,
+		},
+		{
+			name: "paths and paths-ignore",
+			yamlContent: `
+on:
+  pull_request:
+    paths: [src/**]
+    paths-ignore: [docs/**]
+`,
+			expected: []string{"invalid `pull_request` trigger: `paths` and `paths-ignore` can't both be set"},
+		},
+		{
+			name: "branches and branches-ignore",
+			yamlContent: `
+on:
+  pull_request_target:
+    branches: [main]
+    branches-ignore: [release/**]
+  push:
+    branches: [main]
+    branches-ignore: [release/**]
+`,
+			expected: []string{
+				"invalid `pull_request_target` trigger: `branches` and `branches-ignore` can't both be set",
+				"invalid `push` trigger: `branches` and `branches-ignore` can't both be set",
+			},
+		},
+		{
+			name: "unknown activity types",
+			yamlContent: `
+on:
+  pull_request:
+    types: [opened, synchronised, pushed]
+  issue_comment:
+    types: [submitted]
+  workflow_run:
+    workflows: [CI]
+    types: [finished]
+`,
+			expected: []string{
+				"invalid `pull_request` trigger: unknown activity types: synchronised, pushed",
+				"invalid `issue_comment` trigger: unknown activity types: submitted",
+				"invalid `workflow_run` trigger: unknown activity types: finished",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var wf GitHubWorkflow
+			require.NoError(t, yaml.Unmarshal([]byte(tc.yamlContent), &wf))
+
+			err := wf.validateTriggers()
+			if len(tc.expected) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			for _, msg := range tc.expected {
+				require.ErrorContains(t, err, msg)
+			}
+
+			var invalid errInvalidTrigger
+			require.ErrorAs(t, err, &invalid)
+			require.Equal(t, 3, ErrorPosition(err).Line)
+		})
+	}
+}
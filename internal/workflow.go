@@ -2,7 +2,10 @@ package internal
 
 import (
 	"fmt"
+	"log/slog"
+	"maps"
 	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,64 +21,253 @@ var defaultTypes = []string{
 // gitHubWorkflowOnPullRequest represents the configuration for pull request
 // triggers in a GitHub Actions workflow.
 type gitHubWorkflowOnPullRequest struct {
-	Branches    []string
-	Paths       []string
-	PathsIgnore []string `yaml:"paths-ignore"`
-	Types       []string
+	Branches       []string
+	BranchesIgnore []string `yaml:"branches-ignore"`
+	Paths          []string
+	PathsIgnore    []string `yaml:"paths-ignore"`
+	Types          []string
+	Pos            Position `yaml:"-"`
 }
 
-// githubWorkflowHeader represents the 'on' section of a GitHub Actions workflow file.
+// gitHubWorkflowOnPullRequestReview represents the configuration for pull
+// request review triggers in a GitHub Actions workflow. GitHub doesn't support
+// branch or path filters for this event.
+type gitHubWorkflowOnPullRequestReview struct {
+	Types []string
+	Pos   Position `yaml:"-"`
+}
+
+// Default here:
+// https://docs.github.com/en/actions/using-workflows/events-that-trigger-workflows#pull_request_review
+var defaultReviewTypes = []string{
+	"submitted",
+	"edited",
+	"dismissed",
+}
+
+// gitHubWorkflowOnIssueComment represents the configuration for issue comment
+// triggers in a GitHub Actions workflow. These fire for comments on pull
+// requests too, which is how ChatOps commands like `/test integration` work.
+type gitHubWorkflowOnIssueComment struct {
+	Types []string
+	Pos   Position `yaml:"-"`
+}
+
+// gitHubWorkflowOnMergeGroup represents the configuration for merge queue
+// triggers in a GitHub Actions workflow. The branch filters apply to the
+// branch the merge queue is merging into.
+type gitHubWorkflowOnMergeGroup struct {
+	Branches       []string
+	BranchesIgnore []string `yaml:"branches-ignore"`
+	Types          []string
+	Pos            Position `yaml:"-"`
+}
+
+// gitHubWorkflowOnPush represents the configuration for push triggers in a
+// GitHub Actions workflow. We only use these to find workflows which run in a
+// merge queue by pushing to its temporary branches.
+type gitHubWorkflowOnPush struct {
+	Branches       []string
+	BranchesIgnore []string `yaml:"branches-ignore"`
+	Paths          []string
+	PathsIgnore    []string `yaml:"paths-ignore"`
+	Pos            Position `yaml:"-"`
+}
+
+// gitHubWorkflowOnWorkflowRun represents the configuration for `workflow_run`
+// triggers in a GitHub Actions workflow. These run after another workflow,
+// identified by its name. The branch filters apply to the branch the other
+// workflow ran on: for a pull request, that's its head branch.
+type gitHubWorkflowOnWorkflowRun struct {
+	Workflows      []string
+	Branches       []string
+	BranchesIgnore []string `yaml:"branches-ignore"`
+	Types          []string
+	Pos            Position `yaml:"-"`
+}
+
+// githubWorkflowHeader represents the 'on' section of a GitHub Actions workflow
+// file. The position of each trigger is the position of its event name.
 type githubWorkflowHeader struct {
-	PullRequest       *gitHubWorkflowOnPullRequest `yaml:"pull_request"`
-	PullRequestTarget *gitHubWorkflowOnPullRequest `yaml:"pull_request_target"`
+	PullRequest       *gitHubWorkflowOnPullRequest       `yaml:"pull_request"`
+	PullRequestTarget *gitHubWorkflowOnPullRequest       `yaml:"pull_request_target"`
+	PullRequestReview *gitHubWorkflowOnPullRequestReview `yaml:"pull_request_review"`
+	IssueComment      *gitHubWorkflowOnIssueComment      `yaml:"issue_comment"`
+	MergeGroup        *gitHubWorkflowOnMergeGroup        `yaml:"merge_group"`
+	Push              *gitHubWorkflowOnPush              `yaml:"push"`
+	WorkflowRun       *gitHubWorkflowOnWorkflowRun       `yaml:"workflow_run"`
+	Pos               Position                           `yaml:"-"`
+}
+
+// upstreamWorkflow is a pull request workflow which, when it runs, triggers
+// another workflow through one or more `workflow_run` events.
+type upstreamWorkflow struct {
+	Path     string
+	Workflow GitHubWorkflow
+}
+
+// workflowConcurrency represents the `concurrency` setting of a workflow or a
+// job. It can be given as just the group's name.
+type workflowConcurrency struct {
+	Group            string
+	CancelInProgress string   `yaml:"cancel-in-progress"`
+	Pos              Position `yaml:"-"`
+}
+
+// UnmarshalYAML implements custom unmarshaling for workflowConcurrency.
+func (wc *workflowConcurrency) UnmarshalYAML(node *yaml.Node) error {
+	wc.Pos = positionOf(node)
+
+	if node.Kind == yaml.ScalarNode {
+		wc.Group = node.Value
+		return nil
+	}
+
+	type rawConcurrency workflowConcurrency
+	return node.Decode((*rawConcurrency)(wc))
+}
+
+// cancelsInProgress checks if the concurrency setting cancels a run which is in
+// progress when a newer one starts, for runs triggered by event. The setting
+// can be an expression: unless we know it's false, it might cancel.
+func (wc *workflowConcurrency) cancelsInProgress(event string) bool {
+	if wc == nil || strings.TrimSpace(wc.CancelInProgress) == "" {
+		return false
+	}
+
+	value, err := conditionContext(event).evaluateCondition(wc.CancelInProgress)
+	if err != nil || !value.Known {
+		return true
+	}
+
+	return value.Value == true
+}
+
+// workflowPermissions represents the `permissions` of a workflow or a job.
+// They are either one level for all scopes, like `read-all`, or a level for
+// each scope.
+type workflowPermissions struct {
+	All    string
+	Scopes map[string]string
+	Pos    Position `yaml:"-"`
+}
+
+// UnmarshalYAML implements custom unmarshaling for workflowPermissions.
+func (wp *workflowPermissions) UnmarshalYAML(node *yaml.Node) error {
+	wp.Pos = positionOf(node)
+
+	if node.Kind == yaml.ScalarNode {
+		wp.All = node.Value
+		return nil
+	}
+
+	return node.Decode(&wp.Scopes)
 }
 
-// GitHubWorkflow represents a GitHub Actions workflow file.
+// GitHubWorkflow represents a GitHub Actions workflow file. The position of
+// each job is the position of its ID.
 type GitHubWorkflow struct {
-	On githubWorkflowHeader
+	Name        string
+	RunName     string `yaml:"run-name"`
+	On          githubWorkflowHeader
+	Concurrency *workflowConcurrency
+	Permissions *workflowPermissions
+	Jobs        map[string]gitHubWorkflowJob
+
+	// triggeredBy is filled in by ResolveWorkflowRuns.
+	triggeredBy []upstreamWorkflow
+	// directives are filled in by ParseWorkflow.
+	directives workflowDirectives
+	// invalidDirectives are the directive comments ParseWorkflow left out.
+	invalidDirectives []error
+	// jobStatuses is set by RequireJobStatuses.
+	jobStatuses JobStatusMode
+	// localActions are filled in by ResolveLocalActions.
+	localActions []string
+	// largeDiffs is set by HandleLargeDiffs.
+	largeDiffs largeDiffs
+	// ruleName is set by NameRules.
+	ruleName string
+	// replacePredicates is set by ApplyToolConfig.
+	replacePredicates bool
 }
 
 // GitHubWorkflowCollection represents a collection of GitHub Actions workflows.
 // It is a map where the key is the workflow's path.
 type GitHubWorkflowCollection map[string]GitHubWorkflow
 
+// UnmarshalYAML implements custom unmarshaling for GitHubWorkflow, to record
+// the positions of the jobs.
+func (wf *GitHubWorkflow) UnmarshalYAML(node *yaml.Node) error {
+	type rawWorkflow GitHubWorkflow
+	if err := node.Decode((*rawWorkflow)(wf)); err != nil {
+		return err
+	}
+
+	jobs, _ := mappingValue(node, "jobs")
+	if jobs == nil {
+		return nil
+	}
+
+	for id, pos := range keyPositions(jobs) {
+		if job, ok := wf.Jobs[id]; ok {
+			job.Pos = pos
+			wf.Jobs[id] = job
+		}
+	}
+
+	return nil
+}
+
 // UnmarshalYAML implements custom unmarshaling for githubWorkflowHeader. This
 // is needed because the `on` field can be a string, list or map.
 func (wfh *githubWorkflowHeader) UnmarshalYAML(node *yaml.Node) error {
 	var rawValue interface{}
 	if err := node.Decode(&rawValue); err != nil {
-		return errWorkflowParse{Err: err}
+		return errWorkflowParse{Err: err, Pos: positionOf(node)}
 	}
 
+	wfh.Pos = positionOf(node)
+
 	switch v := rawValue.(type) {
 	case string:
-		return wfh.unmarshalString(v)
+		return wfh.unmarshalString(v, positionOf(node))
 	case []interface{}:
-		return wfh.unmarshalList(v)
+		return wfh.unmarshalList(node)
 	case map[string]interface{}:
 		return wfh.unmarshalMap(node)
 	default:
-		return errUnexpectedType{Type: fmt.Sprintf("%T", v)}
+		return errUnexpectedType{Type: fmt.Sprintf("%T", v), Pos: positionOf(node)}
 	}
 }
 
 // unmarshalString handles unmarshaling when the 'on' field is a string.
-func (wfh *githubWorkflowHeader) unmarshalString(s string) error {
+func (wfh *githubWorkflowHeader) unmarshalString(s string, pos Position) error {
 	switch s {
 	case "pull_request":
-		wfh.PullRequest = &gitHubWorkflowOnPullRequest{}
+		wfh.PullRequest = &gitHubWorkflowOnPullRequest{Pos: pos}
 	case "pull_request_target":
-		wfh.PullRequestTarget = &gitHubWorkflowOnPullRequest{}
+		wfh.PullRequestTarget = &gitHubWorkflowOnPullRequest{Pos: pos}
+	case "pull_request_review":
+		wfh.PullRequestReview = &gitHubWorkflowOnPullRequestReview{Pos: pos}
+	case "issue_comment":
+		wfh.IssueComment = &gitHubWorkflowOnIssueComment{Pos: pos}
+	case "merge_group":
+		wfh.MergeGroup = &gitHubWorkflowOnMergeGroup{Pos: pos}
+	case "push":
+		wfh.Push = &gitHubWorkflowOnPush{Pos: pos}
+	case "workflow_run":
+		wfh.WorkflowRun = &gitHubWorkflowOnWorkflowRun{Pos: pos}
 	}
 	return nil
 }
 
 // unmarshalList handles unmarshaling when the 'on' field is a list.
-func (wfh *githubWorkflowHeader) unmarshalList(list []interface{}) error {
-	for _, item := range list {
-		if s, ok := item.(string); ok {
-			if err := wfh.unmarshalString(s); err != nil {
-				return errWorkflowParse{Err: err}
+func (wfh *githubWorkflowHeader) unmarshalList(node *yaml.Node) error {
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode {
+			if err := wfh.unmarshalString(item.Value, positionOf(item)); err != nil {
+				return errWorkflowParse{Err: err, Pos: positionOf(item)}
 			}
 		}
 	}
@@ -86,98 +278,423 @@ func (wfh *githubWorkflowHeader) unmarshalList(list []interface{}) error {
 func (wfh *githubWorkflowHeader) unmarshalMap(node *yaml.Node) error {
 	type rawHeader githubWorkflowHeader
 	if err := node.Decode((*rawHeader)(wfh)); err != nil {
-		return errWorkflowParse{Err: err}
+		return errWorkflowParse{Err: err, Pos: positionOf(node)}
 	}
 
 	// This section handles the case where the 'on' field is a map, but the
-	// `pull_request` or `pull_request_target` keys are empty, i.e. `on:
-	// {pull_request: {}}`.
-	var raw map[string]interface{}
-	if err := node.Decode(&raw); err != nil {
-		return errWorkflowParse{Err: err}
-	}
+	// keys for the events we're interested in are empty, i.e. `on:
+	// {pull_request: {}}`. It also records the position of each event.
+	keys := keyPositions(node)
 
-	if _, ok := raw["pull_request"]; wfh.PullRequest == nil && ok {
-		wfh.PullRequest = &gitHubWorkflowOnPullRequest{}
+	if pos, ok := keys["pull_request"]; ok {
+		if wfh.PullRequest == nil {
+			wfh.PullRequest = &gitHubWorkflowOnPullRequest{}
+		}
+		wfh.PullRequest.Pos = pos
+	}
+	if pos, ok := keys["pull_request_target"]; ok {
+		if wfh.PullRequestTarget == nil {
+			wfh.PullRequestTarget = &gitHubWorkflowOnPullRequest{}
+		}
+		wfh.PullRequestTarget.Pos = pos
 	}
-	if _, ok := raw["pull_request_target"]; wfh.PullRequestTarget == nil && ok {
-		wfh.PullRequestTarget = &gitHubWorkflowOnPullRequest{}
+	if pos, ok := keys["pull_request_review"]; ok {
+		if wfh.PullRequestReview == nil {
+			wfh.PullRequestReview = &gitHubWorkflowOnPullRequestReview{}
+		}
+		wfh.PullRequestReview.Pos = pos
+	}
+	if pos, ok := keys["issue_comment"]; ok {
+		if wfh.IssueComment == nil {
+			wfh.IssueComment = &gitHubWorkflowOnIssueComment{}
+		}
+		wfh.IssueComment.Pos = pos
+	}
+	if pos, ok := keys["merge_group"]; ok {
+		if wfh.MergeGroup == nil {
+			wfh.MergeGroup = &gitHubWorkflowOnMergeGroup{}
+		}
+		wfh.MergeGroup.Pos = pos
+	}
+	if pos, ok := keys["push"]; ok {
+		if wfh.Push == nil {
+			wfh.Push = &gitHubWorkflowOnPush{}
+		}
+		wfh.Push.Pos = pos
+	}
+	if pos, ok := keys["workflow_run"]; ok {
+		if wfh.WorkflowRun == nil {
+			wfh.WorkflowRun = &gitHubWorkflowOnWorkflowRun{}
+		}
+		wfh.WorkflowRun.Pos = pos
 	}
 
 	return nil
 }
 
-// IsPullRequestWorkflow checks if the workflow is triggered by pull requests.
-func (wf GitHubWorkflow) IsPullRequestWorkflow() bool {
-	return wf.On.PullRequest != nil || wf.On.PullRequestTarget != nil
+// pullRequestTrigger is one of the events which run a workflow for pull
+// requests, along with its configuration.
+type pullRequestTrigger struct {
+	Event string
+	*gitHubWorkflowOnPullRequest
 }
 
-// branches returns the combined branches from PullRequest and PullRequestTarget.
-// These are the branches that might trigger a run on a pull request.
-func (wf GitHubWorkflow) branches() []string {
-	var branches []string
+// pullRequestTriggers returns the workflow's pull request triggers. Each one
+// has its own filters, and the workflow runs if any of them fires.
+func (wf GitHubWorkflow) pullRequestTriggers() []pullRequestTrigger {
+	var triggers []pullRequestTrigger
 	if wf.On.PullRequest != nil {
-		branches = append(branches, wf.On.PullRequest.Branches...)
+		triggers = append(triggers, pullRequestTrigger{"pull_request", wf.On.PullRequest})
 	}
 	if wf.On.PullRequestTarget != nil {
-		branches = append(branches, wf.On.PullRequestTarget.Branches...)
+		triggers = append(triggers, pullRequestTrigger{"pull_request_target", wf.On.PullRequestTarget})
 	}
-	return branches
+	return triggers
+}
+
+// types returns the activity types the trigger fires for: its `types`, or
+// GitHub's default ones if it doesn't have any.
+func (pr gitHubWorkflowOnPullRequest) types() []string {
+	if len(pr.Types) == 0 {
+		return defaultTypes
+	}
+
+	return pr.Types
+}
+
+// runsOn checks if the trigger fires for the given activity type, like
+// `labeled`.
+func (pr gitHubWorkflowOnPullRequest) runsOn(activity string) bool {
+	return slices.Contains(pr.types(), activity)
+}
+
+// runsOnSynchronize checks if the trigger fires when new commits are pushed to
+// the pull request.
+func (pr gitHubWorkflowOnPullRequest) runsOnSynchronize() bool {
+	return pr.runsOn("synchronize")
+}
+
+// IsWorkflowRunForPullRequest checks if the workflow runs after a pull request
+// workflow, through a chain of `workflow_run` events. It is only set on
+// workflows returned from ResolveWorkflowRuns.
+func (wf GitHubWorkflow) IsWorkflowRunForPullRequest() bool {
+	return len(wf.triggeredBy) > 0
 }
 
-// paths returns the combined paths from PullRequest and PullRequestTarget.
-// These are the paths that might trigger a run on a pull request.
-func (wf GitHubWorkflow) paths() []string {
+// ResolveWorkflowRuns follows each workflow's `workflow_run` triggers back to
+// the pull request workflows which start the chain, and returns a copy of the
+// collection with that recorded. `workflow_run` refers to workflows by name,
+// which is the file's path if the workflow doesn't set one. Cycles are
+// followed only once. Only upstream workflows which RunsForPullRequests count,
+// since we can't require the others either.
+func (workflows GitHubWorkflowCollection) ResolveWorkflowRuns() GitHubWorkflowCollection {
+	byName := make(map[string][]string)
+	for path, wf := range workflows {
+		name := wf.Name
+		if name == "" {
+			name = path
+		}
+		byName[name] = append(byName[name], path)
+	}
+
+	var resolve func(wf GitHubWorkflow, visited map[string]bool) []upstreamWorkflow
+	resolve = func(wf GitHubWorkflow, visited map[string]bool) []upstreamWorkflow {
+		if wf.On.WorkflowRun == nil {
+			return nil
+		}
+
+		var upstream []upstreamWorkflow
+		for _, name := range wf.On.WorkflowRun.Workflows {
+			paths := slices.Clone(byName[name])
+			slices.Sort(paths)
+
+			for _, path := range paths {
+				if visited[path] {
+					continue
+				}
+				visited[path] = true
+
+				upstreamWf := workflows[path]
+				if upstreamWf.RunsForPullRequests() {
+					upstream = append(upstream, upstreamWorkflow{Path: path, Workflow: upstreamWf})
+				}
+
+				upstream = append(upstream, resolve(upstreamWf, visited)...)
+			}
+		}
+
+		return upstream
+	}
+
+	resolved := make(GitHubWorkflowCollection, len(workflows))
+	for path, wf := range workflows {
+		wf.triggeredBy = resolve(wf, map[string]bool{path: true})
+		resolved[path] = wf
+	}
+
+	return resolved
+}
+
+// localWorkflowPath returns the path of the workflow a job calls, if it `uses`
+// a reusable workflow in the same repository, like
+// `./.github/workflows/build.yml`.
+func (job gitHubWorkflowJob) localWorkflowPath() (string, bool) {
+	path, ok := strings.CutPrefix(job.Uses, "./")
+	if !ok || !strings.HasPrefix(path, ".github/workflows/") {
+		return "", false
+	}
+
+	return path, true
+}
+
+// ResolveReusableWorkflows finds the local reusable workflows which the jobs
+// of each workflow call, and returns a copy of the collection with them
+// recorded on the jobs, along with the workflows they call in turn. Calls
+// which would go round in a cycle aren't followed, and GitHub doesn't run them
+// anyway. Cycles, and calls to workflows which don't exist, are reported once
+// for the workflow where they start.
+func (workflows GitHubWorkflowCollection) ResolveReusableWorkflows() GitHubWorkflowCollection {
+	var resolve func(root, caller string, wf GitHubWorkflow, visited map[string]bool) GitHubWorkflow
+	resolve = func(root, caller string, wf GitHubWorkflow, visited map[string]bool) GitHubWorkflow {
+		jobs := make(map[string]gitHubWorkflowJob, len(wf.Jobs))
+		for id, job := range wf.Jobs {
+			jobs[id] = job
+
+			path, ok := job.localWorkflowPath()
+			if !ok {
+				continue
+			}
+
+			callee, ok := workflows[path]
+			switch {
+			case !ok:
+				if caller == root {
+					slog.Warn("job calls a reusable workflow which doesn't exist", "path", root, "job", id, "uses", job.Uses)
+				}
+			case visited[path]:
+				if path == root {
+					slog.Warn("reusable workflows call each other in a cycle, GitHub won't run them", "path", root, "job", id, "caller", caller)
+				}
+			default:
+				visited := maps.Clone(visited)
+				visited[path] = true
+				job.callee = &upstreamWorkflow{Path: path, Workflow: resolve(root, path, callee, visited)}
+				jobs[id] = job
+			}
+		}
+
+		if wf.Jobs != nil {
+			wf.Jobs = jobs
+		}
+		return wf
+	}
+
+	resolved := make(GitHubWorkflowCollection, len(workflows))
+	for path, wf := range workflows {
+		resolved[path] = resolve(path, path, wf, map[string]bool{path: true})
+	}
+
+	return resolved
+}
+
+// calleePaths returns the paths of the local reusable workflows which the
+// workflow's jobs call, directly or through other reusable workflows, in
+// order. It is only set on workflows returned from ResolveReusableWorkflows.
+func (wf GitHubWorkflow) calleePaths() []string {
 	var paths []string
-	if wf.On.PullRequest != nil {
-		paths = append(paths, wf.On.PullRequest.Paths...)
+	for _, job := range wf.Jobs {
+		if job.callee == nil {
+			continue
+		}
+
+		paths = append(paths, job.callee.Path)
+		paths = append(paths, job.callee.Workflow.calleePaths()...)
 	}
-	if wf.On.PullRequestTarget != nil {
-		paths = append(paths, wf.On.PullRequestTarget.Paths...)
+
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+// RequireJobStatuses returns a copy of the collection in which the workflows
+// require the statuses of their jobs as well as, or instead of, the result of
+// the whole workflow (see JobStatusMode).
+func (workflows GitHubWorkflowCollection) RequireJobStatuses(mode JobStatusMode) GitHubWorkflowCollection {
+	resolved := make(GitHubWorkflowCollection, len(workflows))
+	for path, wf := range workflows {
+		wf.jobStatuses = mode
+		resolved[path] = wf
 	}
-	return paths
+
+	return resolved
 }
 
-// ignorePaths returns the combined ignore paths from PullRequest and
-// PullRequestTarget. These are the paths that should be ignored when
-// determining if a run should be triggered on a pull request.
-func (wf GitHubWorkflow) ignorePaths() []string {
-	var ignorePaths []string
+// TriggerPosition returns the position of the first of the given triggers which
+// the workflow has, like `pull_request`, or of its `on` section if it has none
+// of them.
+func (wf GitHubWorkflow) TriggerPosition(events ...string) Position {
+	positions := map[string]Position{}
 	if wf.On.PullRequest != nil {
-		ignorePaths = append(ignorePaths, wf.On.PullRequest.PathsIgnore...)
+		positions["pull_request"] = wf.On.PullRequest.Pos
 	}
 	if wf.On.PullRequestTarget != nil {
-		ignorePaths = append(ignorePaths, wf.On.PullRequestTarget.PathsIgnore...)
+		positions["pull_request_target"] = wf.On.PullRequestTarget.Pos
+	}
+	if wf.On.PullRequestReview != nil {
+		positions["pull_request_review"] = wf.On.PullRequestReview.Pos
+	}
+	if wf.On.IssueComment != nil {
+		positions["issue_comment"] = wf.On.IssueComment.Pos
+	}
+	if wf.On.MergeGroup != nil {
+		positions["merge_group"] = wf.On.MergeGroup.Pos
+	}
+	if wf.On.Push != nil {
+		positions["push"] = wf.On.Push.Pos
+	}
+	if wf.On.WorkflowRun != nil {
+		positions["workflow_run"] = wf.On.WorkflowRun.Pos
 	}
-	return ignorePaths
+
+	for _, event := range events {
+		if pos, ok := positions[event]; ok {
+			return pos
+		}
+	}
+
+	return wf.On.Pos
 }
 
-func (wf GitHubWorkflow) types() []string {
-	if wf.On.PullRequest == nil && wf.On.PullRequestTarget == nil {
+// IsPullRequestWorkflow checks if the workflow is triggered by pull requests.
+func (wf GitHubWorkflow) IsPullRequestWorkflow() bool {
+	return wf.On.PullRequest != nil || wf.On.PullRequestTarget != nil
+}
+
+// IsPullRequestReviewWorkflow checks if the workflow is triggered when a
+// review is submitted on a pull request.
+func (wf GitHubWorkflow) IsPullRequestReviewWorkflow() bool {
+	if wf.On.PullRequestReview == nil {
+		return false
+	}
+
+	types := wf.On.PullRequestReview.Types
+	if len(types) == 0 {
+		types = defaultReviewTypes
+	}
+
+	return slices.Contains(types, "submitted")
+}
+
+// IsCommentWorkflow checks if the workflow is triggered by comments, and has
+// opted in to being required with a `status` directive. Runs triggered by
+// comments belong to the default branch's latest commit rather than the pull
+// request's, so policy-bot can only see the status which the workflow reports
+// on the pull request.
+func (wf GitHubWorkflow) IsCommentWorkflow() bool {
+	return wf.On.IssueComment != nil && len(wf.directives.Statuses) > 0
+}
+
+// RunsForPullRequests checks if we can rely on the workflow running for the
+// latest commit of a pull request: either it runs on `synchronize`, or it runs
+// when a review is submitted.
+func (wf GitHubWorkflow) RunsForPullRequests() bool {
+	return (wf.IsPullRequestWorkflow() && wf.RunsOnSynchronize()) || wf.IsPullRequestReviewWorkflow()
+}
+
+// mergeQueueBranchPrefix is the prefix of the temporary branches which GitHub
+// creates for merge queues. Their names look like
+// `gh-readonly-queue/<base branch>/pr-<number>-<sha>`.
+const mergeQueueBranchPrefix = "gh-readonly-queue/"
+
+// mergeQueuePushBranches returns the base branches of the merge queues whose
+// temporary branches trigger the workflow's `push` event. Only branch filters
+// which explicitly name the merge queue's branches count: a `push` workflow
+// without filters runs in the merge queue too, but it isn't meant for it.
+func (wf GitHubWorkflow) mergeQueuePushBranches() []string {
+	if wf.On.Push == nil {
 		return nil
 	}
 
-	var types []string
-	if wf.On.PullRequest != nil {
-		types = append(types, wf.On.PullRequest.Types...)
+	var branches []string
+	for _, branch := range wf.On.Push.Branches {
+		rest, ok := strings.CutPrefix(branch, mergeQueueBranchPrefix)
+		if !ok {
+			continue
+		}
+
+		// The first path component of the rest of the branch is the base
+		// branch. `gh-readonly-queue/**` matches the queues for all of them.
+		base, _, _ := strings.Cut(rest, "/")
+		if base == "*" || strings.HasPrefix(base, "**") {
+			base = matchAll
+		}
+
+		branches = append(branches, base)
 	}
-	if wf.On.PullRequestTarget != nil {
-		types = append(types, wf.On.PullRequestTarget.Types...)
+
+	return branches
+}
+
+// cancelsSupersededRuns checks if the workflow, one of its jobs, or one of the
+// reusable workflows it calls has a `concurrency` setting which cancels runs in
+// progress, for any of the events we require the workflow on. When pushes or
+// other events race, the superseded runs end up `cancelled`.
+func (wf GitHubWorkflow) cancelsSupersededRuns() bool {
+	var events []string
+	for _, trigger := range wf.pullRequestTriggers() {
+		events = append(events, trigger.Event)
+	}
+	if wf.On.PullRequestReview != nil {
+		events = append(events, "pull_request_review")
+	}
+	if wf.IsCommentWorkflow() {
+		events = append(events, "issue_comment")
+	}
+	if wf.On.MergeGroup != nil {
+		events = append(events, "merge_group")
+	}
+	if len(wf.mergeQueuePushBranches()) > 0 {
+		events = append(events, "push")
+	}
+	if wf.On.WorkflowRun != nil {
+		events = append(events, "workflow_run")
 	}
 
-	if len(types) == 0 {
-		return defaultTypes
+	return slices.ContainsFunc(events, wf.cancelsInProgress)
+}
+
+// cancelsInProgress checks if the workflow, one of its jobs, or one of the
+// reusable workflows it calls cancels runs in progress, for runs triggered by
+// event. Called workflows see the caller's event.
+func (wf GitHubWorkflow) cancelsInProgress(event string) bool {
+	if wf.Concurrency.cancelsInProgress(event) {
+		return true
+	}
+
+	for _, job := range wf.Jobs {
+		if job.Concurrency.cancelsInProgress(event) {
+			return true
+		}
+
+		if job.callee != nil && job.callee.Workflow.cancelsInProgress(event) {
+			return true
+		}
 	}
 
-	// Dedupe
-	slices.Sort(types)
-	_ = slices.Compact(types)
+	return false
+}
 
-	return types
+// IsMergeQueueWorkflow checks if the workflow runs in a merge queue, either
+// on the `merge_group` event or on pushes to the merge queue's branches.
+func (wf GitHubWorkflow) IsMergeQueueWorkflow() bool {
+	return wf.On.MergeGroup != nil || len(wf.mergeQueuePushBranches()) > 0
 }
 
+// RunsOnSynchronize checks if any of the workflow's pull request triggers
+// fires when new commits are pushed to the pull request. Each trigger has its
+// own types, and only the triggers which do are required (see
+// pullRequestTriggerFilters).
 func (wf GitHubWorkflow) RunsOnSynchronize() bool {
-	types := wf.types()
-
-	return slices.Contains(types, "synchronize")
+	return slices.ContainsFunc(wf.pullRequestTriggers(), func(trigger pullRequestTrigger) bool {
+		return trigger.runsOnSynchronize()
+	})
 }
@@ -83,6 +83,201 @@ on:
 				},
 			},
 		},
+		{
+			name: "on as map with branches-ignore",
+			yamlContent: `
+on:
+  pull_request:
+    branches-ignore: [release/**]
+`,
+			expected: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					PullRequest: &gitHubWorkflowOnPullRequest{
+						BranchesIgnore: []string{"release/**"},
+					},
+				},
+			},
+		},
+		{
+			name: "name and workflow_run",
+			yamlContent: `
+name: Coverage
+on:
+  workflow_run:
+    workflows: [CI]
+    types: [completed]
+`,
+			expected: GitHubWorkflow{
+				Name: "Coverage",
+				On: githubWorkflowHeader{
+					WorkflowRun: &gitHubWorkflowOnWorkflowRun{
+						Workflows: []string{"CI"},
+						Types:     []string{"completed"},
+					},
+				},
+			},
+		},
+		{
+			name: "jobs",
+			yamlContent: `
+on: pull_request
+jobs:
+  e2e:
+    if: contains(github.event.pull_request.labels.*.name, 'run-e2e')
+  report:
+    needs: e2e
+  summary:
+    needs: [e2e, report]
+`,
+			expected: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					PullRequest: &gitHubWorkflowOnPullRequest{},
+				},
+				Jobs: map[string]gitHubWorkflowJob{
+					"e2e":     {If: "contains(github.event.pull_request.labels.*.name, 'run-e2e')"},
+					"report":  {Needs: stringList{"e2e"}},
+					"summary": {Needs: stringList{"e2e", "report"}},
+				},
+			},
+		},
+		{
+			name: "full workflow",
+			yamlContent: `
+name: CI
+run-name: CI for ${{ github.ref }}
+on: pull_request
+concurrency: ci-${{ github.ref }}
+permissions: read-all
+jobs:
+  build:
+    name: Build
+    permissions:
+      contents: read
+    concurrency:
+      group: build
+      cancel-in-progress: true
+    environment:
+      name: staging
+      url: https://staging.example.com
+    strategy:
+      fail-fast: false
+      matrix:
+        os: [ubuntu-latest, macos-latest]
+        go: ${{ fromJSON(needs.setup.outputs.versions) }}
+        include:
+          - os: windows-latest
+            experimental: true
+        exclude:
+          - os: macos-latest
+    steps:
+      - id: checkout
+        uses: actions/checkout@v4
+        with:
+          fetch-depth: 0
+      - name: Build
+        if: success()
+        run: make
+  deploy:
+    needs: build
+    uses: ./.github/workflows/deploy.yml
+    with:
+      environment: staging
+    strategy:
+      matrix: ${{ fromJSON(needs.build.outputs.matrix) }}
+  release:
+    needs: build
+    strategy: ${{ fromJSON(needs.build.outputs.strategy) }}
+    steps:
+      - run: make release
+`,
+			expected: GitHubWorkflow{
+				Name:    "CI",
+				RunName: "CI for ${{ github.ref }}",
+				On: githubWorkflowHeader{
+					PullRequest: &gitHubWorkflowOnPullRequest{},
+				},
+				Concurrency: &workflowConcurrency{Group: "ci-${{ github.ref }}"},
+				Permissions: &workflowPermissions{All: "read-all"},
+				Jobs: map[string]gitHubWorkflowJob{
+					"build": {
+						Name:        "Build",
+						Permissions: &workflowPermissions{Scopes: map[string]string{"contents": "read"}},
+						Concurrency: &workflowConcurrency{Group: "build", CancelInProgress: "true"},
+						Environment: &jobEnvironment{Name: "staging", URL: "https://staging.example.com"},
+						Strategy: &jobStrategy{
+							FailFast: "false",
+							Matrix: &jobMatrix{
+								Dimensions: []matrixDimension{
+									{Key: "os", Values: []interface{}{"ubuntu-latest", "macos-latest"}},
+									{Key: "go", Expression: "${{ fromJSON(needs.setup.outputs.versions) }}"},
+								},
+								Include: []matrixCombination{
+									{{Key: "os", Value: "windows-latest"}, {Key: "experimental", Value: true}},
+								},
+								Exclude: []matrixCombination{
+									{{Key: "os", Value: "macos-latest"}},
+								},
+							},
+						},
+						Steps: []gitHubWorkflowStep{
+							{ID: "checkout", Uses: "actions/checkout@v4", With: map[string]string{"fetch-depth": "0"}},
+							{Name: "Build", If: "success()", Run: "make"},
+						},
+					},
+					"deploy": {
+						Needs: stringList{"build"},
+						Uses:  "./.github/workflows/deploy.yml",
+						With:  map[string]string{"environment": "staging"},
+						Strategy: &jobStrategy{
+							Matrix: &jobMatrix{Expression: "${{ fromJSON(needs.build.outputs.matrix) }}"},
+						},
+					},
+					"release": {
+						Needs: stringList{"build"},
+						Strategy: &jobStrategy{
+							Matrix: &jobMatrix{Expression: "${{ fromJSON(needs.build.outputs.strategy) }}"},
+						},
+						Steps: []gitHubWorkflowStep{{Run: "make release"}},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid matrix",
+			yamlContent: `
+on: pull_request
+jobs:
+  build:
+    strategy:
+      matrix:
+        os: {ubuntu: true}
+`,
+			expectError: true,
+		},
+		{
+			name:        "pull_request_review as string",
+			yamlContent: "on: pull_request_review",
+			expected: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					PullRequestReview: &gitHubWorkflowOnPullRequestReview{},
+				},
+			},
+		},
+		{
+			name: "pull_request_review with types",
+			yamlContent: `
+on:
+  pull_request_review:
+    types: [submitted]
+`,
+			expected: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					PullRequestReview: &gitHubWorkflowOnPullRequestReview{
+						Types: []string{"submitted"},
+					},
+				},
+			},
+		},
 		{
 			name:        "invalid type",
 			yamlContent: "on: 42",
@@ -95,9 +290,36 @@ on:
 		},
 		{
 			name:        "on with unsupported event",
-			yamlContent: "on: push",
+			yamlContent: "on: workflow_dispatch",
 			expected:    GitHubWorkflow{},
 		},
+		{
+			name:        "on as list with merge queue events",
+			yamlContent: "on: [merge_group, push]",
+			expected: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					MergeGroup: &gitHubWorkflowOnMergeGroup{},
+					Push:       &gitHubWorkflowOnPush{},
+				},
+			},
+		},
+		{
+			name: "on as map with merge queue events",
+			yamlContent: `
+on:
+  merge_group:
+  push:
+    branches: [gh-readonly-queue/main/**]
+`,
+			expected: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					MergeGroup: &gitHubWorkflowOnMergeGroup{},
+					Push: &gitHubWorkflowOnPush{
+						Branches: []string{"gh-readonly-queue/main/**"},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -111,7 +333,7 @@ on:
 			}
 
 			require.NoError(t, err)
-			require.Equal(t, tc.expected, wf)
+			require.Equal(t, tc.expected, clearPositions(wf))
 		})
 	}
 }
@@ -165,38 +387,292 @@ func TestGitHubWorkflowIsPullRequestWorkflow(t *testing.T) {
 	}
 }
 
-func TestGitHubWorkflowPaths(t *testing.T) {
+func TestGitHubWorkflowPullRequestTriggers(t *testing.T) {
 	workflow := GitHubWorkflow{
 		On: githubWorkflowHeader{
 			PullRequest: &gitHubWorkflowOnPullRequest{
-				Paths: []string{"src/**", "tests/**"},
+				Paths: []string{"src/**"},
 			},
 			PullRequestTarget: &gitHubWorkflowOnPullRequest{
-				Paths: []string{"docs/**", "README.md"},
+				BranchesIgnore: []string{"release/**"},
 			},
 		},
 	}
 
-	expected := []string{"src/**", "tests/**", "docs/**", "README.md"}
-	result := workflow.paths()
-	require.ElementsMatch(t, expected, result)
+	expected := []pullRequestTrigger{
+		{Event: "pull_request", gitHubWorkflowOnPullRequest: workflow.On.PullRequest},
+		{Event: "pull_request_target", gitHubWorkflowOnPullRequest: workflow.On.PullRequestTarget},
+	}
+	require.Equal(t, expected, workflow.pullRequestTriggers())
 }
 
-func TestGitHubWorkflowIgnorePaths(t *testing.T) {
-	workflow := GitHubWorkflow{
+func TestGitHubWorkflowIsMergeQueueWorkflow(t *testing.T) {
+	testCases := []struct {
+		name             string
+		workflow         GitHubWorkflow
+		expectedBranches []string
+		ok               bool
+	}{
+		{
+			name: "merge_group",
+			workflow: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					MergeGroup: &gitHubWorkflowOnMergeGroup{},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "push to all merge queue branches",
+			workflow: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					Push: &gitHubWorkflowOnPush{
+						Branches: []string{"main", "gh-readonly-queue/**"},
+					},
+				},
+			},
+			expectedBranches: []string{"**"},
+			ok:               true,
+		},
+		{
+			name: "push to one merge queue's branches",
+			workflow: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					Push: &gitHubWorkflowOnPush{
+						Branches: []string{"gh-readonly-queue/main/**"},
+					},
+				},
+			},
+			expectedBranches: []string{"main"},
+			ok:               true,
+		},
+		{
+			name: "push without merge queue branches",
+			workflow: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					Push: &gitHubWorkflowOnPush{},
+				},
+			},
+			ok: false,
+		},
+		{
+			name: "pull_request only",
+			workflow: GitHubWorkflow{
+				On: githubWorkflowHeader{
+					PullRequest: &gitHubWorkflowOnPullRequest{},
+				},
+			},
+			ok: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.ok, tc.workflow.IsMergeQueueWorkflow())
+			require.Equal(t, tc.expectedBranches, tc.workflow.mergeQueuePushBranches())
+		})
+	}
+}
+
+func TestResolveWorkflowRuns(t *testing.T) {
+	ci := GitHubWorkflow{
+		Name: "CI",
 		On: githubWorkflowHeader{
 			PullRequest: &gitHubWorkflowOnPullRequest{
-				PathsIgnore: []string{"vendor/**", "*.md"},
+				Paths: []string{"src/**"},
 			},
-			PullRequestTarget: &gitHubWorkflowOnPullRequest{
-				PathsIgnore: []string{"docs/**", "CHANGELOG.md"},
+		},
+	}
+	unnamed := GitHubWorkflow{
+		On: githubWorkflowHeader{
+			PullRequest: &gitHubWorkflowOnPullRequest{},
+		},
+	}
+
+	workflows := GitHubWorkflowCollection{
+		".github/workflows/ci.yml":      ci,
+		".github/workflows/unnamed.yml": unnamed,
+		".github/workflows/coverage.yml": GitHubWorkflow{
+			Name: "Coverage",
+			On: githubWorkflowHeader{
+				WorkflowRun: &gitHubWorkflowOnWorkflowRun{
+					Workflows: []string{"CI", ".github/workflows/unnamed.yml"},
+				},
 			},
 		},
+		".github/workflows/report.yml": GitHubWorkflow{
+			Name: "Report",
+			On: githubWorkflowHeader{
+				WorkflowRun: &gitHubWorkflowOnWorkflowRun{
+					Workflows: []string{"Coverage", "Report"},
+				},
+			},
+		},
+		".github/workflows/after-deploy.yml": GitHubWorkflow{
+			On: githubWorkflowHeader{
+				WorkflowRun: &gitHubWorkflowOnWorkflowRun{
+					Workflows: []string{"Deploy"},
+				},
+			},
+		},
+		".github/workflows/deploy.yml": GitHubWorkflow{
+			Name: "Deploy",
+			On: githubWorkflowHeader{
+				Push: &gitHubWorkflowOnPush{},
+			},
+		},
+	}
+
+	resolved := workflows.ResolveWorkflowRuns()
+
+	expected := []upstreamWorkflow{
+		{Path: ".github/workflows/ci.yml", Workflow: ci},
+		{Path: ".github/workflows/unnamed.yml", Workflow: unnamed},
 	}
 
-	expected := []string{"vendor/**", "*.md", "docs/**", "CHANGELOG.md"}
-	result := workflow.ignorePaths()
-	require.ElementsMatch(t, expected, result)
+	require.Equal(t, expected, resolved[".github/workflows/coverage.yml"].triggeredBy)
+	require.True(t, resolved[".github/workflows/coverage.yml"].IsWorkflowRunForPullRequest())
+
+	// Chains are followed, and cycles don't cause trouble.
+	require.Equal(t, expected, resolved[".github/workflows/report.yml"].triggeredBy)
+
+	require.False(t, resolved[".github/workflows/after-deploy.yml"].IsWorkflowRunForPullRequest())
+	require.False(t, resolved[".github/workflows/ci.yml"].IsWorkflowRunForPullRequest())
+
+	// The original collection isn't modified.
+	require.Nil(t, workflows[".github/workflows/coverage.yml"].triggeredBy)
+}
+
+func TestResolveReusableWorkflows(t *testing.T) {
+	workflows := GitHubWorkflowCollection{
+		".github/workflows/ci.yml": GitHubWorkflow{
+			Jobs: map[string]gitHubWorkflowJob{
+				"build":  {Uses: "./.github/workflows/build.yml"},
+				"remote": {Uses: "grafana/shared-workflows/.github/workflows/ci.yml@main"},
+				"action": {Uses: "./.github/actions/setup"},
+			},
+		},
+		".github/workflows/build.yml": GitHubWorkflow{
+			Jobs: map[string]gitHubWorkflowJob{
+				"lint": {Uses: "./.github/workflows/lint.yml"},
+			},
+		},
+		".github/workflows/lint.yml": GitHubWorkflow{
+			Jobs: map[string]gitHubWorkflowJob{
+				"again": {Uses: "./.github/workflows/build.yml"},
+			},
+		},
+	}
+
+	resolved := workflows.ResolveReusableWorkflows()
+
+	build := resolved[".github/workflows/ci.yml"].Jobs["build"].callee
+	require.NotNil(t, build)
+	require.Equal(t, ".github/workflows/build.yml", build.Path)
+
+	lint := build.Workflow.Jobs["lint"].callee
+	require.NotNil(t, lint)
+	require.Equal(t, ".github/workflows/lint.yml", lint.Path)
+
+	// The cycle back to build.yml isn't followed.
+	require.Nil(t, lint.Workflow.Jobs["again"].callee)
+
+	require.Nil(t, resolved[".github/workflows/ci.yml"].Jobs["remote"].callee)
+	require.Nil(t, resolved[".github/workflows/ci.yml"].Jobs["action"].callee)
+
+	require.Equal(t, []string{
+		".github/workflows/build.yml",
+		".github/workflows/lint.yml",
+	}, resolved[".github/workflows/ci.yml"].calleePaths())
+
+	// The original collection isn't changed.
+	require.Nil(t, workflows[".github/workflows/ci.yml"].Jobs["build"].callee)
+}
+
+func TestIsPullRequestReviewWorkflow(t *testing.T) {
+	testCases := []struct {
+		name     string
+		workflow GitHubWorkflow
+		expected bool
+	}{
+		{
+			name:     "no review trigger",
+			workflow: GitHubWorkflow{On: githubWorkflowHeader{Push: &gitHubWorkflowOnPush{}}},
+			expected: false,
+		},
+		{
+			name:     "default types",
+			workflow: GitHubWorkflow{On: githubWorkflowHeader{PullRequestReview: &gitHubWorkflowOnPullRequestReview{}}},
+			expected: true,
+		},
+		{
+			name: "submitted",
+			workflow: GitHubWorkflow{On: githubWorkflowHeader{PullRequestReview: &gitHubWorkflowOnPullRequestReview{
+				Types: []string{"submitted"},
+			}}},
+			expected: true,
+		},
+		{
+			name: "dismissed only",
+			workflow: GitHubWorkflow{On: githubWorkflowHeader{PullRequestReview: &gitHubWorkflowOnPullRequestReview{
+				Types: []string{"dismissed"},
+			}}},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.workflow.IsPullRequestReviewWorkflow())
+			require.Equal(t, tc.expected, tc.workflow.RunsForPullRequests())
+		})
+	}
+}
+
+func TestRunsOnSynchronize(t *testing.T) {
+	require.True(t, gitHubWorkflowOnPullRequest{}.runsOnSynchronize())
+	require.True(t, gitHubWorkflowOnPullRequest{Types: []string{"synchronize"}}.runsOnSynchronize())
+	require.False(t, gitHubWorkflowOnPullRequest{Types: []string{"opened"}}.runsOnSynchronize())
+
+	testCases := []struct {
+		name     string
+		on       githubWorkflowHeader
+		expected bool
+	}{
+		{
+			name:     "no pull request triggers",
+			expected: false,
+		},
+		{
+			name:     "default types",
+			on:       githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}},
+			expected: true,
+		},
+		{
+			// Each trigger has its own types: pull_request_target's defaults
+			// aren't narrowed down by pull_request's.
+			name: "one trigger without synchronize",
+			on: githubWorkflowHeader{
+				PullRequest:       &gitHubWorkflowOnPullRequest{Types: []string{"opened"}},
+				PullRequestTarget: &gitHubWorkflowOnPullRequest{},
+			},
+			expected: true,
+		},
+		{
+			name: "no trigger with synchronize",
+			on: githubWorkflowHeader{
+				PullRequest:       &gitHubWorkflowOnPullRequest{Types: []string{"opened"}},
+				PullRequestTarget: &gitHubWorkflowOnPullRequest{Types: []string{"labeled"}},
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, GitHubWorkflow{On: tc.on}.RunsOnSynchronize())
+		})
+	}
 }
 
 func FuzzGitHubWorkflowUnmarshalYAML(f *testing.F) {
@@ -216,68 +692,135 @@ on:
 		// Check that no matter what input we get, isPullRequestWorkflow doesn't panic
 		_ = wf.IsPullRequestWorkflow()
 
-		// Check that paths() and ignorePaths() don't panic
-		_ = wf.paths()
-		_ = wf.ignorePaths()
+		// Check that pullRequestTriggers() doesn't panic
+		_ = wf.pullRequestTriggers()
 	})
 }
 
 func TestTypes(t *testing.T) {
+	require.Equal(t, defaultTypes, gitHubWorkflowOnPullRequest{}.types())
+	require.Equal(t, []string{"opened", "reopened"}, gitHubWorkflowOnPullRequest{Types: []string{"opened", "reopened"}}.types())
+}
+
+func TestCancelsSupersededRuns(t *testing.T) {
 	testCases := []struct {
-		name     string
-		workflow GitHubWorkflow
-		expected []string
+		name        string
+		yamlContent string
+		expected    bool
 	}{
 		{
-			name: "pull_request only",
-			workflow: GitHubWorkflow{
-				On: githubWorkflowHeader{
-					PullRequest: &gitHubWorkflowOnPullRequest{},
-				},
-			},
-			expected: defaultTypes,
+			name: "no concurrency",
+			yamlContent: `
+on: pull_request
+jobs:
+  build: {}
+`,
 		},
 		{
-			name: "pull_request_target only",
-			workflow: GitHubWorkflow{
-				On: githubWorkflowHeader{
-					PullRequestTarget: &gitHubWorkflowOnPullRequest{},
-				},
-			},
-			expected: defaultTypes,
+			name: "group only",
+			yamlContent: `
+on: pull_request
+concurrency: ci-${{ github.ref }}
+`,
 		},
 		{
-			name: "both pull_request and pull_request_target",
-			workflow: GitHubWorkflow{
-				On: githubWorkflowHeader{
-					PullRequest:       &gitHubWorkflowOnPullRequest{},
-					PullRequestTarget: &gitHubWorkflowOnPullRequest{},
-				},
-			},
-			expected: defaultTypes,
+			name: "workflow cancels in progress",
+			yamlContent: `
+on: pull_request
+concurrency:
+  group: ci-${{ github.ref }}
+  cancel-in-progress: true
+`,
+			expected: true,
 		},
 		{
-			name:     "neither pull_request nor pull_request_target",
-			workflow: GitHubWorkflow{},
-			expected: nil,
+			name: "job cancels in progress",
+			yamlContent: `
+on: pull_request
+jobs:
+  build: {}
+  deploy:
+    concurrency:
+      group: deploy
+      cancel-in-progress: true
+`,
+			expected: true,
 		},
 		{
-			name: "pull_request with types",
-			workflow: GitHubWorkflow{
-				On: githubWorkflowHeader{
-					PullRequest: &gitHubWorkflowOnPullRequest{
-						Types: []string{"opened", "reopened"},
-					},
-				},
-			},
-			expected: []string{"opened", "reopened"},
+			name: "explicitly doesn't cancel",
+			yamlContent: `
+on: pull_request
+concurrency:
+  group: ci
+  cancel-in-progress: false
+`,
+		},
+		{
+			name: "cancels for pull requests",
+			yamlContent: `
+on: [pull_request, push]
+concurrency:
+  group: ci-${{ github.ref }}
+  cancel-in-progress: ${{ github.event_name == 'pull_request' }}
+`,
+			expected: true,
+		},
+		{
+			name: "only cancels pushes",
+			yamlContent: `
+on: [pull_request, push]
+concurrency:
+  group: ci-${{ github.ref }}
+  cancel-in-progress: ${{ github.event_name == 'push' }}
+`,
+		},
+		{
+			name: "depends on the branch",
+			yamlContent: `
+on: pull_request
+concurrency:
+  group: ci-${{ github.ref }}
+  cancel-in-progress: ${{ github.ref != 'refs/heads/main' }}
+`,
+			expected: true,
+		},
+		{
+			name: "merge queue",
+			yamlContent: `
+on: merge_group
+concurrency:
+  group: ci-${{ github.ref }}
+  cancel-in-progress: ${{ github.event_name == 'merge_group' }}
+`,
+			expected: true,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := tc.workflow.types()
-			require.ElementsMatch(t, tc.expected, result)
+			var wf GitHubWorkflow
+			require.NoError(t, yaml.Unmarshal([]byte(tc.yamlContent), &wf))
+
+			require.Equal(t, tc.expected, wf.cancelsSupersededRuns())
 		})
 	}
+
+	t.Run("called workflow cancels in progress", func(t *testing.T) {
+		workflows := GitHubWorkflowCollection{
+			".github/workflows/ci.yml": GitHubWorkflow{
+				On: githubWorkflowHeader{PullRequest: &gitHubWorkflowOnPullRequest{}},
+				Jobs: map[string]gitHubWorkflowJob{
+					"build": {Uses: "./.github/workflows/build.yml"},
+				},
+			},
+			".github/workflows/build.yml": GitHubWorkflow{
+				Concurrency: &workflowConcurrency{
+					Group:            "build",
+					CancelInProgress: "${{ github.event_name == 'pull_request' }}",
+				},
+			},
+		}
+
+		require.True(t, workflows.ResolveReusableWorkflows()[".github/workflows/ci.yml"].cancelsSupersededRuns())
+	})
 }